@@ -0,0 +1,19 @@
+// Package hadithgo holds the files that can be compiled into the binaries:
+// the dataset (books/), the web UI (web/) and the OpenAPI spec (api/).
+// They are only embedded when building with -tags embed; otherwise the
+// accessors return nil and the commands read the files from disk.
+package hadithgo
+
+import "io/fs"
+
+// Set by assets_embed.go when built with -tags embed.
+var books, web, api fs.FS
+
+// Books returns the embedded books directory, or nil.
+func Books() fs.FS { return books }
+
+// Web returns the embedded web UI directory, or nil.
+func Web() fs.FS { return web }
+
+// API returns the embedded api directory (openapi.yaml, proto), or nil.
+func API() fs.FS { return api }
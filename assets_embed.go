@@ -0,0 +1,31 @@
+//go:build embed
+
+package hadithgo
+
+import (
+    "embed"
+    "io/fs"
+)
+
+var (
+    //go:embed books
+    booksFS embed.FS
+    //go:embed web
+    webFS embed.FS
+    //go:embed api/openapi.yaml
+    apiFS embed.FS
+)
+
+func init() {
+    books = sub(booksFS, "books")
+    web = sub(webFS, "web")
+    api = sub(apiFS, "api")
+}
+
+func sub(fsys embed.FS, dir string) fs.FS {
+    s, err := fs.Sub(fsys, dir)
+    if err != nil {
+        panic(err) // dir is one of the embedded directories above
+    }
+    return s
+}
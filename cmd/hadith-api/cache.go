@@ -0,0 +1,132 @@
+package main
+
+import (
+    "crypto/sha256"
+    "encoding/hex"
+    "net/http"
+    "strconv"
+    "strings"
+    "time"
+)
+
+// cached serves next with validators for the data version: a strong ETag,
+// Last-Modified and Cache-Control from api.cache_max_age. The tag names the
+// request as well as the data, so it only matches the URL it was issued
+// for. A request whose If-None-Match (or, without one, If-Modified-Since)
+// still matches gets a 304 without running next: validators are only sent
+// with a 200, and the same URL on the same data answers the same.
+func (s *server) cached(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodGet && r.Method != http.MethodHead {
+            next.ServeHTTP(w, r)
+            return
+        }
+        version, err := s.repo.Version(r.Context())
+        if err != nil {
+            next.ServeHTTP(w, r) // the handler reports the backend failure
+            return
+        }
+        loaded, err := s.repo.Loaded(r.Context())
+        if err != nil {
+            next.ServeHTTP(w, r)
+            return
+        }
+        etag := s.etag(r, version)
+        // HTTP dates have whole seconds.
+        modified := loaded.UTC().Truncate(time.Second)
+        h := w.Header()
+        h.Set("ETag", etag)
+        h.Set("Last-Modified", modified.Format(http.TimeFormat))
+        h.Set("Cache-Control", s.cacheControl())
+        if notModified(r, etag, modified) {
+            w.WriteHeader(http.StatusNotModified)
+            return
+        }
+        next.ServeHTTP(&cacheWriter{ResponseWriter: w, s: s, r: r, version: version}, r)
+    })
+}
+
+// etag returns the entity tag for the response to r built from version: the
+// version and a hash of the path and query, with the parameters in
+// canonical order. HEAD shares the tag of GET, as it describes the same
+// representation. Page tokens are part of some responses, so with a random
+// cursor key (no cursor_secret) the tag also names this process.
+func (s *server) etag(r *http.Request, version string) string {
+    sum := sha256.Sum256([]byte(r.URL.Path + "?" + r.URL.Query().Encode()))
+    tag := version + "-" + hex.EncodeToString(sum[:6])
+    if s.cfg.CursorSecret == "" {
+        tag += "-" + s.boot
+    }
+    return `"` + tag + `"`
+}
+
+func (s *server) cacheControl() string {
+    if age := time.Duration(s.cfg.API.CacheMaxAge); age > 0 {
+        return "public, max-age=" + strconv.Itoa(int(age.Seconds()))
+    }
+    return "public, no-cache"
+}
+
+// notModified reports whether the client's copy is current. Its tag is
+// that of the representation compress would send: the gzipped one when the
+// request accepts gzip, as every API response is compressible. "*" never
+// matches, since only next knows whether there is a representation at all.
+func notModified(r *http.Request, etag string, modified time.Time) bool {
+    if acceptsGzip(r.Header.Get("Accept-Encoding")) {
+        etag = gzipETag(etag)
+    }
+    if inm := r.Header.Get("If-None-Match"); inm != "" {
+        for _, tag := range strings.Split(inm, ",") {
+            // If-None-Match uses the weak comparison.
+            if strings.TrimPrefix(strings.TrimSpace(tag), "W/") == etag {
+                return true
+            }
+        }
+        return false
+    }
+    since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+    return err == nil && !modified.After(since)
+}
+
+// cacheWriter withdraws the validators from responses they do not
+// describe: errors, and responses built after a reload changed the data
+// version the validators were computed from.
+type cacheWriter struct {
+    http.ResponseWriter
+    s       *server
+    r       *http.Request
+    version string
+    wrote   bool
+}
+
+func (w *cacheWriter) WriteHeader(status int) {
+    if w.wrote {
+        return
+    }
+    w.wrote = true
+    if v, err := w.s.repo.Version(w.r.Context()); status != http.StatusOK || err != nil || v != w.version {
+        h := w.Header()
+        h.Del("ETag")
+        h.Del("Last-Modified")
+        h.Set("Cache-Control", "no-store")
+    }
+    w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheWriter) Write(b []byte) (int, error) {
+    if !w.wrote {
+        w.WriteHeader(http.StatusOK)
+    }
+    return w.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been written so far, so that streamed lists reach
+// the client as they are encoded.
+func (w *cacheWriter) Flush() {
+    if !w.wrote {
+        w.WriteHeader(http.StatusOK)
+    }
+    if f, ok := w.ResponseWriter.(http.Flusher); ok {
+        f.Flush()
+    }
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+    "net/http"
+    "testing"
+)
+
+func TestCachedConditional(t *testing.T) {
+    s := testServer(t)
+    h := s.handler()
+    resp := do(t, h, "GET", "/v1/hadith/malik/1", "")
+    etag, modified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+    if resp.StatusCode != http.StatusOK || etag == "" || modified == "" {
+        t.Fatalf("GET = %d, ETag %q, Last-Modified %q", resp.StatusCode, etag, modified)
+    }
+    resp = do(t, h, "GET", "/v1/hadith/malik/1", "", "Accept-Encoding: gzip")
+    gzipTag := resp.Header.Get("ETag")
+    if resp.Header.Get("Content-Encoding") != "gzip" || gzipTag != gzipETag(etag) {
+        t.Fatalf("gzipped GET: Content-Encoding %q, ETag %q; want gzip, %q", resp.Header.Get("Content-Encoding"), gzipTag, gzipETag(etag))
+    }
+    tests := []struct {
+        name    string
+        url     string
+        headers []string
+        status  int
+    }{
+        {"etag", "/v1/hadith/malik/1", []string{"If-None-Match: " + etag}, http.StatusNotModified},
+        {"weak etag in a list", "/v1/hadith/malik/1", []string{`If-None-Match: "x", W/` + etag}, http.StatusNotModified},
+        {"gzip etag with gzip", "/v1/hadith/malik/1", []string{"If-None-Match: " + gzipTag, "Accept-Encoding: gzip"}, http.StatusNotModified},
+        {"gzip etag without gzip", "/v1/hadith/malik/1", []string{"If-None-Match: " + gzipTag}, http.StatusOK},
+        {"plain etag with gzip", "/v1/hadith/malik/1", []string{"If-None-Match: " + etag, "Accept-Encoding: gzip"}, http.StatusOK},
+        {"other URL", "/v1/hadith/malik/2", []string{"If-None-Match: " + etag}, http.StatusOK},
+        {"star", "/v1/hadith/malik/1", []string{"If-None-Match: *"}, http.StatusOK},
+        {"since", "/v1/hadith/malik/1", []string{"If-Modified-Since: " + modified}, http.StatusNotModified},
+        {"etag wins over since", "/v1/hadith/malik/1", []string{`If-None-Match: "x"`, "If-Modified-Since: " + modified}, http.StatusOK},
+    }
+    for _, tt := range tests {
+        resp := do(t, h, "GET", tt.url, "", tt.headers...)
+        if resp.StatusCode != tt.status {
+            t.Errorf("%s: status %d, want %d", tt.name, resp.StatusCode, tt.status)
+        }
+        if body := readBody(t, resp); tt.status == http.StatusNotModified && body != "" {
+            t.Errorf("%s: 304 with body %q", tt.name, body)
+        }
+    }
+}
+
+func TestCachedSkipsHandler(t *testing.T) {
+    s := testServer(t)
+    runs := 0
+    h := s.cached(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        runs++
+        w.Write([]byte("ok"))
+    }))
+    etag := do(t, h, "GET", "/export?format=csv", "").Header.Get("ETag")
+    resp := do(t, h, "GET", "/export?format=csv", "", "If-None-Match: "+etag)
+    if resp.StatusCode != http.StatusNotModified || runs != 1 {
+        t.Errorf("revalidation: status %d after %d runs, want 304 after 1", resp.StatusCode, runs)
+    }
+}
+
+func TestCachedErrors(t *testing.T) {
+    h := testServer(t).handler()
+    resp := do(t, h, "GET", "/v1/hadith/malik/999999", "")
+    if resp.StatusCode != http.StatusNotFound {
+        t.Fatalf("status %d, want 404", resp.StatusCode)
+    }
+    if resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "" || resp.Header.Get("Cache-Control") != "no-store" {
+        t.Errorf("error response has validators: %v", resp.Header)
+    }
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+    "compress/gzip"
+    "io"
+    "net/http"
+    "strconv"
+    "strings"
+    "sync"
+)
+
+var gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(io.Discard) }}
+
+// compress gzips text responses for clients that accept it. Arabic text
+// with its diacritics shrinks to about a fifth.
+func compress(next http.Handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        w.Header().Add("Vary", "Accept-Encoding")
+        if !acceptsGzip(r.Header.Get("Accept-Encoding")) {
+            next.ServeHTTP(w, r)
+            return
+        }
+        gw := &gzipWriter{ResponseWriter: w}
+        defer gw.close()
+        next.ServeHTTP(gw, r)
+    })
+}
+
+// acceptsGzip reports whether an Accept-Encoding header allows gzip.
+func acceptsGzip(header string) bool {
+    star := false
+    for _, part := range strings.Split(header, ",") {
+        coding, params, _ := strings.Cut(part, ";")
+        q := 1.0
+        if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+            if f, err := strconv.ParseFloat(v, 64); err == nil {
+                q = f
+            }
+        }
+        switch strings.ToLower(strings.TrimSpace(coding)) {
+        case "gzip", "x-gzip":
+            return q > 0
+        case "*":
+            star = q > 0
+        }
+    }
+    return star
+}
+
+// gzipETag returns the tag of the gzipped representation of a response
+// tagged etag, which a strong tag has to tell apart.
+func gzipETag(etag string) string {
+    if !strings.HasSuffix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+        return etag
+    }
+    return strings.TrimSuffix(etag, `"`) + `-gzip"`
+}
+
+// gzipWriter compresses a successful response with a compressible content
+// type and passes anything else through.
+type gzipWriter struct {
+    http.ResponseWriter
+    gz    *gzip.Writer // nil unless compressing
+    wrote bool
+}
+
+func (w *gzipWriter) WriteHeader(status int) {
+    if w.wrote {
+        return
+    }
+    w.wrote = true
+    h := w.Header()
+    switch {
+    case status == http.StatusNotModified:
+        // The client holds the gzipped representation.
+        if etag := h.Get("ETag"); etag != "" {
+            h.Set("ETag", gzipETag(etag))
+        }
+    case status == http.StatusOK && h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")):
+        h.Set("Content-Encoding", "gzip")
+        h.Del("Content-Length")
+        if etag := h.Get("ETag"); etag != "" {
+            h.Set("ETag", gzipETag(etag))
+        }
+        w.gz = gzipWriters.Get().(*gzip.Writer)
+        w.gz.Reset(w.ResponseWriter)
+    }
+    w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *gzipWriter) Write(b []byte) (int, error) {
+    if !w.wrote {
+        if w.Header().Get("Content-Type") == "" {
+            w.Header().Set("Content-Type", http.DetectContentType(b))
+        }
+        w.WriteHeader(http.StatusOK)
+    }
+    if w.gz != nil {
+        return w.gz.Write(b)
+    }
+    return w.ResponseWriter.Write(b)
+}
+
+// Flush sends what has been written so far.
+func (w *gzipWriter) Flush() {
+    if w.gz != nil {
+        _ = w.gz.Flush()
+    }
+    if f, ok := w.ResponseWriter.(http.Flusher); ok {
+        f.Flush()
+    }
+}
+
+func (w *gzipWriter) close() {
+    if w.gz != nil {
+        _ = w.gz.Close()
+        gzipWriters.Put(w.gz)
+        w.gz = nil
+    }
+}
+
+// compressible reports whether a content type is text, which gzip shrinks.
+func compressible(contentType string) bool {
+    mediaType, _, _ := strings.Cut(contentType, ";")
+    mediaType = strings.TrimSpace(strings.ToLower(mediaType))
+    if strings.HasPrefix(mediaType, "text/") || strings.HasSuffix(mediaType, "+xml") || strings.HasSuffix(mediaType, "+json") {
+        return true
+    }
+    switch mediaType {
+    case "application/json", "application/x-ndjson", "application/xml", "application/yaml", "application/javascript":
+        return true
+    }
+    return false
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+    "errors"
+    "log"
+    "net/http"
+)
+
+// handler serves one endpoint. It returns the response data and, for lists,
+// their paging metadata, or an error. The route adapters v1 and legacy turn
+// the result into a response; a handler writes only headers itself.
+type handler func(w http.ResponseWriter, r *http.Request) (any, *meta, error)
+
+// apiError is an error reported to the client: an HTTP status, a stable
+// machine-readable code and a message for people. Any other error from a
+// handler is a backend failure, logged and reported as "internal".
+type apiError struct {
+    Status  int    `json:"-"`
+    Code    string `json:"code"`
+    Message string `json:"message"`
+    Details any    `json:"details,omitempty"`
+}
+
+func (e *apiError) Error() string { return e.Message }
+
+// Error codes. Clients switch on these, so they never change meaning.
+const (
+    codeInvalidArgument  = "invalid_argument"   // a malformed parameter
+    codeInvalidQuery     = "invalid_query"      // q fails to parse; details: {position}
+    codeUnknownLanguage  = "unknown_language"   // details: {available}
+    codeInvalidCursor    = "invalid_cursor"     // not a cursor this server issued for this search
+    codeStaleCursor      = "stale_cursor"       // the data changed since the cursor was issued
+    codeNotFound         = "not_found"          // no such book, hadith, chapter or route
+    codeUnauthorized     = "unauthorized"       // missing or wrong admin token
+    codeMethodNotAllowed = "method_not_allowed" // see the Allow header
+    codeReloadFailed     = "reload_failed"      // the previous data is still served
+    codeInternal         = "internal"
+)
+
+func invalidArgument(msg string) *apiError {
+    return &apiError{Status: http.StatusBadRequest, Code: codeInvalidArgument, Message: msg}
+}
+
+func notFound(msg string) *apiError {
+    return &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: msg}
+}
+
+// meta describes a page of a list. Fields that do not apply are omitted.
+type meta struct {
+    Total      int    `json:"total"`
+    Offset     *int   `json:"offset,omitempty"`
+    Limit      *int   `json:"limit,omitempty"`
+    Page       *int   `json:"page,omitempty"`
+    PageSize   *int   `json:"page_size,omitempty"`
+    NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// envelope is the body of every /v1 response: data and meta on success,
+// error otherwise.
+type envelope struct {
+    Data  any       `json:"data,omitempty"`
+    Meta  *meta     `json:"meta,omitempty"`
+    Error *apiError `json:"error,omitempty"`
+}
+
+// body is the data of a handler that writes its response itself, in a
+// format other than JSON. The adapters call it once the handler succeeded,
+// so that errors found before still get their status and error body.
+type body func(w http.ResponseWriter)
+
+// v1 serves h with the JSON envelope.
+func v1(h handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        data, m, err := h(w, r)
+        if err != nil {
+            e := clientError(err)
+            writeJSON(w, r, e.Status, envelope{Error: e})
+            return
+        }
+        if b, ok := data.(body); ok {
+            b(w)
+            return
+        }
+        writeJSON(w, r, http.StatusOK, envelope{Data: data, Meta: m})
+    })
+}
+
+// legacy serves h the way the unversioned routes always have: the bare
+// data, paging in headers only, and errors as plain text.
+func legacy(h handler) http.Handler {
+    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        data, _, err := h(w, r)
+        if b, ok := data.(body); ok && err == nil {
+            b(w)
+            return
+        }
+        if err == nil {
+            writeJSON(w, r, http.StatusOK, data)
+            return
+        }
+        switch e := clientError(err); {
+        case e.Status == http.StatusNotFound:
+            http.NotFound(w, r)
+        case e.Code == codeReloadFailed:
+            // POST /admin/reload has always reported failures as JSON.
+            writeJSON(w, r, e.Status, map[string]string{"error": e.Message})
+        default:
+            http.Error(w, e.Message, e.Status)
+        }
+    })
+}
+
+// clientError returns err as reported to the client, logging backend
+// failures.
+func clientError(err error) *apiError {
+    var e *apiError
+    if errors.As(err, &e) {
+        return e
+    }
+    log.Printf("store: %v", err)
+    return &apiError{Status: http.StatusInternalServerError, Code: codeInternal, Message: "internal error"}
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+    "encoding/json"
+    "net/http"
+    "net/url"
+    "strings"
+    "testing"
+
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+)
+
+// decodeEnvelope decodes a /v1 response body.
+func decodeEnvelope(t *testing.T, resp *http.Response) (data json.RawMessage, m *meta, e *apiError) {
+    t.Helper()
+    var env struct {
+        Data  json.RawMessage `json:"data"`
+        Meta  *meta           `json:"meta"`
+        Error *struct {
+            Code    string          `json:"code"`
+            Message string          `json:"message"`
+            Details json.RawMessage `json:"details"`
+        } `json:"error"`
+    }
+    if err := json.NewDecoder(resp.Body).Decode(&env); err != nil {
+        t.Fatalf("decode envelope: %v", err)
+    }
+    if env.Error != nil {
+        e = &apiError{Code: env.Error.Code, Message: env.Error.Message, Details: env.Error.Details}
+    }
+    return env.Data, env.Meta, e
+}
+
+func TestV1Envelope(t *testing.T) {
+    h := testServer(t).handler()
+    resp := do(t, h, "GET", "/v1/hadith/malik/1", "")
+    data, m, e := decodeEnvelope(t, resp)
+    if resp.StatusCode != http.StatusOK || e != nil || m != nil {
+        t.Fatalf("GET hadith: %d, meta %v, error %v", resp.StatusCode, m, e)
+    }
+    var got hadith.Hadith
+    if err := json.Unmarshal(data, &got); err != nil || got.Book != "malik" || got.Number != 1 {
+        t.Errorf("data = %s (%v), want malik #1", data, err)
+    }
+    // Lists have their paging in meta.
+    resp = do(t, h, "GET", "/v1/books/malik/hadiths?offset=5&limit=3", "")
+    data, m, e = decodeEnvelope(t, resp)
+    var page []hadith.Hadith
+    if err := json.Unmarshal(data, &page); err != nil || e != nil {
+        t.Fatalf("browse: %v, %v", err, e)
+    }
+    if len(page) != 3 || m == nil || m.Total != 1587 || m.Offset == nil || *m.Offset != 5 {
+        t.Errorf("browse: %d hadiths, meta %+v", len(page), m)
+    }
+}
+
+func TestV1Errors(t *testing.T) {
+    s := testServer(t)
+    h := s.handler()
+    stale := s.tokens.Encode(hadith.Cursor{Score: 1, Book: "malik", Number: 1}, "old", hadith.SearchScope("shalat", hadith.SearchOptions{}))
+    tests := []struct {
+        method, url, body string
+        status            int
+        code              string
+        details           string
+    }{
+        {"GET", "/v1/hadith/malik/x", "", http.StatusBadRequest, codeInvalidArgument, ""},
+        {"GET", "/v1/hadith/malik/999999", "", http.StatusNotFound, codeNotFound, ""},
+        {"GET", "/v1/books/bukhari/hadiths", "", http.StatusNotFound, codeNotFound, ""},
+        {"GET", "/v1/nope", "", http.StatusNotFound, codeNotFound, ""},
+        {"GET", "/v1/search?q=" + url.QueryEscape("(shalat"), "", http.StatusBadRequest, codeInvalidQuery, `{"position":`},
+        {"GET", "/v1/hadith/malik/1?lang=xx", "", http.StatusBadRequest, codeUnknownLanguage, `{"available":["id"`},
+        {"GET", "/v1/search?q=shalat&cursor=garbage", "", http.StatusBadRequest, codeInvalidCursor, ""},
+        {"GET", "/v1/search?q=niat&cursor=" + stale, "", http.StatusBadRequest, codeInvalidCursor, ""},
+        {"GET", "/v1/search?q=shalat&cursor=" + stale, "", http.StatusGone, codeStaleCursor, ""},
+        {"GET", "/v1/hadith:batchGet", "", http.StatusMethodNotAllowed, codeMethodNotAllowed, ""},
+        {"POST", "/v1/hadith:batchGet", "{", http.StatusBadRequest, codeInvalidArgument, ""},
+    }
+    for _, tt := range tests {
+        resp := do(t, h, tt.method, tt.url, tt.body)
+        data, _, e := decodeEnvelope(t, resp)
+        if resp.StatusCode != tt.status || e == nil || e.Code != tt.code || data != nil {
+            t.Errorf("%s %s: %d, error %+v, data %s; want %d %s", tt.method, tt.url, resp.StatusCode, e, data, tt.status, tt.code)
+            continue
+        }
+        if e.Message == "" {
+            t.Errorf("%s %s: no message", tt.method, tt.url)
+        }
+        if details, _ := e.Details.(json.RawMessage); !strings.HasPrefix(string(details), tt.details) {
+            t.Errorf("%s %s: details %s, want %s...", tt.method, tt.url, details, tt.details)
+        }
+    }
+}
+
+func TestLegacy(t *testing.T) {
+    h := testServer(t).handler()
+    // The bare data, paging in headers only.
+    resp := do(t, h, "GET", "/books/malik/hadiths?offset=5&limit=3", "")
+    var page []hadith.Hadith
+    if err := json.NewDecoder(resp.Body).Decode(&page); err != nil || len(page) != 3 {
+        t.Fatalf("browse: %v, %d hadiths", err, len(page))
+    }
+    if resp.Header.Get("X-Total-Count") != "1587" {
+        t.Errorf("X-Total-Count = %q", resp.Header.Get("X-Total-Count"))
+    }
+    // Plain-text errors.
+    resp = do(t, h, "GET", "/hadith/malik/x", "")
+    if body := readBody(t, resp); resp.StatusCode != http.StatusBadRequest || !strings.HasPrefix(resp.Header.Get("Content-Type"), "text/plain") || strings.TrimSpace(body) != "invalid number" {
+        t.Errorf("bad number: %d %q", resp.StatusCode, body)
+    }
+    if resp := do(t, h, "GET", "/hadith/malik/999999", ""); resp.StatusCode != http.StatusNotFound {
+        t.Errorf("missing hadith: %d", resp.StatusCode)
+    }
+}
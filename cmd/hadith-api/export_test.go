@@ -0,0 +1,109 @@
+package main
+
+import (
+    "encoding/csv"
+    "encoding/xml"
+    "net/http"
+    "reflect"
+    "strings"
+    "testing"
+    "testing/fstest"
+
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+)
+
+// exportServer serves one book whose text needs quoting in CSV and
+// escaping in XML.
+func exportServer(t *testing.T) http.Handler {
+    t.Helper()
+    store, err := hadith.OpenFS(fstest.MapFS{"tricky.json": {Data: []byte(`[
+        {"number": 1, "arab": "قال: \"إنما\"", "id": "Dia berkata, \"amal\"\nbaris kedua", "kitab": "Iman, Islam", "grade": "<shahih> & \"hasan\""},
+        {"number": 2, "arab": "نص", "id": "a < b && c > d 'kutip'", "bab": "]]> akhir"}
+    ]`)}}, hadith.Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return storeServer(store).handler()
+}
+
+func TestExportCSV(t *testing.T) {
+    resp := do(t, exportServer(t), "GET", "/v1/export?format=csv&book=tricky", "")
+    if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/csv; charset=utf-8" {
+        t.Fatalf("status %d, type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+    }
+    if cd := resp.Header.Get("Content-Disposition"); cd != `attachment; filename="tricky.csv"` {
+        t.Errorf("Content-Disposition = %q", cd)
+    }
+    if n := resp.Header.Get("X-Total-Count"); n != "2" {
+        t.Errorf("X-Total-Count = %q", n)
+    }
+    rows, err := csv.NewReader(resp.Body).ReadAll()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(rows) != 3 {
+        t.Fatalf("got %d rows, want a header and 2", len(rows))
+    }
+    if want := []string{"book", "number", "kitab", "bab", "grade", "arab", "text_id"}; !reflect.DeepEqual(rows[0][:len(want)], want) {
+        t.Errorf("header = %q", rows[0])
+    }
+    // Quotes, commas and newlines survive the round trip.
+    if got := rows[1][:7]; !reflect.DeepEqual(got, []string{"tricky", "1", "Iman, Islam", "", `<shahih> & "hasan"`, `قال: "إنما"`, "Dia berkata, \"amal\"\nbaris kedua"}) {
+        t.Errorf("row 1 = %q", got)
+    }
+}
+
+func TestExportTEI(t *testing.T) {
+    resp := do(t, exportServer(t), "GET", "/v1/export?format=xml&q=kutip", "")
+    if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "application/tei+xml" {
+        t.Fatalf("status %d, type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+    }
+    var doc struct {
+        Query string `xml:"teiHeader>fileDesc>publicationStmt>p>q"`
+        Divs  []struct {
+            N    string   `xml:"n,attr"`
+            Head string   `xml:"head"`
+            AB   []string `xml:"ab"`
+        } `xml:"text>body>div"`
+    }
+    body := readBody(t, resp)
+    if err := xml.Unmarshal([]byte(body), &doc); err != nil {
+        t.Fatalf("not well-formed: %v\n%s", err, body)
+    }
+    if doc.Query != "kutip" || len(doc.Divs) != 1 {
+        t.Fatalf("query %q, %d hadiths", doc.Query, len(doc.Divs))
+    }
+    d := doc.Divs[0]
+    if d.N != "tricky 2" || d.Head != "]]> akhir" || len(d.AB) != 2 || d.AB[1] != "a < b && c > d 'kutip'" {
+        t.Errorf("hadith = %+v", d)
+    }
+    if strings.Contains(body, "a < b") || strings.Contains(body, "&& c") {
+        t.Error("text not escaped")
+    }
+    // All of the book, with the grade of the first.
+    resp = do(t, exportServer(t), "GET", "/export?format=xml&book=tricky", "")
+    body = readBody(t, resp)
+    if err := xml.Unmarshal([]byte(body), new(struct{})); err != nil || !strings.Contains(body, "&lt;shahih&gt; &amp; &#34;hasan&#34;") {
+        t.Errorf("grade not escaped (%v):\n%s", err, body)
+    }
+}
+
+func TestExportErrors(t *testing.T) {
+    h := exportServer(t)
+    tests := []struct {
+        url    string
+        status int
+        code   string
+    }{
+        {"/v1/export?format=pdf", http.StatusBadRequest, codeInvalidArgument},
+        {"/v1/export?book=bukhari", http.StatusNotFound, codeNotFound},
+        {"/v1/export?q=(", http.StatusBadRequest, codeInvalidQuery},
+    }
+    for _, tt := range tests {
+        resp := do(t, h, "GET", tt.url, "")
+        _, _, e := decodeEnvelope(t, resp)
+        if resp.StatusCode != tt.status || e == nil || e.Code != tt.code {
+            t.Errorf("%s: %d, %+v; want %d %s", tt.url, resp.StatusCode, e, tt.status, tt.code)
+        }
+    }
+}
@@ -0,0 +1,570 @@
+package main
+
+import (
+    "crypto/subtle"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log"
+    "net/http"
+    "strconv"
+    "strings"
+
+    "github.com/nuzlilatief/hadith-go/internal/config"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith/ref"
+)
+
+// server holds what the endpoints share. Each endpoint is a handler,
+// mounted both under /v1 and at its original, unversioned path.
+type server struct {
+    cfg      *config.Config
+    repo     hadith.Repository
+    reloader hadith.Reloader // nil when the backend cannot reload
+    tokens   *hadith.PageTokens
+    boot     string // names this process in ETags, see etag
+}
+
+// books serves GET /books: the book names, or with ?detail=true their
+// descriptions.
+func (s *server) books(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+    infos, err := s.repo.Books(r.Context())
+    if err != nil {
+        return nil, nil, err
+    }
+    if detail, _ := strconv.ParseBool(r.URL.Query().Get("detail")); detail {
+        return infos, &meta{Total: len(infos)}, nil
+    }
+    names := make([]string, len(infos))
+    for i, b := range infos {
+        names[i] = b.Name
+    }
+    return names, &meta{Total: len(names)}, nil
+}
+
+// book serves /books/{book}/hadiths, /books/{book}/chapters and
+// /books/{book}/chapters/{n}.
+func (s *server) book(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+    parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/books/"), "/")
+    if len(parts) == 2 && parts[1] == "hadiths" {
+        return s.browse(w, r, parts[0])
+    }
+    if len(parts) < 2 || len(parts) > 3 || parts[1] != "chapters" {
+        return nil, nil, invalidArgument("use /books/{book}/hadiths, /books/{book}/chapters or /books/{book}/chapters/{n}")
+    }
+    if len(parts) == 2 {
+        chapters, err := s.repo.Chapters(r.Context(), parts[0])
+        if err != nil {
+            return nil, nil, err
+        }
+        if chapters == nil {
+            chapters = []hadith.Chapter{}
+        }
+        return chapters, &meta{Total: len(chapters)}, nil
+    }
+    n, err := strconv.Atoi(parts[2])
+    if err != nil {
+        return nil, nil, invalidArgument("invalid chapter number")
+    }
+    ch, hadiths, ok, err := s.repo.Chapter(r.Context(), parts[0], n)
+    if err != nil {
+        return nil, nil, err
+    }
+    if !ok {
+        return nil, nil, notFound(fmt.Sprintf("no chapter %d in book %q", n, parts[0]))
+    }
+    return map[string]any{"chapter": ch, "hadiths": hadiths}, nil, nil
+}
+
+// browse serves GET /books/{book}/hadiths: the hadiths of book in number
+// order, limited to ?from= and ?to= (inclusive) when given, a page at a
+// time.
+func (s *server) browse(w http.ResponseWriter, r *http.Request, book string) (any, *meta, error) {
+    var bounds [2]int
+    for i, name := range []string{"from", "to"} {
+        if v := r.URL.Query().Get(name); v != "" {
+            n, err := strconv.Atoi(v)
+            if err != nil || n < 1 {
+                return nil, nil, invalidArgument("invalid " + name + " number")
+            }
+            bounds[i] = n
+        }
+    }
+    lang, err := s.langParam(r)
+    if err != nil {
+        return nil, nil, err
+    }
+    if err := s.checkBook(r, book); err != nil {
+        return nil, nil, err
+    }
+    // At most api.max_page_size hadiths per response; offset and limit,
+    // or page and page_size, pick the window as in search.
+    var offset, limit, page, pageSize int
+    for name, p := range map[string]*int{"offset": &offset, "limit": &limit, "page": &page, "page_size": &pageSize} {
+        if v := r.URL.Query().Get(name); v != "" {
+            n, err := strconv.Atoi(v)
+            if err != nil || n < 0 || n == 0 && name != "offset" {
+                return nil, nil, invalidArgument("invalid " + name)
+            }
+            *p = n
+        }
+    }
+    maxPageSize := s.cfg.API.MaxPageSize
+    usePages := r.URL.Query().Get("offset") == "" && (page > 0 || pageSize > 0)
+    if usePages {
+        page = max(page, 1)
+        if pageSize == 0 || pageSize > maxPageSize {
+            pageSize = maxPageSize
+        }
+        offset, limit = (page-1)*pageSize, pageSize
+    } else if limit == 0 || limit > maxPageSize {
+        limit = maxPageSize
+    }
+    hadiths, total, err := s.repo.BrowsePage(r.Context(), book, bounds[0], bounds[1], offset, limit)
+    if err != nil {
+        return nil, nil, err
+    }
+    out := make([]hadith.Hadith, len(hadiths))
+    for i, h := range hadiths {
+        out[i] = h.In(lang)
+    }
+    m := &meta{Total: total}
+    w.Header().Set("X-Total-Count", strconv.Itoa(total))
+    if usePages {
+        w.Header().Set("X-Page", strconv.Itoa(page))
+        w.Header().Set("X-Page-Size", strconv.Itoa(pageSize))
+        m.Page, m.PageSize = &page, &pageSize
+    } else {
+        w.Header().Set("X-Offset", strconv.Itoa(offset))
+        w.Header().Set("X-Limit", strconv.Itoa(limit))
+        m.Offset, m.Limit = &offset, &limit
+    }
+    return out, m, nil
+}
+
+// count serves GET /count.
+func (s *server) count(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+    n, err := s.repo.Count(r.Context())
+    if err != nil {
+        return nil, nil, err
+    }
+    return map[string]int{"count": n}, nil, nil
+}
+
+// search serves GET /search: a query, or with an empty q the hadiths of
+// ?book= (or of every book) in order.
+func (s *server) search(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+    q := r.URL.Query().Get("q")
+    book := r.URL.Query().Get("book")
+    lang, err := s.langParam(r)
+    if err != nil {
+        return nil, nil, err
+    }
+    // Back-compat: if page/page_size or offset not provided, honor legacy 'limit'.
+    limitStr := r.URL.Query().Get("limit")
+    pageStr := r.URL.Query().Get("page")
+    pageSizeStr := r.URL.Query().Get("page_size")
+    offsetStr := r.URL.Query().Get("offset")
+    cursorStr := r.URL.Query().Get("cursor")
+
+    // Choose mode precedence: cursor > offset/limit > page/page_size > legacy limit.
+    // A cursor takes its page size from limit, as the legacy mode does.
+    useCursor := cursorStr != ""
+    useOffset := !useCursor && offsetStr != ""
+    usePagination := !useCursor && !useOffset && (pageStr != "" || pageSizeStr != "")
+
+    // Defaults and caps
+    defaultPageSize := s.cfg.API.DefaultPageSize
+    maxPageSize := s.cfg.API.MaxPageSize
+
+    // Work out the window first so that the backend only returns (and
+    // highlights) the requested page.
+    offset, limit := 0, defaultPageSize
+    page, pageSize := 1, defaultPageSize
+    switch {
+    case useOffset:
+        // Offset/limit style pagination for compatibility with some clients
+        if n, err := strconv.Atoi(offsetStr); err == nil && n >= 0 {
+            offset = n
+        }
+        if limitStr != "" {
+            if n, err := strconv.Atoi(limitStr); err == nil && n > 0 {
+                limit = n
+            }
+        }
+        if limit > maxPageSize { limit = maxPageSize }
+    case usePagination:
+        if pageStr != "" {
+            if n, err := strconv.Atoi(pageStr); err == nil && n > 0 {
+                page = n
+            }
+        }
+        if pageSizeStr != "" {
+            if n, err := strconv.Atoi(pageSizeStr); err == nil && n > 0 {
+                pageSize = n
+            }
+        }
+        if pageSize > maxPageSize { pageSize = maxPageSize }
+        offset, limit = (page-1)*pageSize, pageSize
+    default:
+        // Legacy limit behavior
+        if limitStr != "" {
+            if n, err := strconv.Atoi(limitStr); err == nil && n > 0 {
+                limit = n
+            }
+        }
+        if limit > maxPageSize { limit = maxPageSize }
+    }
+
+    // Cursors continue after the last hit of the previous page. They
+    // are bound to the data version so that a reload cannot make a
+    // client skip or repeat hits unnoticed, and to q, book and lang so
+    // that they cannot continue another search.
+    var after *hadith.Cursor
+    var version string
+    scope := hadith.SearchScope(q, hadith.SearchOptions{Lang: lang, Book: book})
+    if strings.TrimSpace(q) != "" {
+        v, err := s.repo.Version(r.Context())
+        if err != nil {
+            return nil, nil, err
+        }
+        version = v
+    }
+    if useCursor {
+        if version == "" {
+            return nil, nil, &apiError{Status: http.StatusBadRequest, Code: codeInvalidCursor, Message: "cursor needs a query (q)"}
+        }
+        c, err := s.tokens.Decode(cursorStr, version, scope)
+        if errors.Is(err, hadith.ErrStaleToken) {
+            return nil, nil, &apiError{Status: http.StatusGone, Code: codeStaleCursor, Message: err.Error() + "; start again without cursor"}
+        }
+        if err != nil {
+            return nil, nil, &apiError{Status: http.StatusBadRequest, Code: codeInvalidCursor, Message: err.Error()}
+        }
+        after = &c
+    }
+
+    // Build results: if query is empty, browse corpus; else run search.
+    var hits []hadith.Result
+    var total int
+    var next string // page token after hits, when there are more
+    if strings.TrimSpace(q) == "" {
+        // Browse mode: the hadiths of the selected book, or of every
+        // book by name, in number order. Only the page is fetched.
+        hadiths, n, err := hadith.PageAll(r.Context(), s.repo, book, offset, limit)
+        if err != nil {
+            return nil, nil, err
+        }
+        total = n
+        for _, h := range hadiths {
+            hits = append(hits, hadith.Result{Hadith: h, Score: 0})
+        }
+    } else {
+        var err error
+        // One hit more than asked for tells whether there is a next page.
+        hits, total, err = s.repo.Search(r.Context(), q, hadith.SearchOptions{Lang: lang, Book: book, Offset: offset, Limit: limit + 1, After: after})
+        if err != nil {
+            return nil, nil, queryError(err)
+        }
+        if len(hits) > limit {
+            hits = hits[:limit]
+            next = s.tokens.Encode(hadith.CursorOf(hits[limit-1]), version, scope)
+        }
+    }
+    if offset > total { offset = total }
+    for i := range hits {
+        hits[i].Hadith = hits[i].Hadith.In(lang)
+    }
+    if hits == nil {
+        hits = []hadith.Result{}
+    }
+
+    m := &meta{Total: total, NextCursor: next}
+    if next != "" {
+        w.Header().Set("X-Next-Cursor", next)
+        params := r.URL.Query()
+        for _, k := range []string{"offset", "page", "page_size"} {
+            params.Del(k)
+        }
+        params.Set("cursor", next)
+        params.Set("limit", strconv.Itoa(limit))
+        // The path as requested, which keeps a /v1 prefix.
+        path, _, _ := strings.Cut(r.RequestURI, "?")
+        w.Header().Set("Link", "<"+path+"?"+params.Encode()+">; rel=\"next\"")
+    }
+    switch {
+    case useCursor:
+        w.Header().Set("X-Total-Count", strconv.Itoa(total))
+        w.Header().Set("X-Limit", strconv.Itoa(limit))
+        m.Limit = &limit
+    case useOffset:
+        w.Header().Set("X-Total-Count", strconv.Itoa(total))
+        w.Header().Set("X-Offset", strconv.Itoa(offset))
+        w.Header().Set("X-Limit", strconv.Itoa(limit))
+        m.Offset, m.Limit = &offset, &limit
+    case usePagination:
+        // Pagination headers (body remains array for compatibility)
+        w.Header().Set("X-Total-Count", strconv.Itoa(total))
+        w.Header().Set("X-Page", strconv.Itoa(page))
+        w.Header().Set("X-Page-Size", strconv.Itoa(pageSize))
+        m.Page, m.PageSize = &page, &pageSize
+    default:
+        m.Limit = &limit
+    }
+    return hits, m, nil
+}
+
+// getHadith serves GET /hadith/{book}/{number}.
+func (s *server) getHadith(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+    parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/hadith/"), "/")
+    if len(parts) != 2 {
+        return nil, nil, invalidArgument("use /hadith/{book}/{number}")
+    }
+    num, err := strconv.Atoi(parts[1])
+    if err != nil {
+        return nil, nil, invalidArgument("invalid number")
+    }
+    lang, err := s.langParam(r)
+    if err != nil {
+        return nil, nil, err
+    }
+    h, ok, err := s.repo.Get(r.Context(), parts[0], num)
+    if err != nil {
+        return nil, nil, err
+    }
+    if !ok {
+        return nil, nil, notFound(fmt.Sprintf("no hadith %s #%d", parts[0], num))
+    }
+    return h.In(lang), nil, nil
+}
+
+// refParam is a reference in a batchGet request: {"book", "number"} or a
+// string such as "malik:12".
+type refParam struct {
+    hadith.Ref
+}
+
+func (p *refParam) UnmarshalJSON(b []byte) error {
+    var s string
+    if err := json.Unmarshal(b, &s); err == nil {
+        ref, err := hadith.ParseRef(s)
+        p.Ref = ref
+        return err
+    }
+    return json.Unmarshal(b, &p.Ref)
+}
+
+// batchItem is one result of batchGet. Hadith is omitted when not found.
+type batchItem struct {
+    Ref    string         `json:"ref"`
+    Found  bool           `json:"found"`
+    Hadith *hadith.Hadith `json:"hadith,omitempty"`
+}
+
+// batchGet serves POST /hadith:batchGet, which looks up many hadiths at
+// once: {"refs": [{"book": "malik", "number": 12}, "malik:13", ...]}. The
+// results are in request order, with found false for missing hadiths.
+func (s *server) batchGet(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        return nil, nil, &apiError{Status: http.StatusMethodNotAllowed, Code: codeMethodNotAllowed, Message: "use POST"}
+    }
+    lang, err := s.langParam(r)
+    if err != nil {
+        return nil, nil, err
+    }
+    var req struct {
+        Refs []json.RawMessage `json:"refs"`
+    }
+    if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&req); err != nil {
+        return nil, nil, invalidArgument("body: " + err.Error())
+    }
+    if max := s.cfg.API.MaxPageSize; len(req.Refs) > max {
+        return nil, nil, invalidArgument(fmt.Sprintf("at most %d refs per request", max))
+    }
+    refs := make([]hadith.Ref, len(req.Refs))
+    for i, raw := range req.Refs {
+        var p refParam
+        if err := json.Unmarshal(raw, &p); err != nil {
+            e := invalidArgument(fmt.Sprintf("refs[%d]: %v", i, err))
+            e.Details = map[string]int{"index": i}
+            return nil, nil, e
+        }
+        refs[i] = p.Ref
+    }
+    hadiths, found, err := s.repo.GetMany(r.Context(), refs)
+    if err != nil {
+        return nil, nil, err
+    }
+    items := make([]batchItem, len(refs))
+    for i, ref := range refs {
+        items[i] = batchItem{Ref: ref.String(), Found: found[i]}
+        if found[i] {
+            h := hadiths[i].In(lang)
+            items[i].Hadith = &h
+        }
+    }
+    return items, &meta{Total: len(items)}, nil
+}
+
+// resolveItem is one citation of a resolve request. Hadiths is empty when
+// none of its numbers exist.
+type resolveItem struct {
+    Ref     string          `json:"ref"`
+    Book    string          `json:"book"`
+    From    int             `json:"from"`
+    To      int             `json:"to"`
+    Found   bool            `json:"found"`
+    Hadiths []hadith.Hadith `json:"hadiths"`
+}
+
+// resolve serves GET /resolve?ref=, which reads a citation as written in
+// a text ("HR. Ad-Darimi no. 12", "Malik 10-15, 20") and returns the
+// hadiths it names, citation by citation.
+func (s *server) resolve(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+    q := r.URL.Query().Get("ref")
+    if strings.TrimSpace(q) == "" {
+        return nil, nil, invalidArgument("missing ref")
+    }
+    lang, err := s.langParam(r)
+    if err != nil {
+        return nil, nil, err
+    }
+    // Like a page, a response holds at most api.max_page_size hadiths.
+    matches, err := ref.Resolve(r.Context(), s.repo, q, s.cfg.API.MaxPageSize)
+    var syntaxErr *ref.SyntaxError
+    var bookErr *ref.UnknownBookError
+    var tooMany *ref.TooManyError
+    switch {
+    case errors.As(err, &syntaxErr):
+        return nil, nil, invalidArgument(err.Error())
+    case errors.As(err, &tooMany):
+        e := invalidArgument(err.Error())
+        e.Details = map[string]int{"count": tooMany.Count, "max": tooMany.Max}
+        return nil, nil, e
+    case errors.As(err, &bookErr):
+        e := notFound(err.Error())
+        e.Details = map[string]string{"book": bookErr.Name}
+        return nil, nil, e
+    case err != nil:
+        return nil, nil, err
+    }
+    items := make([]resolveItem, len(matches))
+    for i, m := range matches {
+        items[i] = resolveItem{Ref: m.String(), Book: m.Book, From: m.From, To: m.To, Found: len(m.Hadiths) > 0, Hadiths: make([]hadith.Hadith, len(m.Hadiths))}
+        for j, h := range m.Hadiths {
+            items[i].Hadiths[j] = h.In(lang)
+        }
+    }
+    return items, &meta{Total: len(items)}, nil
+}
+
+// export serves GET /export: the hadiths matching ?q=, or all of ?book=
+// or of every book, as a download in ?format= (ndjson by default).
+func (s *server) export(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+    name := r.URL.Query().Get("format")
+    if name == "" {
+        name = string(hadith.NDJSON)
+    }
+    format, err := hadith.ParseExportFormat(name)
+    if err != nil {
+        return nil, nil, invalidArgument(err.Error())
+    }
+    lang, err := s.langParam(r)
+    if err != nil {
+        return nil, nil, err
+    }
+    book := r.URL.Query().Get("book")
+    if book != "" {
+        if err := s.checkBook(r, book); err != nil {
+            return nil, nil, err
+        }
+    }
+    e, err := hadith.NewExport(r.Context(), s.repo, hadith.ExportOptions{Query: r.URL.Query().Get("q"), Book: book, Lang: lang})
+    if err != nil {
+        return nil, nil, queryError(err)
+    }
+    file := "hadiths"
+    if book != "" {
+        file = book
+    }
+    return body(func(w http.ResponseWriter) {
+        w.Header().Set("Content-Type", format.ContentType())
+        w.Header().Set("Content-Disposition", `attachment; filename="`+file+format.Ext()+`"`)
+        w.Header().Set("X-Total-Count", strconv.Itoa(e.Count))
+        if err := e.Encode(r.Context(), w, format); err != nil {
+            // The client went away or the data was reloaded
+            // mid-download; drop the connection.
+            panic(http.ErrAbortHandler)
+        }
+    }), nil, nil
+}
+
+// reload serves POST /admin/reload, which re-reads the books. It is only
+// mounted when api.admin_token is set and the backend can reload.
+func (s *server) reload(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+    if r.Method != http.MethodPost {
+        w.Header().Set("Allow", http.MethodPost)
+        return nil, nil, &apiError{Status: http.StatusMethodNotAllowed, Code: codeMethodNotAllowed, Message: "use POST"}
+    }
+    got := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+    if subtle.ConstantTimeCompare([]byte(got), []byte(s.cfg.API.AdminToken)) != 1 {
+        w.Header().Set("WWW-Authenticate", "Bearer")
+        return nil, nil, &apiError{Status: http.StatusUnauthorized, Code: codeUnauthorized, Message: "unauthorized"}
+    }
+    if err := s.reloader.Reload(); err != nil {
+        log.Printf("reload (admin): %v; still serving previous data", err)
+        return nil, nil, &apiError{Status: http.StatusInternalServerError, Code: codeReloadFailed, Message: err.Error()}
+    }
+    books, count := stats(s.repo)
+    log.Printf("reload (admin): %d books, %d hadiths", books, count)
+    return map[string]int{"books": books, "count": count}, nil, nil
+}
+
+// checkBook fails with not_found unless the dataset has book.
+func (s *server) checkBook(r *http.Request, book string) error {
+    infos, err := s.repo.Books(r.Context())
+    if err != nil {
+        return err
+    }
+    for _, b := range infos {
+        if b.Name == book {
+            return nil
+        }
+    }
+    return notFound(fmt.Sprintf("no book %q", book))
+}
+
+// queryError reports a malformed query as invalid_query, with the
+// position of the problem.
+func queryError(err error) error {
+    var syntaxErr *hadith.SyntaxError
+    if errors.As(err, &syntaxErr) {
+        return &apiError{Status: http.StatusBadRequest, Code: codeInvalidQuery, Message: err.Error(), Details: map[string]int{"position": syntaxErr.Pos}}
+    }
+    return err
+}
+
+// langParam reads the optional ?lang= translation selector and rejects
+// languages the dataset does not have.
+func (s *server) langParam(r *http.Request) (string, error) {
+    lang := strings.ToLower(r.URL.Query().Get("lang"))
+    if lang == "" {
+        return "", nil
+    }
+    langs, err := s.repo.Languages(r.Context())
+    if err != nil {
+        return "", err
+    }
+    for _, l := range langs {
+        if l == lang {
+            return lang, nil
+        }
+    }
+    return "", &apiError{
+        Status:  http.StatusBadRequest,
+        Code:    codeUnknownLanguage,
+        Message: "unknown lang " + strconv.Quote(lang) + "; available: " + strings.Join(langs, ", "),
+        Details: map[string][]string{"available": langs},
+    }
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+    "encoding/json"
+    "fmt"
+    "net/http"
+    "strings"
+    "testing"
+)
+
+func TestBatchGet(t *testing.T) {
+    h := testServer(t).handler()
+    resp := do(t, h, "POST", "/v1/hadith:batchGet", `{"refs": ["malik:3", {"book": "darimi", "number": 1}, "malik:999999", {"book": "bukhari", "number": 1}, "malik:3"]}`)
+    data, m, e := decodeEnvelope(t, resp)
+    if resp.StatusCode != http.StatusOK || e != nil {
+        t.Fatalf("status %d, error %+v", resp.StatusCode, e)
+    }
+    var items []batchItem
+    if err := json.Unmarshal(data, &items); err != nil {
+        t.Fatal(err)
+    }
+    // Request order, duplicates included, with found false and no hadith
+    // for the missing ones.
+    want := []struct {
+        ref   string
+        found bool
+    }{{"malik:3", true}, {"darimi:1", true}, {"malik:999999", false}, {"bukhari:1", false}, {"malik:3", true}}
+    if len(items) != len(want) || m == nil || m.Total != len(want) {
+        t.Fatalf("got %d items, meta %+v; want %d", len(items), m, len(want))
+    }
+    for i, w := range want {
+        it := items[i]
+        if it.Ref != w.ref || it.Found != w.found || (it.Hadith != nil) != w.found {
+            t.Errorf("item %d = %+v, want %s found=%v", i, it, w.ref, w.found)
+            continue
+        }
+        if w.found && fmt.Sprintf("%s:%d", it.Hadith.Book, it.Hadith.Number) != w.ref {
+            t.Errorf("item %d holds %s #%d", i, it.Hadith.Book, it.Hadith.Number)
+        }
+    }
+    if strings.Contains(string(data), `"hadith":null`) {
+        t.Error("missing hadiths are null rather than omitted")
+    }
+    // The legacy route returns the bare list.
+    resp = do(t, h, "POST", "/hadith:batchGet", `{"refs": ["malik:999999", "malik:1"]}`)
+    items = nil
+    if err := json.NewDecoder(resp.Body).Decode(&items); err != nil || len(items) != 2 || items[0].Found || !items[1].Found {
+        t.Errorf("legacy: %v, %+v", err, items)
+    }
+}
+
+func TestBatchGetErrors(t *testing.T) {
+    h := testServer(t).handler()
+    refs := make([]string, 201) // api.max_page_size is 200
+    for i := range refs {
+        refs[i] = fmt.Sprintf(`"malik:%d"`, i+1)
+    }
+    tests := []struct {
+        body    string
+        details string
+    }{
+        {`{"refs": [` + strings.Join(refs, ",") + `]}`, ""},
+        {`{"refs": ["malik:1", "malik"]}`, `{"index":1}`},
+        {`{"refs": ["malik:1", 12]}`, `{"index":1}`},
+        {`not json`, ""},
+    }
+    for _, tt := range tests {
+        resp := do(t, h, "POST", "/v1/hadith:batchGet", tt.body)
+        _, _, e := decodeEnvelope(t, resp)
+        if resp.StatusCode != http.StatusBadRequest || e == nil || e.Code != codeInvalidArgument {
+            t.Errorf("%.40s: %d, %+v", tt.body, resp.StatusCode, e)
+            continue
+        }
+        if details, _ := e.Details.(json.RawMessage); string(details) != tt.details {
+            t.Errorf("%.40s: details %s, want %s", tt.body, details, tt.details)
+        }
+    }
+    // Exactly the cap is fine.
+    resp := do(t, h, "POST", "/v1/hadith:batchGet", `{"refs": [`+strings.Join(refs[:200], ",")+`]}`)
+    if resp.StatusCode != http.StatusOK {
+        t.Errorf("200 refs: status %d", resp.StatusCode)
+    }
+}
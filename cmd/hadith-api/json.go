@@ -0,0 +1,126 @@
+package main
+
+import (
+    "bufio"
+    "encoding/json"
+    "net/http"
+    "reflect"
+    "strconv"
+)
+
+// writeJSON writes v as the response: compact, or indented when the
+// request asks for ?pretty=1. Lists, also as envelope data, are encoded an
+// element at a time, so a large page is never held in memory a second time
+// as JSON.
+func writeJSON(w http.ResponseWriter, r *http.Request, status int, v any) {
+    w.Header().Set("Content-Type", "application/json; charset=utf-8")
+    w.WriteHeader(status)
+    s := &jsonStream{w: bufio.NewWriter(w)}
+    if pretty, _ := strconv.ParseBool(r.URL.Query().Get("pretty")); pretty {
+        s.indent = "  "
+    }
+    s.value(v, "")
+    s.write("\n")
+    if s.err == nil {
+        s.err = s.w.Flush()
+    }
+    // An error here means the client went away; there is no one to tell.
+}
+
+// jsonStream writes the same bytes as json.Marshal (or MarshalIndent with
+// indent), but streams slices.
+type jsonStream struct {
+    w      *bufio.Writer
+    indent string
+    err    error
+}
+
+type jsonField struct {
+    key   string
+    value any
+}
+
+func (s *jsonStream) value(v any, prefix string) {
+    if e, ok := v.(envelope); ok {
+        // The fields of envelope, which are all omitempty.
+        var fields []jsonField
+        if e.Data != nil {
+            fields = append(fields, jsonField{"data", e.Data})
+        }
+        if e.Meta != nil {
+            fields = append(fields, jsonField{"meta", e.Meta})
+        }
+        if e.Error != nil {
+            fields = append(fields, jsonField{"error", e.Error})
+        }
+        s.object(fields, prefix)
+        return
+    }
+    if _, custom := v.(json.Marshaler); !custom {
+        if rv := reflect.ValueOf(v); rv.Kind() == reflect.Slice && !rv.IsNil() && rv.Type().Elem().Kind() != reflect.Uint8 {
+            s.array(rv, prefix)
+            return
+        }
+    }
+    var b []byte
+    var err error
+    if s.indent != "" {
+        b, err = json.MarshalIndent(v, prefix, s.indent)
+    } else {
+        b, err = json.Marshal(v)
+    }
+    if err != nil {
+        s.err = err
+        return
+    }
+    s.write(string(b))
+}
+
+func (s *jsonStream) object(fields []jsonField, prefix string) {
+    s.write("{")
+    inner := prefix + s.indent
+    for i, f := range fields {
+        if i > 0 {
+            s.write(",")
+        }
+        s.newline(inner)
+        s.write(strconv.Quote(f.key) + ":")
+        if s.indent != "" {
+            s.write(" ")
+        }
+        s.value(f.value, inner)
+    }
+    if len(fields) > 0 {
+        s.newline(prefix)
+    }
+    s.write("}")
+}
+
+func (s *jsonStream) array(rv reflect.Value, prefix string) {
+    s.write("[")
+    inner := prefix + s.indent
+    for i := 0; i < rv.Len(); i++ {
+        if i > 0 {
+            s.write(",")
+        }
+        s.newline(inner)
+        s.value(rv.Index(i).Interface(), inner)
+    }
+    if rv.Len() > 0 {
+        s.newline(prefix)
+    }
+    s.write("]")
+}
+
+// newline starts a line at prefix when indenting.
+func (s *jsonStream) newline(prefix string) {
+    if s.indent != "" {
+        s.write("\n" + prefix)
+    }
+}
+
+func (s *jsonStream) write(str string) {
+    if s.err == nil {
+        _, s.err = s.w.WriteString(str)
+    }
+}
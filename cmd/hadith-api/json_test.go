@@ -0,0 +1,102 @@
+package main
+
+import (
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+)
+
+func TestWriteJSON(t *testing.T) {
+    v := envelope{Data: []any{map[string]any{"a": 1}, []int{}, "x"}, Meta: &meta{Total: 3}}
+    for _, pretty := range []bool{false, true} {
+        target := "/"
+        want, _ := json.Marshal(v)
+        if pretty {
+            target = "/?pretty=1"
+            want, _ = json.MarshalIndent(v, "", "  ")
+        }
+        w := httptest.NewRecorder()
+        writeJSON(w, httptest.NewRequest("GET", target, nil), http.StatusTeapot, v)
+        if w.Code != http.StatusTeapot || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+            t.Errorf("pretty=%v: %d, %q", pretty, w.Code, w.Header().Get("Content-Type"))
+        }
+        if got := w.Body.String(); got != string(want)+"\n" {
+            t.Errorf("pretty=%v:\n%s\nwant\n%s", pretty, got, want)
+        }
+    }
+}
+
+func TestPrettyAndCompact(t *testing.T) {
+    h := testServer(t).handler()
+    compact := readBody(t, do(t, h, "GET", "/v1/books/malik/hadiths?limit=2", ""))
+    pretty := readBody(t, do(t, h, "GET", "/v1/books/malik/hadiths?limit=2&pretty=1", ""))
+    if strings.Count(compact, "\n") != 1 {
+        t.Errorf("compact response has %d lines", strings.Count(compact, "\n"))
+    }
+    if !strings.HasPrefix(pretty, "{\n  \"data\": [\n    {") {
+        t.Errorf("pretty response starts %.40q", pretty)
+    }
+    var a, b any
+    if err := json.Unmarshal([]byte(compact), &a); err != nil {
+        t.Fatal(err)
+    }
+    if err := json.Unmarshal([]byte(pretty), &b); err != nil {
+        t.Fatal(err)
+    }
+    ja, _ := json.Marshal(a)
+    jb, _ := json.Marshal(b)
+    if !bytes.Equal(ja, jb) {
+        t.Error("pretty and compact responses differ in content")
+    }
+}
+
+func TestGzip(t *testing.T) {
+    h := testServer(t).handler()
+    plain := do(t, h, "GET", "/v1/books/malik/hadiths?limit=20", "")
+    want := readBody(t, plain)
+    tests := []struct {
+        accept string
+        gzip   bool
+    }{
+        {"", false},
+        {"gzip", true},
+        {"deflate, gzip;q=0.5", true},
+        {"gzip;q=0", false},
+        {"*", true},
+        {"identity", false},
+    }
+    for _, tt := range tests {
+        resp := do(t, h, "GET", "/v1/books/malik/hadiths?limit=20", "", "Accept-Encoding: "+tt.accept)
+        if !strings.Contains(resp.Header.Get("Vary"), "Accept-Encoding") {
+            t.Errorf("%q: Vary = %q", tt.accept, resp.Header.Get("Vary"))
+        }
+        if got := resp.Header.Get("Content-Encoding") == "gzip"; got != tt.gzip {
+            t.Errorf("%q: gzipped %v, want %v", tt.accept, got, tt.gzip)
+            continue
+        }
+        body := resp.Body
+        if tt.gzip {
+            zr, err := gzip.NewReader(resp.Body)
+            if err != nil {
+                t.Fatal(err)
+            }
+            body = zr
+        }
+        got, err := io.ReadAll(body)
+        if err != nil || string(got) != want {
+            t.Errorf("%q: body differs (%v)", tt.accept, err)
+        }
+    }
+    // Errors are not compressed, nor are types gzip cannot shrink.
+    if resp := do(t, h, "GET", "/v1/hadith/malik/999999", "", "Accept-Encoding: gzip"); resp.Header.Get("Content-Encoding") != "" {
+        t.Error("error response gzipped")
+    }
+    if compressible("image/png") || !compressible("application/tei+xml") || !compressible("text/csv; charset=utf-8") {
+        t.Error("compressible misjudges a content type")
+    }
+}
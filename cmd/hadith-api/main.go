@@ -1,196 +1,168 @@
 package main
 
 import (
-    "encoding/json"
+    "context"
+    "flag"
     "log"
     "net/http"
     "os"
-    "path/filepath"
+    "os/signal"
     "strconv"
-    "strings"
-    "sort"
+    "syscall"
+    "time"
 
-    "github.com/nuzlilatief/hadith-go/internal/data"
-    "github.com/nuzlilatief/hadith-go/internal/search"
+    "github.com/nuzlilatief/hadith-go/internal/assets"
+    "github.com/nuzlilatief/hadith-go/internal/config"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
 )
 
 func main() {
     log.SetFlags(0)
-    root := findBooksRoot()
-    store, err := data.NewStore(filepath.Join(root, "books"))
+    flags := config.Register(flag.CommandLine, "books_dir", "strict", "store.backend", "api.addr")
+    flag.Parse()
+    cfg, err := flags.Load()
     if err != nil {
-        log.Fatalf("load books: %v", err)
+        log.Fatalf("config: %v", err)
     }
+    if ok, err := config.Command(cfg, flag.Args()); ok {
+        if err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+    cfg.SetupLogging()
+    // Strict refuses to start (or reload) with data that fails validation.
+    repo, from, err := assets.OpenRepository(cfg)
+    if err != nil {
+        log.Fatalf("open %s store: %v", cfg.Store.Backend, err)
+    }
+    count, err := repo.Count(context.Background())
+    if err != nil {
+        log.Fatalf("open %s store: %v", cfg.Store.Backend, err)
+    }
+    log.Printf("serving %d hadiths from %s", count, from)
+    srv := &server{
+        cfg:    cfg,
+        repo:   repo,
+        tokens: hadith.NewPageTokens([]byte(cfg.CursorSecret)),
+        boot:   strconv.FormatInt(time.Now().UnixNano(), 36),
+    }
+    if reloader, ok := repo.(hadith.Reloader); ok {
+        srv.reloader = reloader
+        startReloaders(repo, reloader, time.Duration(cfg.API.ReloadInterval))
+    }
+    addr := cfg.API.Addr
+    handler := srv.handler()
+    if tls := cfg.API.TLS; tls.Enabled() {
+        log.Printf("hadith API listening on %s (HTTPS)", addr)
+        log.Fatal(http.ListenAndServeTLS(addr, tls.CertFile, tls.KeyFile, handler))
+    }
+    log.Printf("hadith API listening on %s", addr)
+    log.Fatal(http.ListenAndServe(addr, handler))
+}
+
+// handler routes the API, the web UI and the spec, with CORS and gzip.
+func (s *server) handler() http.Handler {
     mux := http.NewServeMux()
-    // Static web UI (if web/ directory exists at repo root)
-    staticDir := filepath.Join(root, "web")
-    if st, err := os.Stat(staticDir); err == nil && st.IsDir() {
+    // Static web UI (web/ at repo root, else the embedded copy)
+    if web := assets.Web(); web != nil {
         // File server registered on "/". Explicit API routes below will take precedence.
-        mux.Handle("/", http.FileServer(http.Dir(staticDir)))
+        mux.Handle("/", http.FileServer(http.FS(web)))
     }
     // Serve OpenAPI spec at /openapi.yaml if present
-    specPath := filepath.Join(root, "api", "openapi.yaml")
-    if st, err := os.Stat(specPath); err == nil && !st.IsDir() {
+    if _, err := assets.Spec(); err == nil {
         mux.HandleFunc("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
-            http.ServeFile(w, r, specPath)
+            spec, err := assets.Spec()
+            if err != nil {
+                http.Error(w, err.Error(), http.StatusInternalServerError)
+                return
+            }
+            w.Header().Set("Content-Type", "application/yaml")
+            _, _ = w.Write(spec)
         })
     }
     mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
         w.WriteHeader(http.StatusOK)
         _, _ = w.Write([]byte("ok"))
     })
-    mux.HandleFunc("/books", func(w http.ResponseWriter, r *http.Request) {
-        writeJSON(w, http.StatusOK, store.Books())
-    })
-    mux.HandleFunc("/count", func(w http.ResponseWriter, r *http.Request) {
-        writeJSON(w, http.StatusOK, map[string]int{"count": store.Count()})
-    })
-    mux.HandleFunc("/search", func(w http.ResponseWriter, r *http.Request) {
-        q := r.URL.Query().Get("q")
-        book := r.URL.Query().Get("book")
-        // Back-compat: if page/page_size or offset not provided, honor legacy 'limit'.
-        limitStr := r.URL.Query().Get("limit")
-        pageStr := r.URL.Query().Get("page")
-        pageSizeStr := r.URL.Query().Get("page_size")
-        offsetStr := r.URL.Query().Get("offset")
-
-        // Choose mode precedence: offset/limit > page/page_size > legacy limit
-        useOffset := offsetStr != ""
-        usePagination := !useOffset && (pageStr != "" || pageSizeStr != "")
-
-        // Defaults and caps
-        const defaultPageSize = 50
-        const maxPageSize = 200
-
-        // Build base corpus (optionally filtered by book before search).
-        var corpus []data.Hadith
-        if book == "" {
-            corpus = store.All()
-        } else {
-            // Filter by book name exact match.
-            for _, h := range store.All() {
-                if h.Book == book {
-                    corpus = append(corpus, h)
-                }
-            }
-        }
-
-        // Build results: if query is empty, browse corpus; else run search.
-        var hits []search.Result
-        if strings.TrimSpace(q) == "" {
-            // Browse mode: list all hadiths in (optionally) selected book
-            hits = make([]search.Result, 0, len(corpus))
-            for _, h := range corpus {
-                hits = append(hits, search.Result{Hadith: h, Score: 0})
-            }
-            sort.Slice(hits, func(i, j int) bool {
-                if hits[i].Hadith.Book != hits[j].Hadith.Book {
-                    return hits[i].Hadith.Book < hits[j].Hadith.Book
-                }
-                return hits[i].Hadith.Number < hits[j].Hadith.Number
-            })
-        } else {
-            // Search without cap to allow pagination afterwards.
-            hits = search.Search(corpus, q, 0)
-        }
-
-        if useOffset {
-            // Offset/limit style pagination for compatibility with some clients
-            offset := 0
-            if n, err := strconv.Atoi(offsetStr); err == nil && n >= 0 {
-                offset = n
-            }
-            lim := defaultPageSize
-            if limitStr != "" {
-                if n, err := strconv.Atoi(limitStr); err == nil && n > 0 {
-                    lim = n
-                }
-            }
-            if lim > maxPageSize { lim = maxPageSize }
-            total := len(hits)
-            if offset > total { offset = total }
-            end := offset + lim
-            if end > total { end = total }
-            w.Header().Set("X-Total-Count", strconv.Itoa(total))
-            w.Header().Set("X-Offset", strconv.Itoa(offset))
-            w.Header().Set("X-Limit", strconv.Itoa(lim))
-            writeJSON(w, http.StatusOK, hits[offset:end])
-            return
-        }
-
-        if usePagination {
-            // Parse pagination params
-            page := 1
-            if pageStr != "" {
-                if n, err := strconv.Atoi(pageStr); err == nil && n > 0 {
-                    page = n
-                }
-            }
-            pageSize := defaultPageSize
-            if pageSizeStr != "" {
-                if n, err := strconv.Atoi(pageSizeStr); err == nil && n > 0 {
-                    pageSize = n
-                }
-            }
-            if pageSize > maxPageSize { pageSize = maxPageSize }
-            total := len(hits)
-            start := (page - 1) * pageSize
-            if start < 0 { start = 0 }
-            if start > total { start = total }
-            end := start + pageSize
-            if end > total { end = total }
-
-            // Pagination headers (body remains array for compatibility)
-            w.Header().Set("X-Total-Count", strconv.Itoa(total))
-            w.Header().Set("X-Page", strconv.Itoa(page))
-            w.Header().Set("X-Page-Size", strconv.Itoa(pageSize))
-            writeJSON(w, http.StatusOK, hits[start:end])
-            return
-        }
+    // Every endpoint is served under /v1 with the JSON envelope and, as
+    // before versioning, at the bare path.
+    routes := map[string]handler{
+        "/books":   s.books,
+        "/books/":  s.book,
+        "/count":   s.count,
+        "/search":  s.search,
+        "/hadith/": s.getHadith,
+        "/export":  s.export,
+        "/resolve": s.resolve,
+        // POST, a custom method in the style of Google APIs (AIP-136).
+        "/hadith:batchGet": s.batchGet,
+    }
+    for path, h := range routes {
+        mux.Handle(path, s.cached(legacy(h)))
+        // Validators are computed outside StripPrefix, so that the two
+        // representations of an endpoint have different tags.
+        mux.Handle("/v1"+path, s.cached(http.StripPrefix("/v1", v1(h))))
+    }
+    // POST /admin/reload re-reads books/; enabled only when api.admin_token
+    // is set and the backend can reload.
+    if s.cfg.API.AdminToken != "" && s.reloader != nil {
+        mux.Handle("/admin/reload", legacy(s.reload))
+        mux.Handle("/v1/admin/reload", http.StripPrefix("/v1", v1(s.reload)))
+    }
+    mux.Handle("/v1/", v1(func(w http.ResponseWriter, r *http.Request) (any, *meta, error) {
+        return nil, nil, notFound("no such endpoint: " + r.URL.Path)
+    }))
+    return cors(s.cfg, compress(mux))
+}
 
-        // Legacy limit behavior
-        limit := defaultPageSize
-        if limitStr != "" {
-            if n, err := strconv.Atoi(limitStr); err == nil && n > 0 {
-                limit = n
+// startReloaders reloads the store on SIGHUP and, when interval is not
+// zero, whenever the books directory changes. A failed reload is logged and
+// the previous data keeps being served.
+func startReloaders(repo hadith.Repository, store hadith.Reloader, interval time.Duration) {
+    report := func(source string) func(error) {
+        return func(err error) {
+            if err != nil {
+                log.Printf("reload (%s): %v; still serving previous data", source, err)
+                return
             }
+            books, count := stats(repo)
+            log.Printf("reload (%s): %d books, %d hadiths", source, books, count)
         }
-        if limit > maxPageSize { limit = maxPageSize }
-        if limit > 0 && len(hits) > limit {
-            hits = hits[:limit]
-        }
-        writeJSON(w, http.StatusOK, hits)
-    })
-    mux.HandleFunc("/hadith/", func(w http.ResponseWriter, r *http.Request) {
-        // /hadith/{book}/{number}
-        parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/hadith/"), "/")
-        if len(parts) != 2 {
-            http.Error(w, "use /hadith/{book}/{number}", http.StatusBadRequest)
-            return
-        }
-        num, err := strconv.Atoi(parts[1])
-        if err != nil {
-            http.Error(w, "invalid number", http.StatusBadRequest)
-            return
-        }
-        h, ok := store.Get(parts[0], num)
-        if !ok {
-            http.NotFound(w, r)
-            return
+    }
+    hup := make(chan os.Signal, 1)
+    signal.Notify(hup, syscall.SIGHUP)
+    go func() {
+        for range hup {
+            report("SIGHUP")(store.Reload())
         }
-        writeJSON(w, http.StatusOK, h)
-    })
+    }()
+    if interval > 0 {
+        go store.Watch(context.Background(), interval, report("watch"))
+        log.Printf("watching books for changes every %s", interval)
+    }
+}
 
-    addr := envOr("ADDR", ":8080")
-    log.Printf("hadith API listening on %s", addr)
-    log.Fatal(http.ListenAndServe(addr, cors(mux)))
+// stats returns the number of books and hadiths, for log messages.
+func stats(repo hadith.Repository) (books, count int) {
+    infos, _ := repo.Books(context.Background())
+    count, _ = repo.Count(context.Background())
+    return len(infos), count
 }
 
-func cors(next http.Handler) http.Handler {
+// cors allows the origins in api.cors_origins.
+func cors(cfg *config.Config, next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-        w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+        if allow := cfg.AllowOrigin(r.Header.Get("Origin")); allow != "" {
+            w.Header().Set("Access-Control-Allow-Origin", allow)
+            if allow != "*" {
+                w.Header().Add("Vary", "Origin")
+            }
+        }
+        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, If-None-Match, If-Modified-Since")
+        w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+        // Let scripts on other origins read the pagination headers.
+        w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Offset, X-Limit, X-Page, X-Page-Size, X-Next-Cursor, Link, ETag, Last-Modified")
         if r.Method == http.MethodOptions {
             w.WriteHeader(http.StatusNoContent)
             return
@@ -198,34 +170,3 @@ func cors(next http.Handler) http.Handler {
         next.ServeHTTP(w, r)
     })
 }
-
-func writeJSON(w http.ResponseWriter, status int, v any) {
-    w.Header().Set("Content-Type", "application/json; charset=utf-8")
-    w.WriteHeader(status)
-    enc := json.NewEncoder(w)
-    enc.SetIndent("", "  ")
-    _ = enc.Encode(v)
-}
-
-func envOr(k, def string) string {
-    if v := os.Getenv(k); v != "" {
-        return v
-    }
-    return def
-}
-
-// findBooksRoot walks up from CWD to find a directory containing a "books" folder.
-func findBooksRoot() string {
-    dir, _ := os.Getwd()
-    for i := 0; i < 5; i++ { // up to 5 levels
-        if st, err := os.Stat(filepath.Join(dir, "books")); err == nil && st.IsDir() {
-            return dir
-        }
-        parent := filepath.Dir(dir)
-        if parent == dir {
-            break
-        }
-        dir = parent
-    }
-    return "."
-}
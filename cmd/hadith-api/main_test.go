@@ -0,0 +1,58 @@
+package main
+
+import (
+    "io"
+    "net/http"
+    "net/http/httptest"
+    "strings"
+    "testing"
+
+    "github.com/nuzlilatief/hadith-go/internal/config"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+)
+
+// testServer serves the bundled books with the default settings and a
+// fixed cursor key.
+func testServer(t *testing.T) *server {
+    t.Helper()
+    store, err := hadith.Open("../../books", hadith.Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return storeServer(store)
+}
+
+// storeServer is testServer serving store.
+func storeServer(store *hadith.Store) *server {
+    cfg := config.Default()
+    cfg.CursorSecret = "test"
+    return &server{cfg: cfg, repo: hadith.Memory(store), tokens: hadith.NewPageTokens([]byte(cfg.CursorSecret)), boot: "boot"}
+}
+
+// do sends a request with the given headers ("Name: value") to h and
+// returns the response.
+func do(t *testing.T, h http.Handler, method, target, body string, headers ...string) *http.Response {
+    t.Helper()
+    var rd io.Reader
+    if body != "" {
+        rd = strings.NewReader(body)
+    }
+    r := httptest.NewRequest(method, target, rd)
+    for _, kv := range headers {
+        k, v, _ := strings.Cut(kv, ":")
+        r.Header.Set(k, strings.TrimSpace(v))
+    }
+    w := httptest.NewRecorder()
+    h.ServeHTTP(w, r)
+    return w.Result()
+}
+
+// readBody returns the body of resp.
+func readBody(t *testing.T, resp *http.Response) string {
+    t.Helper()
+    b, err := io.ReadAll(resp.Body)
+    if err != nil {
+        t.Fatal(err)
+    }
+    return string(b)
+}
@@ -1,104 +1,482 @@
 package main
 
 import (
+    "context"
     "encoding/json"
+    "errors"
     "flag"
     "fmt"
     "log"
     "os"
     "path/filepath"
+    "sort"
     "strconv"
     "strings"
 
-    "github.com/nuzlilatief/hadith-go/internal/data"
-    "github.com/nuzlilatief/hadith-go/internal/search"
+    "github.com/nuzlilatief/hadith-go/internal/assets"
+    "github.com/nuzlilatief/hadith-go/internal/config"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith/ref"
 )
 
 func usage() {
-    fmt.Fprintf(os.Stderr, "hadith-cli usage:\n")
-    fmt.Fprintf(os.Stderr, "  hadith-cli books\n")
+    fmt.Fprintf(os.Stderr, "hadith-cli usage (global flags before the subcommand: -config FILE, -books-dir DIR, -strict, -backend memory|sqlite, -set key=value):\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli books [-v]\n")
     fmt.Fprintf(os.Stderr, "  hadith-cli count\n")
-    fmt.Fprintf(os.Stderr, "  hadith-cli get <book> <number>\n")
-    fmt.Fprintf(os.Stderr, "  hadith-cli search [-limit N] <query>\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli get [-lang L] <book> <number|from-to>\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli get [-lang L] <citation>   e.g. \"Muwatta Malik 12\", \"HR. Darimi no. 5-7\"\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli chapters <book> [n]\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli search [-limit N] [-lang L] [-color=false] <query>\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli export [-format ndjson|csv|md|xml] [-book B] [-lang L] [-out FILE] [query]\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli validate [-strict] [books-dir]\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli db build [-o FILE]\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli index build\n")
+    fmt.Fprintf(os.Stderr, "  hadith-cli config print\n")
+    fmt.Fprintf(os.Stderr, "\nQuery syntax: words, \"phrases\", book:NAME, arab:/id:WORD, number:A..B, AND/OR/NOT, ( )\n")
 }
 
 func main() {
     log.SetFlags(0)
-    if len(os.Args) < 2 {
+    flag.Usage = usage
+    flags := config.Register(flag.CommandLine, "books_dir", "strict", "store.backend")
+    flag.Parse()
+    args := flag.Args()
+    if len(args) < 1 {
         usage()
         os.Exit(2)
     }
-    cmd := os.Args[1]
-    // locate books directory relative to working directory by default
-    root := findBooksRoot()
-    store, err := data.NewStore(filepath.Join(root, "books"))
+    cfg, err := flags.Load()
     if err != nil {
-        log.Fatalf("load books: %v", err)
+        log.Fatalf("config: %v", err)
+    }
+    if ok, err := config.Command(cfg, args); ok {
+        if err != nil {
+            log.Fatal(err)
+        }
+        return
     }
+    cmd := args[0]
+    if cmd == "validate" {
+        // Runs before loading so that it can report on data the loader rejects.
+        validate(cfg.BooksDir, args[1:])
+        return
+    }
+    if cmd == "db" {
+        buildDB(cfg, args[1:])
+        return
+    }
+    if cmd == "index" {
+        buildSnapshot(cfg, args[1:])
+        return
+    }
+    repo, _, err := assets.OpenRepository(cfg)
+    if err != nil {
+        log.Fatalf("open %s store: %v", cfg.Store.Backend, err)
+    }
+    defer repo.Close()
+    ctx := context.Background()
     switch cmd {
     case "books":
-        for _, b := range store.Books() {
-            fmt.Println(b)
+        fs := flag.NewFlagSet("books", flag.ExitOnError)
+        verbose := fs.Bool("v", false, "print display names, provenance and licensing")
+        _ = fs.Parse(args[1:])
+        books, err := repo.Books(ctx)
+        if err != nil {
+            log.Fatal(err)
+        }
+        for _, b := range books {
+            if *verbose {
+                printBookInfo(b)
+            } else {
+                fmt.Println(b.Name)
+            }
         }
     case "count":
-        fmt.Println(store.Count())
+        n, err := repo.Count(ctx)
+        if err != nil {
+            log.Fatal(err)
+        }
+        fmt.Println(n)
     case "get":
-        if len(os.Args) < 4 {
+        fs := flag.NewFlagSet("get", flag.ExitOnError)
+        lang := fs.String("lang", "", "only include the translation in this language (e.g. id, en)")
+        _ = fs.Parse(args[1:])
+        if fs.NArg() < 1 {
             usage()
             os.Exit(2)
         }
-        book := os.Args[2]
-        n, err := strconv.Atoi(os.Args[3])
+        checkLang(ctx, repo, *lang)
+        enc := json.NewEncoder(os.Stdout)
+        enc.SetIndent("", "  ")
+        if fs.NArg() != 2 || strings.Trim(fs.Arg(1), "0123456789-") != "" || !isBook(ctx, repo, fs.Arg(0)) {
+            // Anything but <book> <number|from-to> with the file name of a
+            // loaded book is a citation as written in a text: "Malik 12",
+            // "HR. Ad-Darimi no. 5-7, 9".
+            getCitation(ctx, repo, strings.Join(fs.Args(), " "), *lang, cfg.API.MaxPageSize, enc)
+            return
+        }
+        book := fs.Arg(0)
+        if from, to, ok := strings.Cut(fs.Arg(1), "-"); ok {
+            // A range prints a JSON array of the hadiths in it.
+            a, err1 := strconv.Atoi(from)
+            b, err2 := strconv.Atoi(to)
+            if err1 != nil || err2 != nil || a < 1 || b < a {
+                log.Fatalf("invalid range %q, want FROM-TO", fs.Arg(1))
+            }
+            if max := cfg.API.MaxPageSize; b-a+1 > max {
+                log.Printf("showing the first %d hadiths of %s #%d–#%d (api.max_page_size)", max, book, a, b)
+                b = a + max - 1
+            }
+            hadiths, err := repo.Browse(ctx, book, a, b)
+            if err != nil {
+                log.Fatal(err)
+            }
+            if len(hadiths) == 0 {
+                log.Fatalf("not found: %s #%d–#%d", book, a, b)
+            }
+            for i := range hadiths {
+                hadiths[i] = hadiths[i].In(*lang)
+            }
+            _ = enc.Encode(hadiths)
+            return
+        }
+        n, err := strconv.Atoi(fs.Arg(1))
         if err != nil {
             log.Fatalf("invalid number: %v", err)
         }
-        h, ok := store.Get(book, n)
+        h, ok, err := repo.Get(ctx, book, n)
+        if err != nil {
+            log.Fatal(err)
+        }
         if !ok {
             log.Fatalf("not found: %s #%d", book, n)
         }
-        enc := json.NewEncoder(os.Stdout)
-        enc.SetIndent("", "  ")
-        _ = enc.Encode(h)
+        _ = enc.Encode(h.In(*lang))
+    case "chapters":
+        if len(args) < 2 {
+            usage()
+            os.Exit(2)
+        }
+        book := args[1]
+        if len(args) < 3 {
+            chapters, err := repo.Chapters(ctx, book)
+            if err != nil {
+                log.Fatal(err)
+            }
+            if len(chapters) == 0 {
+                log.Fatalf("no chapter metadata for %s", book)
+            }
+            for _, c := range chapters {
+                fmt.Printf("%3d. %s (#%d–#%d, %d hadith)\n", c.Number, chapterTitle(c.Kitab, c.Bab), c.First, c.Last, c.Count)
+            }
+            return
+        }
+        n, err := strconv.Atoi(args[2])
+        if err != nil {
+            log.Fatalf("invalid chapter number: %v", err)
+        }
+        c, hadiths, ok, err := repo.Chapter(ctx, book, n)
+        if err != nil {
+            log.Fatal(err)
+        }
+        if !ok {
+            log.Fatalf("not found: %s chapter %d", book, n)
+        }
+        fmt.Printf("%s\n\n", chapterTitle(c.Kitab, c.Bab))
+        for _, h := range hadiths {
+            fmt.Printf("%s #%d%s\n", h.Book, h.Number, gradeSuffix(h.Grade))
+            fmt.Printf("ID: %s\n", excerpt(h.ID, nil, false))
+            fmt.Printf("AR: %s\n\n", excerpt(h.Arab, nil, false))
+        }
     case "search":
         fs := flag.NewFlagSet("search", flag.ExitOnError)
         limit := fs.Int("limit", 20, "max results")
-        _ = fs.Parse(os.Args[2:])
-        q := strings.Join(fs.Args(), " ")
-        results := search.SimpleSearch(store.All(), q, *limit)
+        color := fs.Bool("color", isTerminal(os.Stdout), "highlight matches with ANSI colors")
+        lang := fs.String("lang", hadith.DefaultLang, "translation to search and print (e.g. id, en)")
+        _ = fs.Parse(args[1:])
+        checkLang(ctx, repo, *lang)
+        query := strings.Join(fs.Args(), " ")
+        if strings.TrimSpace(query) == "" {
+            usage()
+            os.Exit(2)
+        }
+        results, _, err := repo.Search(ctx, query, hadith.SearchOptions{Lang: *lang, Limit: *limit})
+        var syntaxErr *hadith.SyntaxError
+        if errors.As(err, &syntaxErr) {
+            log.Fatalf("invalid query: %v", err)
+        }
+        if err != nil {
+            log.Fatal(err)
+        }
         for _, r := range results {
-            fmt.Printf("%s #%d [score %d]\n", r.Hadith.Book, r.Hadith.Number, r.Score)
-            // print Indonesian translation first for readability
-            fmt.Printf("ID: %s\n", oneLine(r.Hadith.ID))
-            fmt.Printf("AR: %s\n\n", oneLine(r.Hadith.Arab))
+            fmt.Printf("%s #%d [score %.2f]%s\n", r.Hadith.Book, r.Hadith.Number, r.Score, gradeSuffix(r.Hadith.Grade))
+            if r.Hadith.Kitab != "" || r.Hadith.Bab != "" {
+                fmt.Printf("In: %s\n", chapterTitle(r.Hadith.Kitab, r.Hadith.Bab))
+            }
+            // print the translation first for readability
+            fmt.Printf("%s: %s\n", strings.ToUpper(*lang), excerpt(r.Hadith.Text(*lang), r.Matches[*lang], *color))
+            fmt.Printf("AR: %s\n\n", excerpt(r.Hadith.Arab, r.Matches["arab"], *color))
         }
+    case "export":
+        export(ctx, repo, args[1:])
     default:
         usage()
         os.Exit(2)
     }
 }
 
-func oneLine(s string) string {
-    s = strings.ReplaceAll(s, "\n", " ")
-    s = strings.TrimSpace(s)
-    if len(s) > 240 {
-        return s[:240] + "…"
+// export writes the hadiths matching a query, or whole books, to stdout or
+// a file. The format defaults to the one named by the file's extension.
+func export(ctx context.Context, repo hadith.Repository, args []string) {
+    fs := flag.NewFlagSet("export", flag.ExitOnError)
+    formatName := fs.String("format", "", "ndjson, csv, md or xml (default from -out, else ndjson)")
+    book := fs.String("book", "", "only hadiths from this book")
+    lang := fs.String("lang", "", "only include the translation in this language (e.g. id, en)")
+    out := fs.String("out", "", "write to this file instead of stdout")
+    _ = fs.Parse(args)
+    checkLang(ctx, repo, *lang)
+    name := *formatName
+    if name == "" {
+        name = string(hadith.NDJSON)
+        for _, f := range hadith.ExportFormats {
+            if strings.EqualFold(filepath.Ext(*out), f.Ext()) {
+                name = string(f)
+            }
+        }
+    }
+    format, err := hadith.ParseExportFormat(name)
+    if err != nil {
+        log.Fatal(err)
+    }
+    e, err := hadith.NewExport(ctx, repo, hadith.ExportOptions{Query: strings.Join(fs.Args(), " "), Book: *book, Lang: *lang})
+    var syntaxErr *hadith.SyntaxError
+    if errors.As(err, &syntaxErr) {
+        log.Fatalf("invalid query: %v", err)
+    }
+    if err != nil {
+        log.Fatal(err)
     }
-    return s
+    if e.Count == 0 && *book != "" && len(e.Books) == 0 && fs.NArg() == 0 {
+        log.Fatalf("not found: %s", *book)
+    }
+    if *out == "" {
+        if err := e.Encode(ctx, os.Stdout, format); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+    f, err := os.Create(*out)
+    if err != nil {
+        log.Fatal(err)
+    }
+    if err := e.Encode(ctx, f, format); err != nil {
+        f.Close()
+        log.Fatalf("export: %v", err)
+    }
+    if err := f.Close(); err != nil {
+        log.Fatalf("export: %v", err)
+    }
+    log.Printf("exported %d hadiths (dataset %s) to %s", e.Count, e.Version, *out)
 }
 
-// findBooksRoot walks up from CWD to find a directory containing a "books" folder.
-func findBooksRoot() string {
-    dir, _ := os.Getwd()
-    for i := 0; i < 5; i++ { // up to 5 levels
-        if st, err := os.Stat(filepath.Join(dir, "books")); err == nil && st.IsDir() {
-            return dir
+// isBook reports whether name is the file name of a loaded book.
+func isBook(ctx context.Context, repo hadith.Repository, name string) bool {
+    books, err := repo.Books(ctx)
+    if err != nil {
+        log.Fatal(err)
+    }
+    for _, b := range books {
+        if b.Name == name {
+            return true
         }
-        parent := filepath.Dir(dir)
-        if parent == dir {
-            break
+    }
+    return false
+}
+
+// getCitation prints the hadiths citation names, at most max of them: an
+// object for a single hadith, like get <book> <number>, and an array
+// otherwise.
+func getCitation(ctx context.Context, repo hadith.Repository, citation, lang string, max int, enc *json.Encoder) {
+    books, err := repo.Books(ctx)
+    if err != nil {
+        log.Fatal(err)
+    }
+    citations, err := ref.NewResolver(books).Parse(citation)
+    if err != nil {
+        log.Fatal(err)
+    }
+    if cut, clamped := ref.Clamp(citations, max); clamped {
+        last := cut[len(cut)-1]
+        log.Printf("showing the first %d hadiths cited, up to %s (api.max_page_size)", max, last)
+        citations = cut
+    }
+    matches, err := ref.Lookup(ctx, repo, citations)
+    if err != nil {
+        log.Fatal(err)
+    }
+    var hadiths []hadith.Hadith
+    for _, m := range matches {
+        for _, h := range m.Hadiths {
+            hadiths = append(hadiths, h.In(lang))
+        }
+    }
+    if len(hadiths) == 0 {
+        log.Fatalf("not found: %s", citation)
+    }
+    if len(matches) == 1 && matches[0].From == matches[0].To {
+        _ = enc.Encode(hadiths[0])
+        return
+    }
+    _ = enc.Encode(hadiths)
+}
+
+// validate reports every problem in the books and exits non-zero when there
+// are errors, or any problem at all with -strict.
+func validate(booksDir string, args []string) {
+    fs := flag.NewFlagSet("validate", flag.ExitOnError)
+    strict := fs.Bool("strict", false, "fail on warnings too (gaps, HTML remnants, stray whitespace)")
+    _ = fs.Parse(args)
+    if fs.NArg() > 0 {
+        booksDir = fs.Arg(0)
+    }
+    dir, embedded := assets.Books(booksDir)
+    var problems []hadith.Problem
+    var err error
+    prefix := ""
+    if embedded != nil {
+        problems, err = hadith.ValidateFS(embedded)
+    } else {
+        problems, err = hadith.Validate(dir)
+        prefix = dir + string(filepath.Separator)
+    }
+    if err != nil {
+        log.Fatalf("validate: %v", err)
+    }
+    errs := 0
+    for _, p := range problems {
+        if !p.Warning {
+            errs++
         }
-        dir = parent
+        fmt.Printf("%s%s\n", prefix, p)
     }
-    return "."
+    warns := len(problems) - errs
+    fmt.Fprintf(os.Stderr, "%d error(s), %d warning(s)\n", errs, warns)
+    if errs > 0 || (*strict && warns > 0) {
+        os.Exit(1)
+    }
+}
+
+// buildDB loads the books and writes them to an SQLite database for
+// store.backend sqlite.
+func buildDB(cfg *config.Config, args []string) {
+    if len(args) < 1 || args[0] != "build" {
+        usage()
+        os.Exit(2)
+    }
+    fs := flag.NewFlagSet("db build", flag.ExitOnError)
+    out := fs.String("o", cfg.Store.Path, "database file to write")
+    _ = fs.Parse(args[1:])
+    store, err := assets.OpenStore(cfg.BooksDir, hadith.Options{Strict: cfg.Strict})
+    if err != nil {
+        log.Fatalf("load books: %v", err)
+    }
+    if err := hadith.WriteSQLite(store, *out); err != nil {
+        log.Fatalf("db build: %v", err)
+    }
+    fmt.Fprintf(os.Stderr, "wrote %d hadiths from %s to %s\n", store.Count(), assets.Describe(cfg.BooksDir), *out)
+}
+
+// buildSnapshot writes the precompiled snapshot into the books directory,
+// where later runs load it instead of the book files.
+func buildSnapshot(cfg *config.Config, args []string) {
+    if len(args) != 1 || args[0] != "build" {
+        usage()
+        os.Exit(2)
+    }
+    dir, fsys := assets.Books(cfg.BooksDir)
+    if fsys != nil {
+        log.Fatalf("index build: the books are embedded; set -books-dir to a directory")
+    }
+    n, err := hadith.BuildSnapshot(dir)
+    if err != nil {
+        log.Fatalf("index build: %v", err)
+    }
+    fmt.Fprintf(os.Stderr, "wrote %d hadiths to %s\n", n, filepath.Join(dir, hadith.SnapshotFile))
+}
+
+func printBookInfo(b hadith.BookInfo) {
+    fmt.Printf("%s — %s\n", b.Name, b.DisplayName(hadith.DefaultLang))
+    langs := make([]string, 0, len(b.Names))
+    for l := range b.Names {
+        langs = append(langs, l)
+    }
+    sort.Strings(langs)
+    for _, l := range langs {
+        fmt.Printf("  name (%s): %s\n", l, b.Names[l])
+    }
+    for _, f := range []struct{ label, value string }{
+        {"author", b.Author},
+        {"compiled", b.Compiled},
+        {"source", b.SourceURL},
+        {"license", b.License},
+    } {
+        if f.value != "" {
+            fmt.Printf("  %s: %s\n", f.label, f.value)
+        }
+    }
+    fmt.Printf("  hadiths: %d\n", b.Count)
+    fmt.Printf("  languages: %s\n\n", strings.Join(b.Languages, ", "))
+}
+
+// checkLang exits with an error when lang is set but not in the dataset.
+func checkLang(ctx context.Context, repo hadith.Repository, lang string) {
+    if lang == "" {
+        return
+    }
+    langs, err := repo.Languages(ctx)
+    if err != nil {
+        log.Fatal(err)
+    }
+    for _, l := range langs {
+        if l == lang {
+            return
+        }
+    }
+    log.Fatalf("unknown lang %q; available: %s", lang, strings.Join(langs, ", "))
+}
+
+// chapterTitle joins kitab and bab as "Kitab › Bab", skipping empty parts.
+func chapterTitle(kitab, bab string) string {
+    switch {
+    case kitab == "":
+        return bab
+    case bab == "":
+        return kitab
+    }
+    return kitab + " › " + bab
+}
+
+// gradeSuffix formats an optional grade for a result header.
+func gradeSuffix(grade string) string {
+    if grade == "" {
+        return ""
+    }
+    return " (" + grade + ")"
+}
+
+// excerpt returns a one-line window of up to 240 characters of s around its
+// matches, highlighted in bold red when color is set.
+func excerpt(s string, spans []hadith.Span, color bool) string {
+    snip, marks := hadith.Snippet(s, spans, 240)
+    if !color {
+        return snip
+    }
+    return hadith.Mark(snip, marks, "\x1b[1;31m", "\x1b[0m")
+}
+
+// isTerminal reports whether f is a character device, i.e. not a pipe or file.
+func isTerminal(f *os.File) bool {
+    st, err := f.Stat()
+    return err == nil && st.Mode()&os.ModeCharDevice != 0
 }
 
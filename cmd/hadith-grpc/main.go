@@ -4,100 +4,259 @@ package main
 
 import (
     "context"
+    "errors"
+    "flag"
     "log"
     "net"
-    "os"
-    "path/filepath"
+    "strings"
 
     "google.golang.org/grpc"
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/credentials"
+    "google.golang.org/grpc/status"
 
     "github.com/nuzlilatief/hadith-go/api/gen/go/hadithpb"
-    "github.com/nuzlilatief/hadith-go/internal/data"
+    "github.com/nuzlilatief/hadith-go/internal/assets"
+    "github.com/nuzlilatief/hadith-go/internal/config"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
 )
 
 type server struct{
     hadithpb.UnimplementedHadithServiceServer
-    store *data.Store
+    repo   hadith.Repository
+    tokens *hadith.PageTokens
+    // maxPageSize caps the hadiths of a Browse or Search response and the
+    // refs of a BatchGetHadith request (api.max_page_size).
+    maxPageSize int
 }
 
 func (s *server) ListBooks(ctx context.Context, _ *hadithpb.ListBooksRequest) (*hadithpb.ListBooksResponse, error) {
-    return &hadithpb.ListBooksResponse{Books: s.store.Books()}, nil
+    infos, err := s.repo.Books(ctx)
+    if err != nil {
+        return nil, internal(err)
+    }
+    names := make([]string, len(infos))
+    for i, b := range infos {
+        names[i] = b.Name
+    }
+    return &hadithpb.ListBooksResponse{Books: names}, nil
 }
 
 func (s *server) GetHadith(ctx context.Context, req *hadithpb.GetHadithRequest) (*hadithpb.GetHadithResponse, error) {
-    h, ok := s.store.Get(req.GetBook(), int(req.GetNumber()))
+    if err := s.checkLang(ctx, req.GetLang()); err != nil {
+        return nil, err
+    }
+    h, ok, err := s.repo.Get(ctx, req.GetBook(), int(req.GetNumber()))
+    if err != nil {
+        return nil, internal(err)
+    }
     if !ok {
         return &hadithpb.GetHadithResponse{}, nil
     }
-    return &hadithpb.GetHadithResponse{Hadith: &hadithpb.Hadith{Book: h.Book, Number: int32(h.Number), Arab: h.Arab, Id: h.ID}}, nil
+    return &hadithpb.GetHadithResponse{Hadith: toPB(h.In(req.GetLang()))}, nil
+}
+
+func (s *server) BatchGetHadith(ctx context.Context, req *hadithpb.BatchGetHadithRequest) (*hadithpb.BatchGetHadithResponse, error) {
+    if err := s.checkLang(ctx, req.GetLang()); err != nil {
+        return nil, err
+    }
+    if len(req.GetRefs()) > s.maxPageSize {
+        return nil, status.Errorf(codes.InvalidArgument, "at most %d refs per request", s.maxPageSize)
+    }
+    refs := make([]hadith.Ref, len(req.GetRefs()))
+    for i, r := range req.GetRefs() {
+        refs[i] = hadith.Ref{Book: r.GetBook(), Number: int(r.GetNumber())}
+        if r.GetRef() != "" {
+            ref, err := hadith.ParseRef(r.GetRef())
+            if err != nil {
+                return nil, status.Errorf(codes.InvalidArgument, "refs[%d]: %v", i, err)
+            }
+            refs[i] = ref
+        }
+    }
+    hadiths, found, err := s.repo.GetMany(ctx, refs)
+    if err != nil {
+        return nil, internal(err)
+    }
+    out := make([]*hadithpb.BatchGetHadithResult, len(refs))
+    for i, ref := range refs {
+        out[i] = &hadithpb.BatchGetHadithResult{Ref: ref.String(), Found: found[i]}
+        if found[i] {
+            out[i].Hadith = toPB(hadiths[i].In(req.GetLang()))
+        }
+    }
+    return &hadithpb.BatchGetHadithResponse{Results: out}, nil
 }
 
 func (s *server) Search(ctx context.Context, req *hadithpb.SearchRequest) (*hadithpb.SearchResponse, error) {
-    // Minimal inline search to avoid import cycle.
+    if err := s.checkLang(ctx, req.GetLang()); err != nil {
+        return nil, err
+    }
+    if strings.TrimSpace(req.GetQuery()) == "" {
+        return s.browseAll(ctx, req)
+    }
+    version, err := s.repo.Version(ctx)
+    if err != nil {
+        return nil, internal(err)
+    }
+    opts := hadith.SearchOptions{Lang: req.GetLang(), Limit: int(req.GetLimit())}
+    scope := hadith.SearchScope(req.GetQuery(), opts)
+    if t := req.GetPageToken(); t != "" {
+        after, err := s.tokens.Decode(t, version, scope)
+        if errors.Is(err, hadith.ErrStaleToken) || errors.Is(err, hadith.ErrTokenScope) {
+            return nil, status.Error(codes.FailedPrecondition, err.Error())
+        }
+        if err != nil {
+            return nil, status.Error(codes.InvalidArgument, err.Error())
+        }
+        opts.After = &after
+    }
+    limit := opts.Limit
+    if limit > 0 {
+        opts.Limit++ // one more tells whether there is a next page
+    }
+    results, total, err := s.repo.Search(ctx, req.GetQuery(), opts)
+    var syntaxErr *hadith.SyntaxError
+    if errors.As(err, &syntaxErr) {
+        return nil, status.Error(codes.InvalidArgument, err.Error())
+    }
+    if err != nil {
+        return nil, internal(err)
+    }
+    var next string
+    if limit > 0 && len(results) > limit {
+        results = results[:limit]
+        next = s.tokens.Encode(hadith.CursorOf(results[limit-1]), version, scope)
+    }
     var out []*hadithpb.Hadith
-    q := req.GetQuery()
-    for _, h := range s.store.All() {
-        if q == "" || containsFold(h.ID, q) || containsFold(h.Arab, q) || containsFold(h.Book, q) {
-            out = append(out, &hadithpb.Hadith{Book: h.Book, Number: int32(h.Number), Arab: h.Arab, Id: h.ID})
-            if req.GetLimit() > 0 && int32(len(out)) >= req.GetLimit() {
-                break
-            }
+    for _, r := range results {
+        out = append(out, toPB(r.Hadith.In(req.GetLang())))
+    }
+    return &hadithpb.SearchResponse{Results: out, NextPageToken: next, Total: int32(total)}, nil
+}
+
+// browseAll answers a Search with a blank query: every hadith, by book and
+// number, up to the limit (at most maxPageSize), as the HTTP /search does.
+func (s *server) browseAll(ctx context.Context, req *hadithpb.SearchRequest) (*hadithpb.SearchResponse, error) {
+    if req.GetPageToken() != "" {
+        return nil, status.Error(codes.InvalidArgument, "page_token needs a query")
+    }
+    limit := int(req.GetLimit())
+    if limit <= 0 || limit > s.maxPageSize {
+        limit = s.maxPageSize
+    }
+    hadiths, total, err := hadith.PageAll(ctx, s.repo, "", 0, limit)
+    if err != nil {
+        return nil, internal(err)
+    }
+    out := make([]*hadithpb.Hadith, len(hadiths))
+    for i, h := range hadiths {
+        out[i] = toPB(h.In(req.GetLang()))
+    }
+    return &hadithpb.SearchResponse{Results: out, Total: int32(total)}, nil
+}
+
+func (s *server) Browse(ctx context.Context, req *hadithpb.BrowseRequest) (*hadithpb.BrowseResponse, error) {
+    if err := s.checkLang(ctx, req.GetLang()); err != nil {
+        return nil, err
+    }
+    if req.GetFrom() < 0 || req.GetTo() < 0 || req.GetOffset() < 0 || req.GetLimit() < 0 {
+        return nil, status.Error(codes.InvalidArgument, "from, to, offset and limit must not be negative")
+    }
+    limit := int(req.GetLimit())
+    if limit == 0 || limit > s.maxPageSize {
+        limit = s.maxPageSize
+    }
+    hadiths, total, err := s.repo.BrowsePage(ctx, req.GetBook(), int(req.GetFrom()), int(req.GetTo()), int(req.GetOffset()), limit)
+    if err != nil {
+        return nil, internal(err)
+    }
+    out := make([]*hadithpb.Hadith, len(hadiths))
+    for i, h := range hadiths {
+        out[i] = toPB(h.In(req.GetLang()))
+    }
+    return &hadithpb.BrowseResponse{Hadiths: out, Total: int32(total)}, nil
+}
+
+func (s *server) checkLang(ctx context.Context, lang string) error {
+    if lang == "" {
+        return nil
+    }
+    langs, err := s.repo.Languages(ctx)
+    if err != nil {
+        return internal(err)
+    }
+    for _, l := range langs {
+        if l == lang {
+            return nil
         }
     }
-    return &hadithpb.SearchResponse{Results: out}, nil
+    return status.Errorf(codes.InvalidArgument, "unknown lang %q; available: %s", lang, strings.Join(langs, ", "))
+}
+
+// internal logs a backend failure and hides its details from the client.
+func internal(err error) error {
+    log.Printf("store: %v", err)
+    return status.Error(codes.Internal, "internal error")
 }
 
-func containsFold(hay, needle string) bool {
-    // simple case-insensitive containment
-    // avoid importing strings to keep this file minimal under build tag
-    H := []rune(hay)
-    N := []rune(needle)
-    for i := range H {
-        if i+len(N) > len(H) { return false }
-        ok := true
-        for j := range N {
-            r1 := H[i+j]
-            r2 := N[j]
-            if r1 >= 'A' && r1 <= 'Z' { r1 = r1 - 'A' + 'a' }
-            if r2 >= 'A' && r2 <= 'Z' { r2 = r2 - 'A' + 'a' }
-            if r1 != r2 { ok = false; break }
+func toPB(h hadith.Hadith) *hadithpb.Hadith {
+    var numbers map[string]int32
+    if len(h.Numbers) > 0 {
+        numbers = make(map[string]int32, len(h.Numbers))
+        for k, v := range h.Numbers {
+            numbers[k] = int32(v)
         }
-        if ok { return true }
     }
-    return false
+    return &hadithpb.Hadith{
+        Book:         h.Book,
+        Number:       int32(h.Number),
+        Arab:         h.Arab,
+        Id:           h.ID,
+        Kitab:        h.Kitab,
+        Bab:          h.Bab,
+        Grade:        h.Grade,
+        Numbers:      numbers,
+        Translations: h.Translations,
+    }
 }
 
 func main() {
-    root := findBooksRoot()
-    store, err := data.NewStore(filepath.Join(root, "books"))
+    flags := config.Register(flag.CommandLine, "books_dir", "strict", "store.backend", "grpc.addr")
+    flag.Parse()
+    cfg, err := flags.Load()
+    if err != nil {
+        log.Fatalf("config: %v", err)
+    }
+    if ok, err := config.Command(cfg, flag.Args()); ok {
+        if err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+    cfg.SetupLogging()
+    repo, from, err := assets.OpenRepository(cfg)
     if err != nil {
-        log.Fatalf("load books: %v", err)
+        log.Fatalf("open %s store: %v", cfg.Store.Backend, err)
+    }
+    log.Printf("serving hadiths from %s", from)
+    var opts []grpc.ServerOption
+    if tls := cfg.GRPC.TLS; tls.Enabled() {
+        creds, err := credentials.NewServerTLSFromFile(tls.CertFile, tls.KeyFile)
+        if err != nil {
+            log.Fatalf("tls: %v", err)
+        }
+        opts = append(opts, grpc.Creds(creds))
     }
-    lis, err := net.Listen("tcp", ":50051")
+    lis, err := net.Listen("tcp", cfg.GRPC.Addr)
     if err != nil {
         log.Fatalf("listen: %v", err)
     }
-    s := grpc.NewServer()
-    hadithpb.RegisterHadithServiceServer(s, &server{store: store})
+    s := grpc.NewServer(opts...)
+    hadithpb.RegisterHadithServiceServer(s, &server{repo: repo, tokens: hadith.NewPageTokens([]byte(cfg.CursorSecret)), maxPageSize: cfg.API.MaxPageSize})
     log.Printf("hadith gRPC listening on %s", lis.Addr())
     if err := s.Serve(lis); err != nil {
         log.Fatal(err)
     }
 }
 
-// findBooksRoot walks up from CWD to find a directory containing a "books" folder.
-func findBooksRoot() string {
-    dir, _ := os.Getwd()
-    for i := 0; i < 5; i++ { // up to 5 levels
-        if st, err := os.Stat(filepath.Join(dir, "books")); err == nil && st.IsDir() {
-            return dir
-        }
-        parent := filepath.Dir(dir)
-        if parent == dir {
-            break
-        }
-        dir = parent
-    }
-    return "."
-}
-
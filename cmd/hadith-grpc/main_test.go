@@ -0,0 +1,77 @@
+//go:build grpc
+
+package main
+
+import (
+    "context"
+    "testing"
+
+    "google.golang.org/grpc/codes"
+    "google.golang.org/grpc/status"
+
+    "github.com/nuzlilatief/hadith-go/api/gen/go/hadithpb"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+)
+
+func testServer(t *testing.T) *server {
+    t.Helper()
+    store, err := hadith.Open("../../books", hadith.Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return &server{repo: hadith.Memory(store), tokens: hadith.NewPageTokens(nil), maxPageSize: 20}
+}
+
+func TestSearchBlankQuery(t *testing.T) {
+    s := testServer(t)
+    ctx := context.Background()
+    tests := []struct {
+        query string
+        limit int32
+        want  int
+    }{
+        {"", 5, 5},
+        {"   ", 5, 5},
+        {"", 0, 20},   // api.max_page_size
+        {"", 500, 20}, // capped
+    }
+    for _, tt := range tests {
+        resp, err := s.Search(ctx, &hadithpb.SearchRequest{Query: tt.query, Limit: tt.limit})
+        if err != nil {
+            t.Fatalf("Search(%q, %d): %v", tt.query, tt.limit, err)
+        }
+        if len(resp.Results) != tt.want || resp.Total != 4536 || resp.NextPageToken != "" {
+            t.Fatalf("Search(%q, %d) = %d results of %d, token %q; want %d of 4536",
+                tt.query, tt.limit, len(resp.Results), resp.Total, resp.NextPageToken, tt.want)
+        }
+        // Books by name, then numbers.
+        if first := resp.Results[0]; first.Book != "darimi" || first.Number != 1 {
+            t.Errorf("first result = %s:%d, want darimi:1", first.Book, first.Number)
+        }
+    }
+    _, err := s.Search(ctx, &hadithpb.SearchRequest{PageToken: "x"})
+    if status.Code(err) != codes.InvalidArgument {
+        t.Errorf("blank query with page_token: %v, want InvalidArgument", err)
+    }
+}
+
+func TestBatchGetHadithLimit(t *testing.T) {
+    s := testServer(t)
+    ctx := context.Background()
+    refs := make([]*hadithpb.HadithRef, s.maxPageSize)
+    for i := range refs {
+        refs[i] = &hadithpb.HadithRef{Book: "malik", Number: int32(i + 1)}
+    }
+    resp, err := s.BatchGetHadith(ctx, &hadithpb.BatchGetHadithRequest{Refs: refs})
+    if err != nil {
+        t.Fatalf("%d refs: %v", len(refs), err)
+    }
+    if len(resp.Results) != len(refs) {
+        t.Errorf("%d refs gave %d results", len(refs), len(resp.Results))
+    }
+    refs = append(refs, &hadithpb.HadithRef{Ref: "darimi:1"})
+    _, err = s.BatchGetHadith(ctx, &hadithpb.BatchGetHadithRequest{Refs: refs})
+    if status.Code(err) != codes.InvalidArgument {
+        t.Errorf("%d refs: %v, want InvalidArgument", len(refs), err)
+    }
+}
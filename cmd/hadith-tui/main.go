@@ -2,21 +2,36 @@ package main
 
 import (
     "bufio"
+    "context"
+    "flag"
     "fmt"
     "log"
     "os"
-    "path/filepath"
+    "sort"
     "strings"
 
-    "github.com/nuzlilatief/hadith-go/internal/data"
-    "github.com/nuzlilatief/hadith-go/internal/search"
+    "github.com/nuzlilatief/hadith-go/internal/assets"
+    "github.com/nuzlilatief/hadith-go/internal/config"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith/ref"
 )
 
 // A minimal line-based TUI: type a query, see paginated results, navigate with n/p, open detail with o <index>, q to quit.
 func main() {
     log.SetFlags(0)
-    root := findBooksRoot()
-    store, err := data.NewStore(filepath.Join(root, "books"))
+    flags := config.Register(flag.CommandLine, "books_dir", "strict")
+    flag.Parse()
+    cfg, err := flags.Load()
+    if err != nil {
+        log.Fatalf("config: %v", err)
+    }
+    if ok, err := config.Command(cfg, flag.Args()); ok {
+        if err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+    store, err := assets.OpenStore(cfg.BooksDir, hadith.Options{Strict: cfg.Strict})
     if err != nil {
         log.Fatalf("load books: %v", err)
     }
@@ -24,7 +39,8 @@ func main() {
     in := bufio.NewScanner(os.Stdin)
     page := 0
     const pageSize = 10
-    var hits []search.Result
+    var hits []hadith.Result
+    var query *hadith.Query
     // UI state
     truncWidth := 140
     showFull := false
@@ -41,7 +57,7 @@ func main() {
         if line == "" {
             continue
         }
-        // Extended commands: :help, :full, :short, :width N, :color on|off
+        // Extended commands: :help, :full, :short, :width N, :color on|off, :goto REF
         if strings.HasPrefix(line, ":") {
             cmd := strings.TrimSpace(strings.TrimPrefix(line, ":"))
             switch {
@@ -50,11 +66,11 @@ func main() {
             case cmd == "full":
                 showFull = true
                 fmt.Println("Full rows enabled (no truncation).")
-                if len(hits) > 0 { renderPage(hits, page, pageSize, truncWidth, showFull, colorOn) }
+                if len(hits) > 0 { renderPage(query, hits, page, pageSize, truncWidth, showFull, colorOn) }
             case cmd == "short":
                 showFull = false
                 fmt.Printf("Truncation enabled (width=%d).\n", truncWidth)
-                if len(hits) > 0 { renderPage(hits, page, pageSize, truncWidth, showFull, colorOn) }
+                if len(hits) > 0 { renderPage(query, hits, page, pageSize, truncWidth, showFull, colorOn) }
             case strings.HasPrefix(cmd, "width"):
                 arg := strings.TrimSpace(strings.TrimPrefix(cmd, "width"))
                 if arg == "" {
@@ -69,12 +85,36 @@ func main() {
                 truncWidth = n
                 showFull = false
                 fmt.Printf("Width set to %d (truncation enabled).\n", truncWidth)
-                if len(hits) > 0 { renderPage(hits, page, pageSize, truncWidth, showFull, colorOn) }
+                if len(hits) > 0 { renderPage(query, hits, page, pageSize, truncWidth, showFull, colorOn) }
             case strings.HasPrefix(cmd, "color"):
                 arg := strings.TrimSpace(strings.TrimPrefix(cmd, "color"))
                 if arg == "on" || arg == "enable" { colorOn = true; fmt.Println("Color enabled.") }
                 if arg == "off" || arg == "disable" { colorOn = false; fmt.Println("Color disabled.") }
-                if len(hits) > 0 { renderPage(hits, page, pageSize, truncWidth, showFull, colorOn) }
+                if len(hits) > 0 { renderPage(query, hits, page, pageSize, truncWidth, showFull, colorOn) }
+            case strings.HasPrefix(cmd, "goto"):
+                arg := strings.TrimSpace(strings.TrimPrefix(cmd, "goto"))
+                citations, err := ref.NewResolver(store.BookInfos()).Parse(arg)
+                if err != nil {
+                    fmt.Println(err)
+                    break
+                }
+                if cut, clamped := ref.Clamp(citations, cfg.API.MaxPageSize); clamped {
+                    fmt.Printf("Showing the first %d hadiths cited, up to %s.\n", cfg.API.MaxPageSize, cut[len(cut)-1])
+                    citations = cut
+                }
+                matches, err := ref.Lookup(context.Background(), hadith.Memory(store), citations)
+                if err != nil {
+                    fmt.Println(err)
+                    break
+                }
+                for _, m := range matches {
+                    if len(m.Hadiths) == 0 {
+                        fmt.Printf("not found: %s\n", m.Citation)
+                    }
+                    for _, h := range m.Hadiths {
+                        printDetail(h, nil, colorOn)
+                    }
+                }
             default:
                 fmt.Println("Unknown command. Try :help")
             }
@@ -83,12 +123,12 @@ func main() {
         // Paging or open commands
         if line == "n" && len(hits) > 0 {
             if (page+1)*pageSize < len(hits) { page++ }
-            renderPage(hits, page, pageSize, truncWidth, showFull, colorOn)
+            renderPage(query, hits, page, pageSize, truncWidth, showFull, colorOn)
             continue
         }
         if line == "p" && len(hits) > 0 {
             if page > 0 { page-- }
-            renderPage(hits, page, pageSize, truncWidth, showFull, colorOn)
+            renderPage(query, hits, page, pageSize, truncWidth, showFull, colorOn)
             continue
         }
         if strings.HasPrefix(line, "o ") && len(hits) > 0 {
@@ -97,18 +137,23 @@ func main() {
             idx := parseInt(idxStr) - 1
             abs := page*pageSize + idx
             if idx >= 0 && abs >= 0 && abs < len(hits) {
-                h := hits[abs].Hadith
-                // Full detail view always prints full text
-                fmt.Printf("\n%s #%d\nID: %s\nAR: %s\n\n", h.Book, h.Number, h.ID, h.Arab)
+                query.Highlight(hits[abs : abs+1])
+                printDetail(hits[abs].Hadith, hits[abs].Matches, colorOn)
             } else {
                 fmt.Println("invalid index")
             }
             continue
         }
         // Otherwise treat the line as the new query
-        hits = search.SimpleSearch(store.All(), line, 0)
+        q, err := hadith.ParseQuery(line)
+        if err != nil {
+            fmt.Println(err)
+            continue
+        }
+        query = q
+        hits = query.Run(store, 0)
         page = 0
-        renderPage(hits, page, pageSize, truncWidth, showFull, colorOn)
+        renderPage(query, hits, page, pageSize, truncWidth, showFull, colorOn)
     }
 }
 
@@ -120,6 +165,7 @@ const (
     clrYellow = "\x1b[33m"
     clrGreen  = "\x1b[32m"
     clrBlue   = "\x1b[34m"
+    clrMatch  = "\x1b[1;35m"
 )
 
 func colorize(on bool, color, s string) string {
@@ -127,7 +173,7 @@ func colorize(on bool, color, s string) string {
     return color + s + clrReset
 }
 
-func renderPage(hits []search.Result, page, size, truncWidth int, showFull, colorOn bool) {
+func renderPage(query *hadith.Query, hits []hadith.Result, page, size, truncWidth int, showFull, colorOn bool) {
     total := len(hits)
     if total == 0 {
         fmt.Println("No results. Try another query.")
@@ -138,6 +184,8 @@ func renderPage(hits []search.Result, page, size, truncWidth int, showFull, colo
     end := start + size
     if end > total { end = total }
 
+    query.Highlight(hits[start:end])
+
     mode := "short"
     if showFull { mode = "full" }
     fmt.Printf("\nResults %d–%d of %d — (n)ext, (p)rev, (o N) open, (q)uit — mode:%s width:%d\n", start+1, end, total, mode, truncWidth)
@@ -149,21 +197,34 @@ func renderPage(hits []search.Result, page, size, truncWidth int, showFull, colo
         fmt.Printf("%s\n", colorize(colorOn, clrDim, "────────────────────────────────────────────────────────"))
         // Header line with book and number and score
         title := fmt.Sprintf("%2d. %s #%d", i+1, h.Book, h.Number)
-        if r.Score > 0 { title += fmt.Sprintf("  score:%d", r.Score) }
+        if r.Score > 0 { title += fmt.Sprintf("  score:%.2f", r.Score) }
+        if h.Grade != "" { title += "  " + h.Grade }
         fmt.Println(colorize(colorOn, clrYellow, title))
         // Lines with labels
-        fmt.Printf("    %s %s\n", colorize(colorOn, clrGreen, "ID:"), oneLine(h.ID, width))
-        fmt.Printf("    %s %s\n", colorize(colorOn, clrCyan, "AR:"), oneLine(h.Arab, width))
+        fmt.Printf("    %s %s\n", colorize(colorOn, clrGreen, "ID:"), excerpt(h.ID, r.Matches["id"], width, colorOn))
+        fmt.Printf("    %s %s\n", colorize(colorOn, clrCyan, "AR:"), excerpt(h.Arab, r.Matches["arab"], width, colorOn))
     }
 }
 
-func oneLine(s string, width int) string {
-    s = strings.ReplaceAll(s, "\n", " ")
-    s = strings.TrimSpace(s)
-    if width > 0 && len(s) > width {
-        return s[:width] + "…"
+// chapterTitle joins kitab and bab as "Kitab › Bab", skipping empty parts.
+func chapterTitle(kitab, bab string) string {
+    switch {
+    case kitab == "":
+        return bab
+    case bab == "":
+        return kitab
     }
-    return s
+    return kitab + " › " + bab
+}
+
+// excerpt returns a one-line window of s around its matches (width<=0 keeps
+// the whole text), with matches highlighted when colors are on.
+func excerpt(s string, spans []hadith.Span, width int, colorOn bool) string {
+    snip, marks := hadith.Snippet(s, spans, width)
+    if !colorOn {
+        return snip
+    }
+    return hadith.Mark(snip, marks, clrMatch, clrReset)
 }
 
 func parseInt(s string) int {
@@ -177,6 +238,26 @@ func parseInt(s string) int {
     return n
 }
 
+// printDetail prints the full entry of h, highlighting the matches m.
+func printDetail(h hadith.Hadith, m map[string][]hadith.Span, colorOn bool) {
+    fmt.Printf("\n%s #%d\n", h.Book, h.Number)
+    if h.Kitab != "" || h.Bab != "" {
+        fmt.Printf("Chapter: %s\n", chapterTitle(h.Kitab, h.Bab))
+    }
+    if h.Grade != "" {
+        fmt.Printf("Grade: %s\n", h.Grade)
+    }
+    editions := make([]string, 0, len(h.Numbers))
+    for e := range h.Numbers {
+        editions = append(editions, e)
+    }
+    sort.Strings(editions)
+    for _, e := range editions {
+        fmt.Printf("No. (%s): %d\n", e, h.Numbers[e])
+    }
+    fmt.Printf("ID: %s\nAR: %s\n\n", excerpt(h.ID, m["id"], 0, colorOn), excerpt(h.Arab, m["arab"], 0, colorOn))
+}
+
 func printHelp() {
     fmt.Println("Commands:")
     fmt.Println("  :help           Show this help")
@@ -184,24 +265,15 @@ func printHelp() {
     fmt.Println("  :short          Enable truncation mode")
     fmt.Println("  :width N        Set truncation width to N characters")
     fmt.Println("  :color on|off   Toggle ANSI colors")
+    fmt.Println("  :goto REF       Open the hadiths a citation names (Malik 12, HR. Darimi no. 5-7)")
+    fmt.Println("Query syntax:")
+    fmt.Println("  niat \"niat baik\"   Words (all must match) and exact phrases")
+    fmt.Println("  book:malik        Restrict to a book")
+    fmt.Println("  arab:X  id:X      Match only the Arabic or Indonesian text")
+    fmt.Println("  number:10..20     Number range (also number:7, 10.., ..20)")
+    fmt.Println("  AND OR NOT ( )    Boolean operators and grouping")
     fmt.Println("Keys:")
     fmt.Println("  n, p            Next/previous page")
     fmt.Println("  o N             Open full entry N on page")
     fmt.Println("  q               Quit")
 }
-
-// findBooksRoot walks up from CWD to find a directory containing a "books" folder.
-func findBooksRoot() string {
-    dir, _ := os.Getwd()
-    for i := 0; i < 5; i++ { // up to 5 levels
-        if st, err := os.Stat(filepath.Join(dir, "books")); err == nil && st.IsDir() {
-            return dir
-        }
-        parent := filepath.Dir(dir)
-        if parent == dir {
-            break
-        }
-        dir = parent
-    }
-    return "."
-}
@@ -0,0 +1,123 @@
+// Package assets decides where the commands read their files from: the
+// books, the web UI and the OpenAPI spec. Files on disk win over the copies
+// embedded with -tags embed, so a development checkout always serves what
+// is being edited while a copied binary still works on its own.
+package assets
+
+import (
+    "io/fs"
+    "log"
+    "os"
+    "path/filepath"
+
+    hadithgo "github.com/nuzlilatief/hadith-go"
+    "github.com/nuzlilatief/hadith-go/internal/config"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+)
+
+// Books resolves the books to load. dir, the books_dir setting, wins; then
+// a books directory found by Root; then the embedded dataset. Exactly one of the results is set: a directory, or
+// the embedded file system. With nothing found and nothing embedded it
+// returns "books" so that the load error names the expected place.
+func Books(dir string) (string, fs.FS) {
+    if dir != "" {
+        return dir, nil
+    }
+    if root := Root(); root != "" {
+        return filepath.Join(root, "books"), nil
+    }
+    if fsys := hadithgo.Books(); fsys != nil {
+        return "", fsys
+    }
+    return "books", nil
+}
+
+// OpenStore loads the store from the books Books resolves for dir and logs
+// the problems the loader tolerated.
+func OpenStore(dir string, opts hadith.Options) (*hadith.Store, error) {
+    dir, fsys := Books(dir)
+    var store *hadith.Store
+    var err error
+    if fsys != nil {
+        store, err = hadith.OpenFS(fsys, opts)
+    } else {
+        store, err = hadith.Open(dir, opts)
+    }
+    if err != nil {
+        return nil, err
+    }
+    for _, p := range store.Warnings() {
+        log.Printf("books: %s", p)
+    }
+    return store, nil
+}
+
+// OpenRepository opens the backend selected by cfg.Store: the books
+// resolved by Books, loaded into memory, or an SQLite database. It also
+// returns a description of the source for log messages.
+func OpenRepository(cfg *config.Config) (hadith.Repository, string, error) {
+    if cfg.Store.Backend == "sqlite" {
+        repo, err := hadith.OpenSQLite(cfg.Store.Path)
+        return repo, "SQLite database " + cfg.Store.Path, err
+    }
+    store, err := OpenStore(cfg.BooksDir, hadith.Options{Strict: cfg.Strict})
+    if err != nil {
+        return nil, "", err
+    }
+    return hadith.Memory(store), Describe(cfg.BooksDir), nil
+}
+
+// Describe names the books Books resolves for dir, for log messages.
+func Describe(dir string) string {
+    dir, fsys := Books(dir)
+    if fsys != nil {
+        return "embedded dataset"
+    }
+    return dir
+}
+
+// Web returns the web UI: the web directory next to the books found by
+// Root, else the embedded copy. It is nil when there is neither.
+func Web() fs.FS {
+    return diskOr("web", hadithgo.Web())
+}
+
+// Spec returns the OpenAPI spec, from api/ next to the books found by Root
+// or else from the embedded copy.
+func Spec() ([]byte, error) {
+    fsys := diskOr("api", hadithgo.API())
+    if fsys == nil {
+        return nil, fs.ErrNotExist
+    }
+    return fs.ReadFile(fsys, "openapi.yaml")
+}
+
+func diskOr(name string, embedded fs.FS) fs.FS {
+    if root := Root(); root != "" {
+        dir := filepath.Join(root, name)
+        if st, err := os.Stat(dir); err == nil && st.IsDir() {
+            return os.DirFS(dir)
+        }
+    }
+    return embedded
+}
+
+// Root walks up from the working directory, at most five levels, to find a
+// directory containing a "books" folder. It returns "" when there is none.
+func Root() string {
+    dir, err := os.Getwd()
+    if err != nil {
+        return ""
+    }
+    for i := 0; i < 5; i++ {
+        if st, err := os.Stat(filepath.Join(dir, "books")); err == nil && st.IsDir() {
+            return dir
+        }
+        parent := filepath.Dir(dir)
+        if parent == dir {
+            break
+        }
+        dir = parent
+    }
+    return ""
+}
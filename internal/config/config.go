@@ -0,0 +1,188 @@
+// Package config holds the settings shared by the commands and loads them
+// from, in increasing order of precedence:
+//
+//  1. built-in defaults
+//  2. a config file (-config flag or $HADITH_CONFIG; .json, .yaml/.yml or .toml)
+//  3. environment variables (HADITH_<KEY>, e.g. HADITH_API_ADDR, plus a few
+//     older names such as ADDR)
+//  4. flags (-set key=value and per-command shortcuts such as -books-dir)
+//
+// Keys are dotted paths into Config, e.g. "api.addr" or "api.tls.cert_file";
+// they are the JSON field names. "config print" shows the effective values
+// and where each came from.
+package config
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "log/slog"
+    "os"
+    "strings"
+    "time"
+)
+
+// Config is the effective configuration of a command. Commands ignore the
+// sections they have no use for.
+type Config struct {
+    BooksDir string `json:"books_dir"` // empty: search upwards, then the embedded dataset
+    Strict   bool   `json:"strict"`    // refuse data that fails validation
+    // CursorSecret signs search page tokens; empty means a random key per
+    // process.
+    CursorSecret string `json:"cursor_secret"`
+
+    Store struct {
+        Backend string `json:"backend"` // memory (load books_dir) or sqlite
+        Path    string `json:"path"`    // database of the sqlite backend
+    } `json:"store"`
+
+    API struct {
+        Addr            string   `json:"addr"`
+        AdminToken      string   `json:"admin_token"` // enables POST /admin/reload
+        ReloadInterval  Duration `json:"reload_interval"`
+        CacheMaxAge     Duration `json:"cache_max_age"` // 0: clients revalidate every time
+        DefaultPageSize int      `json:"default_page_size"`
+        MaxPageSize     int      `json:"max_page_size"`
+        CORSOrigins     []string `json:"cors_origins"` // "*" allows any origin
+        TLS             TLS      `json:"tls"`
+    } `json:"api"`
+
+    GRPC struct {
+        Addr string `json:"addr"`
+        TLS  TLS    `json:"tls"`
+    } `json:"grpc"`
+
+    Log struct {
+        Level  string `json:"level"`  // debug, info, warn or error
+        Format string `json:"format"` // text or json
+    } `json:"log"`
+
+    file    string
+    sources map[string]string // key -> where its value came from
+}
+
+// TLS names a certificate and key file. Both empty means plain text.
+type TLS struct {
+    CertFile string `json:"cert_file"`
+    KeyFile  string `json:"key_file"`
+}
+
+// Enabled reports whether TLS is configured. Setting only one of the files
+// is an error reported by Validate.
+func (t TLS) Enabled() bool { return t.CertFile != "" || t.KeyFile != "" }
+
+// Duration is a time.Duration written as a string such as "10s".
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+    return json.Marshal(d.String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+    var s string
+    if err := json.Unmarshal(b, &s); err != nil {
+        return fmt.Errorf("duration must be a string such as \"10s\"")
+    }
+    v, err := parseDuration(s)
+    if err != nil {
+        return err
+    }
+    *d = v
+    return nil
+}
+
+func (d Duration) String() string {
+    if d == 0 {
+        return "0"
+    }
+    return time.Duration(d).String()
+}
+
+func parseDuration(s string) (Duration, error) {
+    if s == "" || s == "0" {
+        return 0, nil
+    }
+    v, err := time.ParseDuration(s)
+    if err != nil || v < 0 {
+        return 0, fmt.Errorf("invalid duration %q (want e.g. 10s, 1m)", s)
+    }
+    return Duration(v), nil
+}
+
+// Default returns the built-in defaults.
+func Default() *Config {
+    c := &Config{}
+    c.Store.Backend = "memory"
+    c.Store.Path = "hadith.db"
+    c.API.Addr = ":8080"
+    c.API.DefaultPageSize = 50
+    c.API.MaxPageSize = 200
+    c.API.CORSOrigins = []string{"*"}
+    c.GRPC.Addr = ":50051"
+    c.Log.Level = "info"
+    c.Log.Format = "text"
+    return c
+}
+
+// File returns the config file that was read, or "".
+func (c *Config) File() string { return c.file }
+
+// Validate checks values that every command relies on.
+func (c *Config) Validate() error {
+    var errs []error
+    if c.Store.Backend != "memory" && c.Store.Backend != "sqlite" {
+        errs = append(errs, fmt.Errorf("store.backend must be memory or sqlite, got %q", c.Store.Backend))
+    }
+    if c.API.DefaultPageSize < 1 || c.API.MaxPageSize < 1 {
+        errs = append(errs, errors.New("api.default_page_size and api.max_page_size must be positive"))
+    } else if c.API.DefaultPageSize > c.API.MaxPageSize {
+        errs = append(errs, errors.New("api.default_page_size must not exceed api.max_page_size"))
+    }
+    if t := c.API.TLS; t.Enabled() && (t.CertFile == "" || t.KeyFile == "") {
+        errs = append(errs, errors.New("api.tls needs both cert_file and key_file"))
+    }
+    if t := c.GRPC.TLS; t.Enabled() && (t.CertFile == "" || t.KeyFile == "") {
+        errs = append(errs, errors.New("grpc.tls needs both cert_file and key_file"))
+    }
+    if _, err := c.level(); err != nil {
+        errs = append(errs, err)
+    }
+    if c.Log.Format != "text" && c.Log.Format != "json" {
+        errs = append(errs, fmt.Errorf("log.format must be text or json, got %q", c.Log.Format))
+    }
+    return errors.Join(errs...)
+}
+
+func (c *Config) level() (slog.Level, error) {
+    var l slog.Level
+    if err := l.UnmarshalText([]byte(c.Log.Level)); err != nil {
+        return 0, fmt.Errorf("log.level must be debug, info, warn or error, got %q", c.Log.Level)
+    }
+    return l, nil
+}
+
+// SetupLogging routes the log package and slog to stderr with the configured
+// level and format. Plain log.Printf messages are logged at info level.
+func (c *Config) SetupLogging() {
+    level, _ := c.level()
+    opts := &slog.HandlerOptions{Level: level}
+    var h slog.Handler = slog.NewTextHandler(os.Stderr, opts)
+    if c.Log.Format == "json" {
+        h = slog.NewJSONHandler(os.Stderr, opts)
+    }
+    slog.SetDefault(slog.New(h))
+}
+
+// AllowOrigin returns the Access-Control-Allow-Origin value for a request
+// from origin, or "" when the origin is not allowed.
+func (c *Config) AllowOrigin(origin string) string {
+    for _, o := range c.API.CORSOrigins {
+        if o == "*" {
+            return "*"
+        }
+        if origin != "" && strings.EqualFold(o, origin) {
+            return origin
+        }
+    }
+    return ""
+}
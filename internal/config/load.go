@@ -0,0 +1,312 @@
+package config
+
+import (
+    "bytes"
+    "encoding/json"
+    "flag"
+    "fmt"
+    "io"
+    "os"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// FileEnv names the environment variable that selects the config file when
+// the -config flag is not given.
+const FileEnv = "HADITH_CONFIG"
+
+// setting describes one key. Its canonical environment variable is derived
+// from the key (see envName); legacy lists older names, which lose against
+// the canonical one.
+type setting struct {
+    key    string
+    field  func(c *Config) any // pointer to the field
+    usage  string
+    legacy []string
+    secret bool // not shown by Print
+}
+
+var settings = []setting{
+    {key: "books_dir", field: func(c *Config) any { return &c.BooksDir }, usage: "books directory (default: ./books found upwards from the working directory, else the embedded dataset)"},
+    {key: "strict", field: func(c *Config) any { return &c.Strict }, usage: "refuse books that fail validation", legacy: []string{"STRICT"}},
+    {key: "cursor_secret", field: func(c *Config) any { return &c.CursorSecret }, usage: "key signing search page tokens (default: random, so tokens do not survive a restart)", secret: true},
+    {key: "store.backend", field: func(c *Config) any { return &c.Store.Backend }, usage: "where hadiths are read from: memory (load the books) or sqlite (a database from hadith-cli db build)"},
+    {key: "store.path", field: func(c *Config) any { return &c.Store.Path }, usage: "SQLite database for store.backend sqlite"},
+    {key: "api.addr", field: func(c *Config) any { return &c.API.Addr }, usage: "HTTP listen address", legacy: []string{"ADDR"}},
+    {key: "api.admin_token", field: func(c *Config) any { return &c.API.AdminToken }, usage: "bearer token enabling POST /admin/reload", legacy: []string{"ADMIN_TOKEN"}, secret: true},
+    {key: "api.reload_interval", field: func(c *Config) any { return &c.API.ReloadInterval }, usage: "poll the books for changes this often (0: off)", legacy: []string{"RELOAD_INTERVAL"}},
+    {key: "api.cache_max_age", field: func(c *Config) any { return &c.API.CacheMaxAge }, usage: "let clients reuse responses this long without revalidating"},
+    {key: "api.default_page_size", field: func(c *Config) any { return &c.API.DefaultPageSize }, usage: "search results per page when not requested"},
+    {key: "api.max_page_size", field: func(c *Config) any { return &c.API.MaxPageSize }, usage: "upper bound for limit and page_size"},
+    {key: "api.cors_origins", field: func(c *Config) any { return &c.API.CORSOrigins }, usage: "allowed CORS origins, comma-separated (* for any)"},
+    {key: "api.tls.cert_file", field: func(c *Config) any { return &c.API.TLS.CertFile }, usage: "HTTPS certificate file"},
+    {key: "api.tls.key_file", field: func(c *Config) any { return &c.API.TLS.KeyFile }, usage: "HTTPS key file"},
+    {key: "grpc.addr", field: func(c *Config) any { return &c.GRPC.Addr }, usage: "gRPC listen address"},
+    {key: "grpc.tls.cert_file", field: func(c *Config) any { return &c.GRPC.TLS.CertFile }, usage: "gRPC TLS certificate file"},
+    {key: "grpc.tls.key_file", field: func(c *Config) any { return &c.GRPC.TLS.KeyFile }, usage: "gRPC TLS key file"},
+    {key: "log.level", field: func(c *Config) any { return &c.Log.Level }, usage: "debug, info, warn or error"},
+    {key: "log.format", field: func(c *Config) any { return &c.Log.Format }, usage: "text or json"},
+}
+
+func lookup(key string) (setting, bool) {
+    for _, s := range settings {
+        if s.key == key {
+            return s, true
+        }
+    }
+    return setting{}, false
+}
+
+// envName returns the canonical environment variable of key:
+// "api.tls.cert_file" -> HADITH_API_TLS_CERT_FILE.
+func envName(key string) string {
+    return "HADITH_" + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// set parses value into the field of key.
+func (c *Config) set(key, value string) error {
+    s, ok := lookup(key)
+    if !ok {
+        return fmt.Errorf("unknown config key %q", key)
+    }
+    switch p := s.field(c).(type) {
+    case *string:
+        *p = value
+    case *bool:
+        v, err := strconv.ParseBool(value)
+        if err != nil {
+            return fmt.Errorf("%s: %q is not a boolean", key, value)
+        }
+        *p = v
+    case *int:
+        v, err := strconv.Atoi(value)
+        if err != nil {
+            return fmt.Errorf("%s: %q is not an integer", key, value)
+        }
+        *p = v
+    case *Duration:
+        v, err := parseDuration(value)
+        if err != nil {
+            return fmt.Errorf("%s: %w", key, err)
+        }
+        *p = v
+    case *[]string:
+        *p = nil
+        for _, v := range strings.Split(value, ",") {
+            if v = strings.TrimSpace(v); v != "" {
+                *p = append(*p, v)
+            }
+        }
+    }
+    return nil
+}
+
+// get formats the value of key.
+func (c *Config) get(key string) string {
+    s, _ := lookup(key)
+    switch p := s.field(c).(type) {
+    case *string:
+        return *p
+    case *bool:
+        return strconv.FormatBool(*p)
+    case *int:
+        return strconv.Itoa(*p)
+    case *Duration:
+        return p.String()
+    case *[]string:
+        return strings.Join(*p, ",")
+    }
+    return ""
+}
+
+// Flags are the configuration flags of a command.
+type Flags struct {
+    file *string
+    sets []flagSet // in command-line order
+}
+
+type flagSet struct {
+    flag, key, value string
+}
+
+// keyFlag is a flag.Value that records an assignment to key.
+type keyFlag struct {
+    f      *Flags
+    name   string
+    key    string
+    isBool bool
+}
+
+func (k keyFlag) String() string   { return "" }
+func (k keyFlag) IsBoolFlag() bool { return k.isBool }
+
+func (k keyFlag) Set(v string) error {
+    if err := Default().set(k.key, v); err != nil {
+        return err
+    }
+    k.f.sets = append(k.f.sets, flagSet{flag: "-" + k.name, key: k.key, value: v})
+    return nil
+}
+
+// Register adds -config and -set key=value to fs, plus a shortcut flag for
+// each of keys, named after the key's last element ("api.addr" -> -addr,
+// "books_dir" -> -books-dir). Call Load after fs has been parsed.
+func Register(fs *flag.FlagSet, keys ...string) *Flags {
+    f := &Flags{}
+    f.file = fs.String("config", "", "config file (.json, .yaml, .yml or .toml; default $"+FileEnv+")")
+    fs.Func("set", "set a config key, e.g. -set api.max_page_size=100 (repeatable)", func(v string) error {
+        key, value, ok := strings.Cut(v, "=")
+        if !ok {
+            return fmt.Errorf("want key=value, got %q", v)
+        }
+        key = strings.TrimSpace(key)
+        if err := Default().set(key, value); err != nil {
+            return err
+        }
+        f.sets = append(f.sets, flagSet{flag: "-set", key: key, value: value})
+        return nil
+    })
+    def := Default()
+    for _, key := range keys {
+        s, ok := lookup(key)
+        if !ok {
+            panic("config: unknown key " + key)
+        }
+        name := key[strings.LastIndexByte(key, '.')+1:]
+        name = strings.ReplaceAll(name, "_", "-")
+        _, isBool := s.field(def).(*bool)
+        usage := s.usage
+        if v := def.get(key); v != "" && !isBool {
+            usage += " (default " + strconv.Quote(v) + ")"
+        }
+        fs.Var(keyFlag{f: f, name: name, key: key, isBool: isBool}, name, usage+"; config key "+key)
+    }
+    return f
+}
+
+// Load builds the configuration from the defaults, the config file, the
+// environment and the flags, in that order, and validates it.
+func (f *Flags) Load() (*Config, error) {
+    c := Default()
+    c.sources = map[string]string{}
+    path, from := *f.file, "-config"
+    if path == "" {
+        path, from = os.Getenv(FileEnv), FileEnv
+    }
+    if path != "" {
+        if err := c.readFile(path); err != nil {
+            return nil, fmt.Errorf("config file (%s): %w", from, err)
+        }
+    }
+    for _, s := range settings {
+        for _, name := range append(append([]string(nil), s.legacy...), envName(s.key)) {
+            v, ok := os.LookupEnv(name)
+            if !ok || v == "" {
+                continue
+            }
+            if err := c.set(s.key, v); err != nil {
+                return nil, fmt.Errorf("$%s: %w", name, err)
+            }
+            c.sources[s.key] = "env " + name
+        }
+    }
+    for _, fl := range f.sets {
+        if err := c.set(fl.key, fl.value); err != nil {
+            return nil, fmt.Errorf("%s: %w", fl.flag, err)
+        }
+        c.sources[fl.key] = "flag " + fl.flag
+    }
+    if err := c.Validate(); err != nil {
+        return nil, err
+    }
+    return c, nil
+}
+
+// readFile decodes a config file over c. The format follows the extension.
+// Unknown keys are errors, so that typos do not go unnoticed.
+func (c *Config) readFile(path string) error {
+    b, err := os.ReadFile(path)
+    if err != nil {
+        return err
+    }
+    var tree map[string]any
+    switch ext := strings.ToLower(filepath.Ext(path)); ext {
+    case ".json":
+        err = json.Unmarshal(b, &tree)
+    case ".yaml", ".yml":
+        tree, err = parseYAML(b)
+    case ".toml":
+        tree, err = parseTOML(b)
+    default:
+        return fmt.Errorf("%s: unknown config format %q (want .json, .yaml, .yml or .toml)", path, ext)
+    }
+    if err != nil {
+        return fmt.Errorf("%s: %w", path, err)
+    }
+    // Going through JSON gives all three formats the same field names and
+    // type checks.
+    js, err := json.Marshal(tree)
+    if err != nil {
+        return fmt.Errorf("%s: %w", path, err)
+    }
+    dec := json.NewDecoder(bytes.NewReader(js))
+    dec.DisallowUnknownFields()
+    if err := dec.Decode(c); err != nil {
+        return fmt.Errorf("%s: %w", path, err)
+    }
+    c.file = path
+    for _, key := range flatten("", tree) {
+        if _, ok := lookup(key); ok {
+            c.sources[key] = "file"
+        }
+    }
+    return nil
+}
+
+// flatten returns the dotted keys of the leaves of tree.
+func flatten(prefix string, tree map[string]any) []string {
+    var keys []string
+    for k, v := range tree {
+        if sub, ok := v.(map[string]any); ok {
+            keys = append(keys, flatten(prefix+k+".", sub)...)
+            continue
+        }
+        keys = append(keys, prefix+k)
+    }
+    return keys
+}
+
+// Print writes every setting with its effective value and source, one per
+// line. Secrets are masked.
+func (c *Config) Print(w io.Writer) {
+    if c.file != "" {
+        fmt.Fprintf(w, "# config file: %s\n", c.file)
+    }
+    for _, s := range settings {
+        key := s.key
+        v := c.get(key)
+        if s.secret && v != "" {
+            v = "********"
+        }
+        src := c.sources[key]
+        if src == "" {
+            src = "default"
+        }
+        fmt.Fprintf(w, "%-22s = %-24s # %s (env %s)\n", key, strconv.Quote(v), src, envName(key))
+    }
+}
+
+// Command handles the "config" subcommand shared by every command: with
+// args "config print" it prints c to stdout. It reports whether args were a
+// config subcommand.
+func Command(c *Config, args []string) (bool, error) {
+    if len(args) == 0 || args[0] != "config" {
+        return false, nil
+    }
+    if len(args) != 2 || args[1] != "print" {
+        return true, fmt.Errorf("usage: config print")
+    }
+    c.Print(os.Stdout)
+    return true, nil
+}
@@ -0,0 +1,340 @@
+package config
+
+import (
+    "bufio"
+    "bytes"
+    "encoding/json"
+    "fmt"
+    "strconv"
+    "strings"
+)
+
+// Config files are read by the small parsers below rather than a YAML or
+// TOML library: the only dependency of the module is the SQLite driver,
+// linked in with -tags sqlite, and the default build has none. They cover
+// what a config file needs: nested mappings or tables of strings, numbers,
+// booleans and lists of those. Anchors, multi-line strings, inline tables
+// and arrays of tables are not supported. parse_test.go pins down the
+// accepted syntax.
+
+type yamlLine struct {
+    n      int // line number
+    indent int
+    text   string
+}
+
+// parseYAML parses block mappings nested by indentation, "- item" and
+// [a, b] lists, and plain, single- or double-quoted scalars.
+func parseYAML(b []byte) (map[string]any, error) {
+    var lines []yamlLine
+    sc := bufio.NewScanner(bytes.NewReader(b))
+    for n := 1; sc.Scan(); n++ {
+        raw := strings.TrimRight(stripComment(sc.Text()), " \t\r")
+        text := strings.TrimLeft(raw, " ")
+        if text == "" || text == "---" {
+            continue
+        }
+        if strings.HasPrefix(text, "\t") {
+            return nil, fmt.Errorf("line %d: tabs are not allowed for indentation", n)
+        }
+        lines = append(lines, yamlLine{n: n, indent: len(raw) - len(text), text: text})
+    }
+    if err := sc.Err(); err != nil {
+        return nil, err
+    }
+    if len(lines) == 0 {
+        return map[string]any{}, nil
+    }
+    if isItem(lines[0]) {
+        return nil, fmt.Errorf("line %d: the top level must be a mapping", lines[0].n)
+    }
+    v, next, err := yamlBlock(lines, 0, lines[0].indent)
+    if err != nil {
+        return nil, err
+    }
+    if next < len(lines) {
+        return nil, fmt.Errorf("line %d: bad indentation", lines[next].n)
+    }
+    return v.(map[string]any), nil
+}
+
+func isItem(l yamlLine) bool { return l.text == "-" || strings.HasPrefix(l.text, "- ") }
+
+// yamlBlock parses the mapping or list whose lines start at lines[i] with
+// the given indentation. It returns the value and the index of the first
+// line after it.
+func yamlBlock(lines []yamlLine, i, indent int) (any, int, error) {
+    if isItem(lines[i]) {
+        var list []any
+        for ; i < len(lines) && lines[i].indent == indent && isItem(lines[i]); i++ {
+            if i+1 < len(lines) && lines[i+1].indent > indent {
+                return nil, 0, fmt.Errorf("line %d: nested list items are not supported", lines[i+1].n)
+            }
+            v, err := yamlScalar(strings.TrimSpace(strings.TrimPrefix(lines[i].text, "-")))
+            if err != nil {
+                return nil, 0, fmt.Errorf("line %d: %w", lines[i].n, err)
+            }
+            list = append(list, v)
+        }
+        return list, i, nil
+    }
+    m := map[string]any{}
+    for i < len(lines) && lines[i].indent == indent && !isItem(lines[i]) {
+        l := lines[i]
+        key, value, ok := strings.Cut(l.text, ":")
+        if !ok || (value != "" && value[0] != ' ') {
+            return nil, 0, fmt.Errorf("line %d: want key: value", l.n)
+        }
+        key = unquoteKey(strings.TrimSpace(key))
+        if _, dup := m[key]; dup {
+            return nil, 0, fmt.Errorf("line %d: duplicate key %q", l.n, key)
+        }
+        i++
+        if value = strings.TrimSpace(value); value != "" {
+            v, err := yamlScalar(value)
+            if err != nil {
+                return nil, 0, fmt.Errorf("line %d: %w", l.n, err)
+            }
+            m[key] = v
+            continue
+        }
+        // "key:" alone: a nested block, a list at the same indentation, or
+        // an empty value.
+        switch {
+        case i < len(lines) && lines[i].indent > indent,
+            i < len(lines) && lines[i].indent == indent && isItem(lines[i]):
+            v, next, err := yamlBlock(lines, i, lines[i].indent)
+            if err != nil {
+                return nil, 0, err
+            }
+            m[key], i = v, next
+        default:
+            m[key] = ""
+        }
+    }
+    if i < len(lines) && lines[i].indent > indent {
+        return nil, 0, fmt.Errorf("line %d: bad indentation", lines[i].n)
+    }
+    return m, i, nil
+}
+
+func unquoteKey(k string) string {
+    if v, err := yamlScalar(k); err == nil {
+        if s, ok := v.(string); ok {
+            return s
+        }
+    }
+    return k
+}
+
+// yamlScalar parses a plain, quoted or [flow, list] value.
+func yamlScalar(s string) (any, error) {
+    switch {
+    case s == "":
+        return "", nil
+    case s[0] == '"':
+        v, err := strconv.Unquote(s)
+        if err != nil {
+            return nil, fmt.Errorf("bad double-quoted string %s", s)
+        }
+        return v, nil
+    case s[0] == '\'':
+        if len(s) < 2 || s[len(s)-1] != '\'' {
+            return nil, fmt.Errorf("bad single-quoted string %s", s)
+        }
+        return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+    case s[0] == '[':
+        if s[len(s)-1] != ']' {
+            return nil, fmt.Errorf("unterminated list %s", s)
+        }
+        var list []any
+        for _, item := range splitList(s[1 : len(s)-1]) {
+            v, err := yamlScalar(item)
+            if err != nil {
+                return nil, err
+            }
+            list = append(list, v)
+        }
+        return list, nil
+    case s == "{}":
+        return map[string]any{}, nil
+    case s[0] == '{' || s[0] == '&' || s[0] == '*' || s[0] == '|' || s[0] == '>':
+        return nil, fmt.Errorf("unsupported YAML value %s", s)
+    }
+    switch s {
+    case "true", "True", "TRUE", "yes", "on":
+        return true, nil
+    case "false", "False", "FALSE", "no", "off":
+        return false, nil
+    case "null", "~":
+        return nil, nil
+    }
+    return number(s), nil
+}
+
+// number returns s as an integer or float when it is one, else s.
+func number(s string) any {
+    if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+        return n
+    }
+    if f, err := strconv.ParseFloat(s, 64); err == nil {
+        return f
+    }
+    return s
+}
+
+// parseTOML parses [table] and [dotted.table] headers and key = value pairs
+// whose keys may be dotted, with basic and literal strings, integers,
+// floats, booleans and single-line arrays.
+func parseTOML(b []byte) (map[string]any, error) {
+    root := map[string]any{}
+    table := root
+    sc := bufio.NewScanner(bytes.NewReader(b))
+    for n := 1; sc.Scan(); n++ {
+        line := strings.TrimSpace(stripComment(sc.Text()))
+        if line == "" {
+            continue
+        }
+        if line[0] == '[' {
+            if strings.HasPrefix(line, "[[") || line[len(line)-1] != ']' {
+                return nil, fmt.Errorf("line %d: unsupported table header %s", n, line)
+            }
+            t, err := tomlTable(root, line[1:len(line)-1])
+            if err != nil {
+                return nil, fmt.Errorf("line %d: %w", n, err)
+            }
+            table = t
+            continue
+        }
+        key, value, ok := strings.Cut(line, "=")
+        if !ok {
+            return nil, fmt.Errorf("line %d: want key = value", n)
+        }
+        parts := strings.Split(strings.TrimSpace(key), ".")
+        t, err := tomlTable(table, strings.Join(parts[:len(parts)-1], "."))
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", n, err)
+        }
+        k := unquoteKey(strings.TrimSpace(parts[len(parts)-1]))
+        if _, dup := t[k]; dup {
+            return nil, fmt.Errorf("line %d: duplicate key %q", n, k)
+        }
+        v, err := tomlValue(strings.TrimSpace(value))
+        if err != nil {
+            return nil, fmt.Errorf("line %d: %w", n, err)
+        }
+        t[k] = v
+    }
+    return root, sc.Err()
+}
+
+// tomlTable returns the table at the dotted path below t, creating it.
+func tomlTable(t map[string]any, path string) (map[string]any, error) {
+    if strings.TrimSpace(path) == "" {
+        return t, nil
+    }
+    for _, p := range strings.Split(path, ".") {
+        p = unquoteKey(strings.TrimSpace(p))
+        switch sub := t[p].(type) {
+        case map[string]any:
+            t = sub
+        case nil:
+            m := map[string]any{}
+            t[p] = m
+            t = m
+        default:
+            return nil, fmt.Errorf("%s is a value, not a table", p)
+        }
+    }
+    return t, nil
+}
+
+func tomlValue(s string) (any, error) {
+    switch {
+    case s == "":
+        return nil, fmt.Errorf("missing value")
+    case s[0] == '"':
+        var v string
+        if err := json.Unmarshal([]byte(s), &v); err != nil {
+            return nil, fmt.Errorf("bad string %s", s)
+        }
+        return v, nil
+    case s[0] == '\'':
+        if len(s) < 2 || s[len(s)-1] != '\'' {
+            return nil, fmt.Errorf("bad literal string %s", s)
+        }
+        return s[1 : len(s)-1], nil
+    case s[0] == '[':
+        if s[len(s)-1] != ']' {
+            return nil, fmt.Errorf("arrays must be on one line: %s", s)
+        }
+        list := []any{}
+        for _, item := range splitList(s[1 : len(s)-1]) {
+            v, err := tomlValue(item)
+            if err != nil {
+                return nil, err
+            }
+            list = append(list, v)
+        }
+        return list, nil
+    case s == "true":
+        return true, nil
+    case s == "false":
+        return false, nil
+    }
+    v := number(strings.ReplaceAll(s, "_", ""))
+    if _, isString := v.(string); isString {
+        return nil, fmt.Errorf("unsupported value %s (strings must be quoted)", s)
+    }
+    return v, nil
+}
+
+// splitList splits the inside of [a, "b, c", d] at top-level commas.
+// A trailing comma is allowed.
+func splitList(s string) []string {
+    var items []string
+    var quote byte
+    start := 0
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        switch {
+        case quote != 0:
+            if c == '\\' && quote == '"' {
+                i++
+            } else if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == ',':
+            items = append(items, strings.TrimSpace(s[start:i]))
+            start = i + 1
+        }
+    }
+    if last := strings.TrimSpace(s[start:]); last != "" {
+        items = append(items, last)
+    }
+    return items
+}
+
+// stripComment removes a # comment that is not inside quotes. In YAML a
+// comment must follow whitespace, which holds for the values used here.
+func stripComment(line string) string {
+    var quote byte
+    for i := 0; i < len(line); i++ {
+        c := line[i]
+        switch {
+        case quote != 0:
+            if c == '\\' && quote == '"' {
+                i++
+            } else if c == quote {
+                quote = 0
+            }
+        case c == '"' || c == '\'':
+            quote = c
+        case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+            return line[:i]
+        }
+    }
+    return line
+}
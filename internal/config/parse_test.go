@@ -0,0 +1,251 @@
+package config
+
+import (
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+func TestParseYAML(t *testing.T) {
+    tests := []struct {
+        name string
+        in   string
+        want map[string]any
+        err  string // substring of the error; "" means success
+    }{
+        {name: "empty", in: "", want: map[string]any{}},
+        {name: "document marker only", in: "---\n", want: map[string]any{}},
+        {
+            name: "comments",
+            in:   "# heading\na: 1 # trailing\n  # indented comment\nb: x\n",
+            want: map[string]any{"a": int64(1), "b": "x"},
+        },
+        {
+            name: "hash without space is not a comment",
+            in:   "a: x#y\n",
+            want: map[string]any{"a": "x#y"},
+        },
+        {
+            name: "hash inside quotes",
+            in:   "a: \"x # y\"\nb: 'p # q' # real comment\n",
+            want: map[string]any{"a": "x # y", "b": "p # q"},
+        },
+        {
+            name: "quoted values",
+            in:   "a: \":8080\"\nb: 'it''s'\nc: \"tab\\tq\\\"\"\nd: \"\"\n",
+            want: map[string]any{"a": ":8080", "b": "it's", "c": "tab\tq\"", "d": ""},
+        },
+        {
+            name: "quoted keys",
+            in:   "\"a b\": 1\n'c': 2\n",
+            want: map[string]any{"a b": int64(1), "c": int64(2)},
+        },
+        {
+            name: "scalars",
+            in:   "t: yes\nf: off\nn: ~\ni: -3\nx: 1.5\ns: 0x1F\n",
+            want: map[string]any{"t": true, "f": false, "n": nil, "i": int64(-3), "x": 1.5, "s": "0x1F"},
+        },
+        {
+            name: "durations stay strings",
+            in:   "d: 10s\ne: \"1m30s\"\n",
+            want: map[string]any{"d": "10s", "e": "1m30s"},
+        },
+        {
+            name: "nested mappings",
+            in:   "api:\n  addr: \":8080\"\n  tls:\n    cert_file: c.pem\n  max_page_size: 10\nlog:\n  level: debug\n",
+            want: map[string]any{
+                "api": map[string]any{"addr": ":8080", "tls": map[string]any{"cert_file": "c.pem"}, "max_page_size": int64(10)},
+                "log": map[string]any{"level": "debug"},
+            },
+        },
+        {
+            name: "lists",
+            in:   "a:\n  - x\n  - \"*\"\nb:\n- 1\n- 2\nc: [1, 'p, q', \"r\",]\nd: []\n",
+            want: map[string]any{"a": []any{"x", "*"}, "b": []any{int64(1), int64(2)}, "c": []any{int64(1), "p, q", "r"}, "d": []any(nil)},
+        },
+        {name: "empty value", in: "a:\nb: 1\n", want: map[string]any{"a": "", "b": int64(1)}},
+        {name: "empty mapping", in: "a: {}\n", want: map[string]any{"a": map[string]any{}}},
+        {name: "tab indentation", in: "a:\n\tb: 1\n", err: "tabs are not allowed"},
+        {name: "duplicate key", in: "a: 1\na: 2\n", err: `duplicate key "a"`},
+        {name: "top-level list", in: "- a\n", err: "top level must be a mapping"},
+        {name: "bad indentation", in: "a:\n    b: 1\n  c: 2\n", err: "bad indentation"},
+        {name: "missing space after colon", in: "a:b\n", err: "want key: value"},
+        {name: "unterminated double quote", in: "a: \"x\n", err: "bad double-quoted string"},
+        {name: "unterminated single quote", in: "a: 'x\n", err: "bad single-quoted string"},
+        {name: "unterminated flow list", in: "a: [1, 2\n", err: "unterminated list"},
+        {name: "anchor", in: "a: &x 1\n", err: "unsupported YAML value"},
+        {name: "block scalar", in: "a: |\n", err: "unsupported YAML value"},
+        {name: "nested list", in: "a:\n  - x\n    - y\n", err: "nested list items"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := parseYAML([]byte(tt.in))
+            checkParse(t, got, err, tt.want, tt.err)
+        })
+    }
+}
+
+func TestParseTOML(t *testing.T) {
+    tests := []struct {
+        name string
+        in   string
+        want map[string]any
+        err  string
+    }{
+        {name: "empty", in: "", want: map[string]any{}},
+        {
+            name: "comments",
+            in:   "# heading\nstrict = true # trailing\n\n  # indented\n",
+            want: map[string]any{"strict": true},
+        },
+        {
+            name: "hash inside strings",
+            in:   "a = \"x # y\"\nb = 'p # q' # real comment\n",
+            want: map[string]any{"a": "x # y", "b": "p # q"},
+        },
+        {
+            name: "strings",
+            in:   "a = \":8080\"\nb = 'C:\\path'\nc = \"tab\\tq\\\"\\u00e9\"\n",
+            want: map[string]any{"a": ":8080", "b": `C:\path`, "c": "tab\tq\"é"},
+        },
+        {
+            name: "numbers",
+            in:   "a = 1_000\nb = -2\nc = 0.5\n",
+            want: map[string]any{"a": int64(1000), "b": int64(-2), "c": 0.5},
+        },
+        {
+            name: "tables and dotted keys",
+            in:   "books_dir = \"b\"\n[api]\naddr = \":9090\"\ntls.cert_file = \"c.pem\"\n[api.tls]\nkey_file = \"k.pem\"\n[log]\nlevel = \"warn\"\n",
+            want: map[string]any{
+                "books_dir": "b",
+                "api":       map[string]any{"addr": ":9090", "tls": map[string]any{"cert_file": "c.pem", "key_file": "k.pem"}},
+                "log":       map[string]any{"level": "warn"},
+            },
+        },
+        {
+            name: "durations stay strings",
+            in:   "[api]\nreload_interval = \"30s\"\n",
+            want: map[string]any{"api": map[string]any{"reload_interval": "30s"}},
+        },
+        {
+            name: "arrays",
+            in:   "a = [\"x\", 'y, z', 3,]\nb = []\n",
+            want: map[string]any{"a": []any{"x", "y, z", int64(3)}, "b": []any{}},
+        },
+        {name: "bare string", in: "a = info\n", err: "strings must be quoted"},
+        {name: "missing value", in: "a =\n", err: "missing value"},
+        {name: "no equals sign", in: "a\n", err: "want key = value"},
+        {name: "duplicate key", in: "a = 1\na = 2\n", err: `duplicate key "a"`},
+        {name: "array of tables", in: "[[api]]\n", err: "unsupported table header"},
+        {name: "value used as table", in: "api = 1\n[api]\n", err: "is a value, not a table"},
+        {name: "multi-line array", in: "a = [\n1]\n", err: "arrays must be on one line"},
+        {name: "bad string", in: "a = \"x\n", err: "bad string"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := parseTOML([]byte(tt.in))
+            checkParse(t, got, err, tt.want, tt.err)
+        })
+    }
+}
+
+func checkParse(t *testing.T, got map[string]any, err error, want map[string]any, wantErr string) {
+    t.Helper()
+    if wantErr != "" {
+        if err == nil || !strings.Contains(err.Error(), wantErr) {
+            t.Fatalf("error = %v, want one containing %q", err, wantErr)
+        }
+        return
+    }
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("got  %#v\nwant %#v", got, want)
+    }
+}
+
+// TestReadFile decodes the same settings from each format into a Config.
+func TestReadFile(t *testing.T) {
+    files := map[string]string{
+        "c.yaml": "api:\n  addr: \":9090\"   # comment\n  reload_interval: 30s\n  cache_max_age: \"5m\"\n  cors_origins: [\"https://a.example\"]\nstrict: yes\n",
+        "c.toml": "strict = true\n[api]\naddr = \":9090\" # comment\nreload_interval = \"30s\"\ncache_max_age = '5m'\ncors_origins = [\"https://a.example\"]\n",
+        "c.json": `{"strict": true, "api": {"addr": ":9090", "reload_interval": "30s", "cache_max_age": "5m", "cors_origins": ["https://a.example"]}}`,
+    }
+    for name, content := range files {
+        t.Run(name, func(t *testing.T) {
+            c := readConfig(t, name, content)
+            if c.err != nil {
+                t.Fatal(c.err)
+            }
+            if !c.Strict || c.API.Addr != ":9090" || len(c.API.CORSOrigins) != 1 || c.API.CORSOrigins[0] != "https://a.example" {
+                t.Errorf("got strict=%v addr=%q cors=%q", c.Strict, c.API.Addr, c.API.CORSOrigins)
+            }
+            if got := time.Duration(c.API.ReloadInterval); got != 30*time.Second {
+                t.Errorf("reload_interval = %v, want 30s", got)
+            }
+            if got := time.Duration(c.API.CacheMaxAge); got != 5*time.Minute {
+                t.Errorf("cache_max_age = %v, want 5m", got)
+            }
+            if src := c.sources["api.reload_interval"]; src != "file" {
+                t.Errorf("source of api.reload_interval = %q, want file", src)
+            }
+            // Defaults survive for keys the file leaves out.
+            if c.API.MaxPageSize != 200 {
+                t.Errorf("max_page_size = %d, want the default 200", c.API.MaxPageSize)
+            }
+        })
+    }
+
+    errors := []struct{ name, content, err string }{
+        {"bad-duration.yaml", "api:\n  reload_interval: 10 parsecs\n", "invalid duration"},
+        {"negative-duration.toml", "[api]\nreload_interval = \"-5s\"\n", "invalid duration"},
+        {"number-duration.toml", "[api]\ncache_max_age = 30\n", "duration must be a string"},
+        {"unknown-key.yaml", "api:\n  adress: \":1\"\n", "unknown field"},
+        {"wrong-type.yaml", "api:\n  max_page_size: many\n", "max_page_size"},
+        {"c.ini", "a=1\n", "unknown config format"},
+    }
+    for _, tt := range errors {
+        t.Run(tt.name, func(t *testing.T) {
+            c := readConfig(t, tt.name, tt.content)
+            if c.err == nil || !strings.Contains(c.err.Error(), tt.err) {
+                t.Fatalf("error = %v, want one containing %q", c.err, tt.err)
+            }
+        })
+    }
+}
+
+// TestExampleConfig keeps hadith.example.yaml loadable and equal to the
+// defaults it documents.
+func TestExampleConfig(t *testing.T) {
+    c := Default()
+    c.sources = map[string]string{}
+    if err := c.readFile(filepath.Join("..", "..", "hadith.example.yaml")); err != nil {
+        t.Fatal(err)
+    }
+    c.file, c.sources = "", nil
+    if want := Default(); !reflect.DeepEqual(c, want) {
+        t.Errorf("example config differs from the defaults:\n got  %+v\n want %+v", c, want)
+    }
+}
+
+type readResult struct {
+    *Config
+    err error
+}
+
+// readConfig writes content to a file called name and reads it over the
+// defaults.
+func readConfig(t *testing.T, name, content string) readResult {
+    t.Helper()
+    path := filepath.Join(t.TempDir(), name)
+    if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    c := Default()
+    c.sources = map[string]string{}
+    return readResult{Config: c, err: c.readFile(path)}
+}
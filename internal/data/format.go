@@ -0,0 +1,228 @@
+package data
+
+import (
+    "compress/gzip"
+    "encoding/csv"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io"
+    "io/fs"
+    "path/filepath"
+    "strconv"
+    "strings"
+)
+
+// Record is one hadith as stored in a book file.
+type Record struct {
+    Number  int            `json:"number"`
+    Arab    string         `json:"arab"`
+    ID      string         `json:"id"`
+    Kitab   string         `json:"kitab,omitempty"`
+    Bab     string         `json:"bab,omitempty"`
+    Grade   string         `json:"grade,omitempty"`
+    Numbers map[string]int `json:"numbers,omitempty"`
+    // Translations other than Indonesian, keyed by language code.
+    Translations map[string]string `json:"translations,omitempty"`
+}
+
+// DecodeFunc reads the records of a book file from r, in file order, and
+// calls fn for each. It stops at the first error, from the input or from fn.
+// Errors should say where in the input they occurred.
+type DecodeFunc func(r io.Reader, fn func(Record) error) error
+
+// formats maps a lower-case file extension to its decoder.
+var formats = map[string]DecodeFunc{
+    ".json":   decodeJSON,
+    ".jsonl":  decodeJSONLines,
+    ".ndjson": decodeJSONLines,
+    ".csv":    decodeCSV,
+}
+
+// RegisterFormat makes book files with the extension ext (such as ".xml")
+// loadable with dec. A ".gz" suffix on top of any registered extension is
+// always accepted and decompressed first. RegisterFormat is meant to be
+// called from an init function; it replaces any decoder for ext.
+func RegisterFormat(ext string, dec DecodeFunc) {
+    formats[strings.ToLower(ext)] = dec
+}
+
+// splitFormat splits a book file name such as "malik.jsonl.gz" into the
+// book name, the format extension and whether the file is gzipped. ok is
+// false when no registered format matches.
+func splitFormat(file string) (book, ext string, gz, ok bool) {
+    name := file
+    if strings.HasSuffix(strings.ToLower(name), ".gz") {
+        name, gz = name[:len(name)-len(".gz")], true
+    }
+    ext = strings.ToLower(filepath.Ext(name))
+    if _, ok := formats[ext]; !ok || len(ext) == len(name) {
+        return "", "", false, false
+    }
+    return name[:len(name)-len(ext)], ext, gz, true
+}
+
+// openBook opens the book file name in src, decompressing it when gzipped,
+// and returns it with the decoder for its format.
+func openBook(src source, name string) (io.ReadCloser, DecodeFunc, error) {
+    _, ext, gz, ok := splitFormat(name)
+    if !ok {
+        return nil, nil, fmt.Errorf("%s: unknown book format", src.path(name))
+    }
+    f, err := src.fsys.Open(name)
+    if err != nil {
+        return nil, nil, fmt.Errorf("open %s: %w", src.path(name), err)
+    }
+    if !gz {
+        return f, formats[ext], nil
+    }
+    zr, err := gzip.NewReader(f)
+    if err != nil {
+        f.Close()
+        return nil, nil, fmt.Errorf("open %s: %w", src.path(name), err)
+    }
+    return gzipFile{zr, f}, formats[ext], nil
+}
+
+// gzipFile closes both the decompressor and the file underneath.
+type gzipFile struct {
+    *gzip.Reader
+    f fs.File
+}
+
+func (g gzipFile) Close() error {
+    err := g.Reader.Close()
+    if cerr := g.f.Close(); err == nil {
+        err = cerr
+    }
+    return err
+}
+
+// decodeJSON reads a JSON array of records without holding it in memory.
+func decodeJSON(r io.Reader, fn func(Record) error) error {
+    dec := json.NewDecoder(r)
+    tok, err := dec.Token()
+    if err != nil {
+        return err
+    }
+    if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+        return errors.New("expected JSON array")
+    }
+    for i := 0; dec.More(); i++ {
+        var rec Record
+        if err := dec.Decode(&rec); err != nil {
+            return fmt.Errorf("entry %d: %w", i, err)
+        }
+        if err := fn(rec); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// decodeJSONLines reads one JSON record per line (JSON Lines / NDJSON).
+// Blank lines are skipped.
+func decodeJSONLines(r io.Reader, fn func(Record) error) error {
+    dec := json.NewDecoder(r)
+    for i := 0; ; i++ {
+        var rec Record
+        if err := dec.Decode(&rec); err != nil {
+            if errors.Is(err, io.EOF) {
+                return nil
+            }
+            return fmt.Errorf("record %d: %w", i, err)
+        }
+        if err := fn(rec); err != nil {
+            return err
+        }
+    }
+}
+
+// decodeCSV reads a CSV file whose header names the column of each field:
+// number, arab, id, kitab, bab and grade, plus numbers.<edition> and
+// translations.<lang> (or just <lang>) for the maps. Empty optional cells
+// are left unset.
+func decodeCSV(r io.Reader, fn func(Record) error) error {
+    cr := csv.NewReader(r)
+    header, err := cr.Read()
+    if err != nil {
+        if errors.Is(err, io.EOF) {
+            return nil
+        }
+        return err
+    }
+    if len(header) > 0 {
+        header[0] = strings.TrimPrefix(header[0], "\ufeff") // spreadsheet BOM
+    }
+    cols := make([]string, len(header))
+    hasNumber := false
+    for i, h := range header {
+        col := strings.ToLower(strings.TrimSpace(h))
+        switch {
+        case col == "number":
+            hasNumber = true
+        case col == "arab" || col == "id" || col == "kitab" || col == "bab" || col == "grade":
+        case strings.HasPrefix(col, "numbers.") && len(col) > len("numbers."):
+        case strings.HasPrefix(col, "translations.") && len(col) > len("translations."):
+        default:
+            if _, _, ok := splitLang("x." + col); !ok {
+                return fmt.Errorf("header: unknown column %q", h)
+            }
+            col = "translations." + col
+        }
+        cols[i] = col
+    }
+    if !hasNumber {
+        return errors.New("header: missing number column")
+    }
+    for {
+        row, err := cr.Read()
+        if errors.Is(err, io.EOF) {
+            return nil
+        }
+        if err != nil {
+            return err
+        }
+        line, _ := cr.FieldPos(0)
+        var rec Record
+        for i, cell := range row {
+            col := cols[i]
+            switch {
+            case col == "number":
+                n, err := strconv.Atoi(strings.TrimSpace(cell))
+                if err != nil {
+                    return fmt.Errorf("line %d: number %q is not an integer", line, cell)
+                }
+                rec.Number = n
+            case col == "arab":
+                rec.Arab = cell
+            case col == "id":
+                rec.ID = cell
+            case col == "kitab":
+                rec.Kitab = cell
+            case col == "bab":
+                rec.Bab = cell
+            case col == "grade":
+                rec.Grade = cell
+            case cell == "":
+            case strings.HasPrefix(col, "numbers."):
+                n, err := strconv.Atoi(strings.TrimSpace(cell))
+                if err != nil {
+                    return fmt.Errorf("line %d: %s %q is not an integer", line, col, cell)
+                }
+                if rec.Numbers == nil {
+                    rec.Numbers = map[string]int{}
+                }
+                rec.Numbers[strings.TrimPrefix(col, "numbers.")] = n
+            default:
+                if rec.Translations == nil {
+                    rec.Translations = map[string]string{}
+                }
+                rec.Translations[strings.TrimPrefix(col, "translations.")] = cell
+            }
+        }
+        if err := fn(rec); err != nil {
+            return err
+        }
+    }
+}
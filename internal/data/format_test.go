@@ -0,0 +1,235 @@
+package data
+
+import (
+    "bufio"
+    "bytes"
+    "compress/gzip"
+    "encoding/json"
+    "io"
+    "reflect"
+    "strconv"
+    "strings"
+    "testing"
+    "testing/fstest"
+)
+
+var testRecords = []Record{
+    {Number: 1, Arab: "إنما الأعمال بالنيات", ID: "Amal itu tergantung niat", Kitab: "Iman", Grade: "sahih",
+        Numbers: map[string]int{"fuad": 11}, Translations: map[string]string{"en": "Deeds are by intentions"}},
+    {Number: 2, Arab: "الصلاة", ID: "Shalat, \"lima\" waktu\nsehari", Bab: "Shalat"},
+    {Number: 10, Arab: "الزكاة", ID: "Zakat"},
+}
+
+// encodeBook writes records in the format of ext.
+func encodeBook(t *testing.T, ext string, records []Record) []byte {
+    t.Helper()
+    var b bytes.Buffer
+    switch ext {
+    case ".json":
+        if err := json.NewEncoder(&b).Encode(records); err != nil {
+            t.Fatal(err)
+        }
+    case ".jsonl", ".ndjson":
+        for _, r := range records {
+            if err := json.NewEncoder(&b).Encode(r); err != nil {
+                t.Fatal(err)
+            }
+            b.WriteString("\n") // blank lines are skipped
+        }
+    case ".csv":
+        b.WriteString("\ufeffnumber,arab,id,kitab,bab,grade,numbers.fuad,translations.en\n")
+        for _, r := range records {
+            fuad := ""
+            if n, ok := r.Numbers["fuad"]; ok {
+                fuad = strconv.Itoa(n)
+            }
+            cells := []string{strconv.Itoa(r.Number), r.Arab, r.ID, r.Kitab, r.Bab, r.Grade, fuad, r.Translations["en"]}
+            for i, c := range cells {
+                if strings.ContainsAny(c, "\",\n") {
+                    cells[i] = `"` + strings.ReplaceAll(c, `"`, `""`) + `"`
+                }
+            }
+            b.WriteString(strings.Join(cells, ",") + "\n")
+        }
+    default:
+        t.Fatalf("no encoder for %s", ext)
+    }
+    return b.Bytes()
+}
+
+func gzipped(t *testing.T, data []byte) []byte {
+    t.Helper()
+    var b bytes.Buffer
+    zw := gzip.NewWriter(&b)
+    if _, err := zw.Write(data); err != nil {
+        t.Fatal(err)
+    }
+    if err := zw.Close(); err != nil {
+        t.Fatal(err)
+    }
+    return b.Bytes()
+}
+
+func TestDecoders(t *testing.T) {
+    for _, ext := range []string{".json", ".jsonl", ".ndjson", ".csv"} {
+        for _, gz := range []bool{false, true} {
+            name := "malik" + ext
+            content := encodeBook(t, ext, testRecords)
+            if gz {
+                name += ".gz"
+                content = gzipped(t, content)
+            }
+            t.Run(name, func(t *testing.T) {
+                src := source{fsys: fstest.MapFS{name: {Data: content}}}
+                f, dec, err := openBook(src, name)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                defer f.Close()
+                var got []Record
+                if err := dec(f, func(r Record) error { got = append(got, r); return nil }); err != nil {
+                    t.Fatal(err)
+                }
+                if !reflect.DeepEqual(got, testRecords) {
+                    t.Errorf("decoded %+v\nwant %+v", got, testRecords)
+                }
+            })
+        }
+    }
+}
+
+// TestLoadFormats loads a book of each format into a Store.
+func TestLoadFormats(t *testing.T) {
+    fsys := fstest.MapFS{
+        "a.json":     {Data: encodeBook(t, ".json", testRecords)},
+        "b.jsonl.gz": {Data: gzipped(t, encodeBook(t, ".jsonl", testRecords))},
+        "c.CSV":      {Data: encodeBook(t, ".csv", testRecords)},
+        "d.csv.GZ":   {Data: gzipped(t, encodeBook(t, ".csv", testRecords))},
+        "README.md":  {Data: []byte("not a book")},
+    }
+    s, err := NewStoreFS(fsys)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got, want := s.Books(), []string{"a", "b", "c", "d"}; !reflect.DeepEqual(got, want) {
+        t.Fatalf("books = %q, want %q", got, want)
+    }
+    for _, book := range s.Books() {
+        h, ok := s.Get(book, 1)
+        if !ok {
+            t.Fatalf("%s #1 missing", book)
+        }
+        if h.Book != book || h.ID != testRecords[0].ID || h.Text("en") != "Deeds are by intentions" {
+            t.Errorf("%s #1 = %+v", book, h)
+        }
+    }
+}
+
+func TestSplitFormat(t *testing.T) {
+    tests := []struct {
+        file, book, ext string
+        gz, ok          bool
+    }{
+        {"malik.json", "malik", ".json", false, true},
+        {"malik.jsonl.gz", "malik", ".jsonl", true, true},
+        {"Malik.CSV.GZ", "Malik", ".csv", true, true},
+        {"ibn.majah.ndjson", "ibn.majah", ".ndjson", false, true},
+        {"malik.txt", "", "", false, false},
+        {"malik.gz", "", "", false, false},
+        {".json", "", "", false, false},
+        {"README", "", "", false, false},
+    }
+    for _, tt := range tests {
+        book, ext, gz, ok := splitFormat(tt.file)
+        if book != tt.book || ext != tt.ext || gz != tt.gz || ok != tt.ok {
+            t.Errorf("splitFormat(%q) = %q, %q, %v, %v, want %q, %q, %v, %v",
+                tt.file, book, ext, gz, ok, tt.book, tt.ext, tt.gz, tt.ok)
+        }
+    }
+}
+
+func TestDecodeErrors(t *testing.T) {
+    tests := []struct {
+        name string
+        dec  DecodeFunc
+        in   string
+        err  string
+    }{
+        {"json object", decodeJSON, `{"number": 1}`, "expected JSON array"},
+        {"json bad entry", decodeJSON, `[{"number": 1}, {"number": "x"}]`, "entry 1"},
+        {"jsonl bad record", decodeJSONLines, "{\"number\": 1}\n{\"number\": \n", "record 1"},
+        {"csv no number", decodeCSV, "arab,id\nx,y\n", "missing number column"},
+        {"csv unknown column", decodeCSV, "number,colour\n1,red\n", `unknown column "colour"`},
+        {"csv bad number", decodeCSV, "number,id\n1,a\nx,b\n", `line 3: number "x"`},
+        {"csv bad edition number", decodeCSV, "number,numbers.fuad\n1,z\n", `numbers.fuad "z"`},
+        {"csv ragged row", decodeCSV, "number,id\n1\n", "wrong number of fields"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            err := tt.dec(strings.NewReader(tt.in), func(Record) error { return nil })
+            if err == nil || !strings.Contains(err.Error(), tt.err) {
+                t.Fatalf("error = %v, want one containing %q", err, tt.err)
+            }
+        })
+    }
+}
+
+func TestDecodeCSV(t *testing.T) {
+    // A bare language code is a translation column, empty cells stay unset
+    // and an empty file has no records.
+    in := "Number, ID ,en\n5,Lima,\n6,Enam,Six\n"
+    var got []Record
+    if err := decodeCSV(strings.NewReader(in), func(r Record) error { got = append(got, r); return nil }); err != nil {
+        t.Fatal(err)
+    }
+    want := []Record{{Number: 5, ID: "Lima"}, {Number: 6, ID: "Enam", Translations: map[string]string{"en": "Six"}}}
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("got %+v, want %+v", got, want)
+    }
+    if err := decodeCSV(strings.NewReader(""), func(Record) error { t.Error("record from empty file"); return nil }); err != nil {
+        t.Error(err)
+    }
+}
+
+func TestOpenBookCorruptGzip(t *testing.T) {
+    src := source{fsys: fstest.MapFS{"malik.json.gz": {Data: []byte("not gzip")}}, dir: "books"}
+    if _, _, err := openBook(src, "malik.json.gz"); err == nil || !strings.Contains(err.Error(), "books/malik.json.gz") {
+        t.Errorf("error = %v, want one naming the file", err)
+    }
+    data := gzipped(t, encodeBook(t, ".json", testRecords))
+    src.fsys = fstest.MapFS{"malik.json.gz": {Data: data[:len(data)/2]}}
+    f, dec, err := openBook(src, "malik.json.gz")
+    if err != nil {
+        t.Fatal(err)
+    }
+    defer f.Close()
+    if err := dec(f, func(Record) error { return nil }); err == nil {
+        t.Error("truncated gzip decoded without error")
+    }
+}
+
+func TestRegisterFormat(t *testing.T) {
+    // A tab-separated "number<TAB>id" format.
+    RegisterFormat(".TSVTEST", func(r io.Reader, fn func(Record) error) error {
+        sc := bufio.NewScanner(r)
+        for sc.Scan() {
+            num, id, _ := strings.Cut(sc.Text(), "\t")
+            n, err := strconv.Atoi(num)
+            if err != nil {
+                return err
+            }
+            if err := fn(Record{Number: n, ID: id}); err != nil {
+                return err
+            }
+        }
+        return sc.Err()
+    })
+    defer delete(formats, ".tsvtest")
+    s, err := NewStoreFS(fstest.MapFS{"x.tsvtest.gz": {Data: gzipped(t, []byte("3\tTiga\n4\tEmpat\n"))}})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if h, ok := s.Get("x", 4); !ok || h.ID != "Empat" {
+        t.Errorf("Get(x, 4) = %+v, %v", h, ok)
+    }
+}
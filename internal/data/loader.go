@@ -1,42 +1,142 @@
 package data
 
 import (
+    "crypto/sha256"
+    "encoding/binary"
+    "encoding/hex"
     "encoding/json"
     "errors"
     "fmt"
-    "io"
+    "io/fs"
     "os"
     "path/filepath"
     "sort"
     "strings"
     "sync"
+    "time"
+
+    "github.com/nuzlilatief/hadith-go/internal/search/index"
 )
 
 // Store loads and holds all hadiths from the books directory.
 type Store struct {
-    mu      sync.RWMutex
-    byBook  map[string][]Hadith
-    books   []string
-    rootDir string
+    mu     sync.RWMutex
+    byBook map[string][]Hadith
+    byNum  map[string]map[int]int // per book: hadith number -> position in byBook
+    // sorted holds each book ordered by number; it is byBook itself for
+    // books whose file is already in order.
+    sorted map[string][]Hadith
+    books  []string
+    all    []Hadith // every hadith in book order; index documents are positions in this slice
+    index  *index.Index
+    norm   []NormText // normalized text of each hadith in all
+    spans  []BookSpan // the documents of each book in all
+    langs  []string // translation languages present, sorted
+    info   map[string]BookInfo
+    // version identifies the loaded data; see Version.
+    version string
+    loaded  time.Time // see Loaded
+    // warnings holds the problems loadBook tolerated; see Warnings.
+    warnings []Problem
+    // chapters holds, per book, the chapters and the byBook range [start, end) of each.
+    chapters map[string][]chapterSpan
+    src      source
+    opts     Options
+}
+
+// source is where a Store reads its books from. dir names it in error
+// messages and is empty for a plain fs.FS.
+type source struct {
+    fsys fs.FS
+    dir  string
+}
+
+// path returns the name of file for error messages.
+func (src source) path(name string) string {
+    if src.dir == "" {
+        return name
+    }
+    return filepath.Join(src.dir, name)
 }
 
-// NewStore loads JSON files from booksDir. Filenames (without .json) are used as book names.
+// Options controls how a Store loads its books.
+type Options struct {
+    // Strict refuses to load a books directory in which Validate finds any
+    // problem, warnings included.
+    Strict bool
+    // IgnoreSnapshot reads the book files even when an up-to-date
+    // SnapshotFile is present.
+    IgnoreSnapshot bool
+}
+
+type chapterSpan struct {
+    Chapter
+    start, end int
+}
+
+// NewStore loads the book files in booksDir. Filenames without the format
+// extension are used as book names. Besides JSON arrays (.json), JSON Lines
+// (.jsonl, .ndjson), CSV (.csv), gzipped variants of these (.json.gz, ...)
+// and any format added with RegisterFormat are read.
+// A file named <book>.<lang>.json next to a book is a translation
+// companion rather than a book; see loadTranslations. ManifestFile, when
+// present, describes the books. An up-to-date SnapshotFile (see
+// BuildSnapshot) is loaded instead of the books.
 func NewStore(booksDir string) (*Store, error) {
-    st := &Store{byBook: map[string][]Hadith{}, rootDir: booksDir}
-    entries, err := os.ReadDir(booksDir)
-    if err != nil {
-        return nil, fmt.Errorf("read books dir: %w", err)
+    return NewStoreOptions(booksDir, Options{})
+}
+
+// NewStoreOptions is NewStore with loading options.
+func NewStoreOptions(booksDir string, opts Options) (*Store, error) {
+    return load(source{fsys: os.DirFS(booksDir), dir: booksDir}, opts)
+}
+
+// NewStoreFS is NewStore reading the books at the root of fsys, such as an
+// embedded dataset.
+func NewStoreFS(fsys fs.FS) (*Store, error) {
+    return NewStoreFSOptions(fsys, Options{})
+}
+
+// NewStoreFSOptions is NewStoreFS with loading options.
+func NewStoreFSOptions(fsys fs.FS, opts Options) (*Store, error) {
+    return load(source{fsys: fsys}, opts)
+}
+
+// load reads src into a new Store, from its snapshot when that is up to
+// date. A damaged snapshot is an error rather than a silent slow start.
+func load(src source, opts Options) (*Store, error) {
+    if !opts.IgnoreSnapshot {
+        st, err := loadSnapshot(src, opts)
+        switch {
+        case err == nil:
+            st.loaded = time.Now()
+            return st, nil
+        case !errors.Is(err, fs.ErrNotExist) && !errors.Is(err, errStaleSnapshot):
+            return nil, fmt.Errorf("%s: %w (rebuild it with hadith-cli index build or delete it)", SnapshotFile, err)
+        }
     }
-    for _, e := range entries {
-        if e.IsDir() {
-            continue
+    if opts.Strict {
+        problems, err := validate(src)
+        if err != nil {
+            return nil, err
         }
-        name := e.Name()
-        if !strings.HasSuffix(strings.ToLower(name), ".json") {
-            continue
+        if len(problems) > 0 {
+            return nil, &ValidationError{Problems: problems}
         }
-        book := strings.TrimSuffix(name, filepath.Ext(name))
-        if err := st.loadBook(filepath.Join(booksDir, name), book); err != nil {
+    }
+    st := &Store{byBook: map[string][]Hadith{}, byNum: map[string]map[int]int{}, chapters: map[string][]chapterSpan{}, src: src, opts: opts}
+    books, companions, err := listFiles(src)
+    if err != nil {
+        return nil, err
+    }
+    for _, name := range books {
+        if err := st.loadBook(src, name); err != nil {
+            return nil, err
+        }
+    }
+    for _, name := range companions {
+        book, lang, _ := splitLang(bookName(name))
+        if err := st.loadTranslations(src, name, book, lang); err != nil {
             return nil, err
         }
     }
@@ -45,48 +145,271 @@ func NewStore(booksDir string) (*Store, error) {
         st.books = append(st.books, b)
     }
     sort.Strings(st.books)
+    st.buildSorted()
+    st.buildIndex()
+    manifest, err := loadManifest(src)
+    if err != nil {
+        return nil, err
+    }
+    st.buildInfo(manifest)
+    st.buildVersion()
+    st.loaded = time.Now()
     return st, nil
 }
 
-func (s *Store) loadBook(path, book string) error {
-    f, err := os.Open(path)
+// listFiles returns the book files and translation companions in src,
+// in directory order. The manifest and files in unknown formats are
+// neither. Two files holding the same book are an error.
+func listFiles(src source) (books, companions []string, err error) {
+    entries, err := fs.ReadDir(src.fsys, ".")
     if err != nil {
-        return fmt.Errorf("open %s: %w", path, err)
+        if src.dir != "" {
+            return nil, nil, fmt.Errorf("read books dir %s: %w", src.dir, err)
+        }
+        return nil, nil, fmt.Errorf("read books dir: %w", err)
     }
-    defer f.Close()
-    dec := json.NewDecoder(f)
-    // File is an array of objects with fields number, arab, id
-    tok, err := dec.Token()
-    if err != nil {
-        return fmt.Errorf("decode %s: %w", path, err)
+    names := map[string]bool{}
+    var files []string
+    for _, e := range entries {
+        if e.IsDir() || e.Name() == ManifestFile {
+            continue
+        }
+        if _, _, _, ok := splitFormat(e.Name()); ok {
+            names[bookName(e.Name())] = true
+            files = append(files, e.Name())
+        }
     }
-    if delim, ok := tok.(json.Delim); !ok || delim != '[' {
-        return fmt.Errorf("%s: expected JSON array", path)
+    seen := map[string]string{}
+    for _, name := range files {
+        if isCompanion(name, names) {
+            companions = append(companions, name)
+            continue
+        }
+        book := bookName(name)
+        if other, dup := seen[book]; dup {
+            return nil, nil, fmt.Errorf("book %s is in both %s and %s", book, other, name)
+        }
+        seen[book] = name
+        books = append(books, name)
     }
-    var hadiths []Hadith
-    for dec.More() {
-        var raw struct {
-            Number int    `json:"number"`
-            Arab   string `json:"arab"`
-            ID     string `json:"id"`
-        }
-        if err := dec.Decode(&raw); err != nil {
-            if errors.Is(err, io.EOF) {
-                break
+    return books, companions, nil
+}
+
+// isCompanion reports whether file is a <book>.<lang>.json translation
+// companion of one of the books in names.
+func isCompanion(file string, names map[string]bool) bool {
+    stem, ext, gz, _ := splitFormat(file)
+    if ext != ".json" || gz {
+        return false
+    }
+    base, _, ok := splitLang(stem)
+    return ok && names[base]
+}
+
+// bookName returns the file name without its format extension.
+func bookName(file string) string {
+    book, _, _, _ := splitFormat(file)
+    return book
+}
+
+// buildInfo combines manifest entries with counts and languages from the
+// loaded books. Books missing from the manifest get a bare entry.
+func (s *Store) buildInfo(manifest map[string]BookInfo) {
+    s.info = make(map[string]BookInfo, len(s.books))
+    for _, b := range s.books {
+        info := manifest[b]
+        info.Name = b
+        info.Count = len(s.byBook[b])
+        langs := map[string]bool{DefaultLang: true}
+        for _, h := range s.byBook[b] {
+            for l := range h.Translations {
+                langs[l] = true
             }
-            return fmt.Errorf("decode hadith in %s: %w", path, err)
         }
-        hadiths = append(hadiths, Hadith{
-            Book:   book,
-            Number: raw.Number,
-            Arab:   raw.Arab,
-            ID:     raw.ID,
-        })
+        info.Languages = make([]string, 0, len(langs))
+        for l := range langs {
+            info.Languages = append(info.Languages, l)
+        }
+        sort.Strings(info.Languages)
+        s.info[b] = info
+    }
+}
+
+// buildVersion hashes every hadith and book description, in book order.
+// Strings are length-prefixed and maps written in key order, so equal data
+// always hashes alike.
+func (s *Store) buildVersion() {
+    h := sha256.New()
+    var buf []byte
+    str := func(v string) {
+        buf = binary.AppendUvarint(buf, uint64(len(v)))
+        buf = append(buf, v...)
+    }
+    num := func(v int) { buf = binary.AppendVarint(buf, int64(v)) }
+    for _, b := range s.books {
+        info, _ := json.Marshal(s.info[b])
+        str(string(info))
+        for _, hd := range s.byBook[b] {
+            str(hd.Book)
+            num(hd.Number)
+            str(hd.Arab)
+            str(hd.ID)
+            str(hd.Kitab)
+            str(hd.Bab)
+            str(hd.Grade)
+            num(len(hd.Translations))
+            for _, lang := range sortedKeys(hd.Translations) {
+                str(lang)
+                str(hd.Translations[lang])
+            }
+            num(len(hd.Numbers))
+            for _, ed := range sortedKeys(hd.Numbers) {
+                str(ed)
+                num(hd.Numbers[ed])
+            }
+            h.Write(buf)
+            buf = buf[:0]
+        }
+    }
+    h.Write(buf)
+    s.version = hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
+
+// buildSorted orders each book by hadith number for Browse and Page.
+func (s *Store) buildSorted() {
+    s.sorted = make(map[string][]Hadith, len(s.books))
+    for _, b := range s.books {
+        hadiths := s.byBook[b]
+        less := func(i, j int) bool { return hadiths[i].Number < hadiths[j].Number }
+        if !sort.SliceIsSorted(hadiths, less) {
+            hadiths = append([]Hadith(nil), hadiths...)
+            sort.Slice(hadiths, less)
+        }
+        s.sorted[b] = hadiths
+    }
+}
+
+// buildIndex flattens the loaded books and builds the inverted index over
+// their Arabic text and every translation, one field per language code.
+func (s *Store) buildIndex() {
+    s.all = s.all[:0]
+    for _, b := range s.books {
+        s.all = append(s.all, s.byBook[b]...)
+    }
+    langs := map[string]bool{DefaultLang: true}
+    s.index = index.New()
+    for i, h := range s.all {
+        s.index.Add(i, "arab", h.Arab)
+        s.index.Add(i, DefaultLang, h.ID)
+        for lang, text := range h.Translations {
+            langs[lang] = true
+            s.index.Add(i, lang, text)
+        }
+    }
+    s.index.Finish()
+    s.buildCorpus()
+    s.langs = s.langs[:0]
+    for l := range langs {
+        s.langs = append(s.langs, l)
+    }
+    sort.Strings(s.langs)
+}
+
+// buildCorpus normalizes the text of every hadith in all and records which
+// documents belong to which book, so that searches neither normalize
+// documents nor scan the corpus for a book.
+func (s *Store) buildCorpus() {
+    s.norm = make([]NormText, len(s.all))
+    for i, h := range s.all {
+        s.norm[i] = NormText{Arab: index.Normalize(h.Arab), ID: index.Normalize(h.ID), Book: index.Normalize(h.Book)}
+    }
+    s.spans = s.spans[:0]
+    start := 0
+    for _, b := range s.books {
+        end := start + len(s.byBook[b])
+        s.spans = append(s.spans, BookSpan{Name: b, Norm: index.Normalize(b), Start: start, End: end})
+        start = end
+    }
+}
+
+func (s *Store) loadBook(src source, name string) error {
+    book := bookName(name)
+    r, decode, err := openBook(src, name)
+    if err != nil {
+        return err
+    }
+    defer r.Close()
+    var hadiths []Hadith
+    byNum := map[int]int{}
+    seen := map[int]int{} // number -> first entry in the file
+    entry := -1
+    err = decode(r, func(rec Record) error {
+        entry++
+        h := Hadith{
+            Book:    book,
+            Number:  rec.Number,
+            Arab:    rec.Arab,
+            ID:      rec.ID,
+            Kitab:   strings.TrimSpace(rec.Kitab),
+            Bab:     strings.TrimSpace(rec.Bab),
+            Grade:   strings.TrimSpace(rec.Grade),
+            Numbers: rec.Numbers,
+        }
+        for lang, text := range rec.Translations {
+            h.setText(strings.ToLower(lang), text)
+        }
+        if first, dup := seen[h.Number]; dup {
+            // Keep the first; strict mode refused the books in validate.
+            s.warnings = append(s.warnings, Problem{File: name, Index: entry, Field: "number", Warning: true,
+                Msg: fmt.Sprintf("duplicate number %d (first at index %d) skipped", h.Number, first)})
+            return nil
+        }
+        seen[h.Number] = entry
+        byNum[h.Number] = len(hadiths)
+        hadiths = append(hadiths, h)
+        return nil
+    })
+    if err != nil {
+        return fmt.Errorf("%s: %w", src.path(name), err)
     }
     s.byBook[book] = hadiths
+    s.byNum[book] = byNum
+    s.chapters[book] = groupChapters(hadiths)
     return nil
 }
 
+// groupChapters splits hadiths into runs sharing kitab and bab. Hadiths
+// without either field are not part of any chapter.
+func groupChapters(hadiths []Hadith) []chapterSpan {
+    var out []chapterSpan
+    for i, h := range hadiths {
+        if h.Kitab == "" && h.Bab == "" {
+            continue
+        }
+        if n := len(out); n > 0 && out[n-1].end == i && out[n-1].Kitab == h.Kitab && out[n-1].Bab == h.Bab {
+            out[n-1].end = i + 1
+            out[n-1].Last = h.Number
+            out[n-1].Count++
+            continue
+        }
+        out = append(out, chapterSpan{
+            Chapter: Chapter{Number: len(out) + 1, Kitab: h.Kitab, Bab: h.Bab, First: h.Number, Last: h.Number, Count: 1},
+            start:   i,
+            end:     i + 1,
+        })
+    }
+    return out
+}
+
 // Books returns book names in stable order.
 func (s *Store) Books() []string {
     s.mu.RLock()
@@ -96,6 +419,25 @@ func (s *Store) Books() []string {
     return out
 }
 
+// BookInfo returns the description of book.
+func (s *Store) BookInfo(name string) (BookInfo, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    info, ok := s.info[name]
+    return info, ok
+}
+
+// BookInfos returns the description of every book, in Books order.
+func (s *Store) BookInfos() []BookInfo {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    out := make([]BookInfo, 0, len(s.books))
+    for _, b := range s.books {
+        out = append(out, s.info[b])
+    }
+    return out
+}
+
 // Count returns total hadith count across all books.
 func (s *Store) Count() int {
     s.mu.RLock()
@@ -111,23 +453,189 @@ func (s *Store) Count() int {
 func (s *Store) Get(book string, number int) (Hadith, bool) {
     s.mu.RLock()
     defer s.mu.RUnlock()
-    list := s.byBook[book]
-    for _, h := range list {
-        if h.Number == number {
-            return h, true
+    i, ok := s.byNum[book][number]
+    if !ok {
+        return Hadith{}, false
+    }
+    return s.byBook[book][i], true
+}
+
+// GetMany looks up every ref under a single read lock, so that a reload
+// cannot mix old and new data. The results are in the order of refs;
+// found[i] reports whether refs[i] exists.
+func (s *Store) GetMany(refs []Ref) (hadiths []Hadith, found []bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    hadiths, found = make([]Hadith, len(refs)), make([]bool, len(refs))
+    for i, r := range refs {
+        if j, ok := s.byNum[r.Book][r.Number]; ok {
+            hadiths[i], found[i] = s.byBook[r.Book][j], true
+        }
+    }
+    return hadiths, found
+}
+
+// Languages returns the translation languages present in the store, sorted.
+// DefaultLang is always included.
+func (s *Store) Languages() []string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    out := make([]string, len(s.langs))
+    copy(out, s.langs)
+    return out
+}
+
+// HasLanguage reports whether any hadith has a translation in lang.
+func (s *Store) HasLanguage(lang string) bool {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    for _, l := range s.langs {
+        if l == lang {
+            return true
         }
     }
-    return Hadith{}, false
+    return false
+}
+
+// Chapters returns the chapters of book in file order, or nil when the book
+// has no kitab/bab metadata.
+func (s *Store) Chapters(book string) []Chapter {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    spans := s.chapters[book]
+    if len(spans) == 0 {
+        return nil
+    }
+    out := make([]Chapter, len(spans))
+    for i, c := range spans {
+        out[i] = c.Chapter
+    }
+    return out
+}
+
+// Chapter returns chapter number n (1-based) of book and its hadiths.
+func (s *Store) Chapter(book string, n int) (Chapter, []Hadith, bool) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    spans := s.chapters[book]
+    if n < 1 || n > len(spans) {
+        return Chapter{}, nil, false
+    }
+    c := spans[n-1]
+    out := make([]Hadith, c.end-c.start)
+    copy(out, s.byBook[book][c.start:c.end])
+    return c.Chapter, out, true
+}
+
+// Version identifies the loaded data: a short hash of every hadith and book
+// description, so it is the same for the same books wherever they are
+// loaded and changes whenever a reload brings different data.
+func (s *Store) Version() string {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.version
+}
+
+// Warnings returns the problems tolerated while reading the book files,
+// such as a duplicate number whose later entries were skipped. A store
+// loaded from a snapshot has none to report; strict mode fails instead.
+func (s *Store) Warnings() []Problem {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return append([]Problem(nil), s.warnings...)
+}
+
+// Loaded returns when the data served was loaded: when the store was
+// created, or by the last reload that changed Version.
+func (s *Store) Loaded() time.Time {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return s.loaded
+}
+
+// Browse returns the hadiths of book numbered from through to, sorted by
+// number. A zero bound is open, so Browse(book, 0, 0) is the whole book.
+func (s *Store) Browse(book string, from, to int) []Hadith {
+    hadiths, _ := s.BrowsePage(book, from, to, 0, 0)
+    return hadiths
+}
+
+// Page returns up to limit hadiths of book, sorted by number, starting at
+// offset, together with the number of hadiths in the book. A limit of zero
+// or less means no limit.
+func (s *Store) Page(book string, offset, limit int) ([]Hadith, int) {
+    return s.BrowsePage(book, 0, 0, offset, limit)
+}
+
+// BrowsePage is Page over the hadiths Browse(book, from, to) returns: up to
+// limit of them starting at offset, and how many there are. Only the page
+// is copied.
+func (s *Store) BrowsePage(book string, from, to, offset, limit int) ([]Hadith, int) {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    hadiths := s.sorted[book]
+    i := 0
+    if from != 0 {
+        i = sort.Search(len(hadiths), func(k int) bool { return hadiths[k].Number >= from })
+    }
+    j := len(hadiths)
+    if to != 0 {
+        j = sort.Search(len(hadiths), func(k int) bool { return hadiths[k].Number > to })
+    }
+    if i >= j {
+        return nil, 0
+    }
+    hadiths = hadiths[i:j]
+    total := len(hadiths)
+    if offset < 0 {
+        offset = 0
+    }
+    if offset >= total {
+        return nil, total
+    }
+    hadiths = hadiths[offset:]
+    if limit > 0 && len(hadiths) > limit {
+        hadiths = hadiths[:limit]
+    }
+    return append([]Hadith(nil), hadiths...), total
 }
 
 // All returns all hadiths across all books.
 func (s *Store) All() []Hadith {
     s.mu.RLock()
     defer s.mu.RUnlock()
-    var out []Hadith
-    for _, b := range s.books {
-        out = append(out, s.byBook[b]...)
-    }
+    out := make([]Hadith, len(s.all))
+    copy(out, s.all)
     return out
 }
 
+// Corpus is the loaded data as search sees it. Documents are positions in
+// All, which lists the hadiths book by book.
+type Corpus struct {
+    All   []Hadith
+    Index *index.Index // inverted index over All
+    Norm  []NormText   // index.Normalize of the text of each document
+    Books []BookSpan   // the documents of each book, in Books order
+}
+
+// NormText holds the normalized Arabic text, Indonesian text and book name
+// of a hadith.
+type NormText struct {
+    Arab, ID, Book string
+}
+
+// BookSpan is the range [Start, End) of documents of a book.
+type BookSpan struct {
+    Name       string
+    Norm       string // index.Normalize(Name)
+    Start, End int
+}
+
+// Corpus returns the corpus with the index and the rest of what search
+// derives from it at load time. It is shared and must be treated as
+// read-only.
+func (s *Store) Corpus() *Corpus {
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    return &Corpus{All: s.all, Index: s.index, Norm: s.norm, Books: s.spans}
+}
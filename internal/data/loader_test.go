@@ -0,0 +1,100 @@
+package data
+
+import (
+    "errors"
+    "testing"
+    "testing/fstest"
+)
+
+func TestLoadDuplicateNumbers(t *testing.T) {
+    fsys := fstest.MapFS{"malik.json": {Data: []byte(`[
+        {"number": 1, "arab": "الأول", "id": "Pertama"},
+        {"number": 2, "arab": "الثاني", "id": "Kedua"},
+        {"number": 1, "arab": "مكرر", "id": "Ulangan"}
+    ]`)}}
+    // Outside strict mode the first entry wins and the rest is a warning.
+    s, err := NewStoreFS(fsys)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if h, ok := s.Get("malik", 1); !ok || h.ID != "Pertama" {
+        t.Errorf("Get(malik, 1) = %q, %v; want the first entry", h.ID, ok)
+    }
+    if n := s.Count(); n != 2 {
+        t.Errorf("Count() = %d, want 2", n)
+    }
+    warnings := s.Warnings()
+    if len(warnings) != 1 {
+        t.Fatalf("Warnings() = %v, want one", warnings)
+    }
+    if w := warnings[0]; w.File != "malik.json" || w.Index != 2 || w.Field != "number" || !w.Warning {
+        t.Errorf("warning = %+v", w)
+    }
+    // Strict mode refuses the books.
+    _, err = NewStoreFSOptions(fsys, Options{Strict: true})
+    var verr *ValidationError
+    if !errors.As(err, &verr) {
+        t.Fatalf("strict load: %v, want a ValidationError", err)
+    }
+}
+
+// getNumbers loads the bundled books and returns the numbers of each.
+func getNumbers(b *testing.B) (*Store, map[string][]int) {
+    b.Helper()
+    s, err := NewStore("../../books")
+    if err != nil {
+        b.Fatal(err)
+    }
+    numbers := map[string][]int{}
+    for _, h := range s.All() {
+        numbers[h.Book] = append(numbers[h.Book], h.Number)
+    }
+    for _, book := range []string{"darimi", "malik"} {
+        if len(numbers[book]) == 0 {
+            b.Fatalf("no hadiths in %s", book)
+        }
+    }
+    return s, numbers
+}
+
+// BenchmarkGet looks up every hadith of the bundled books by number, in
+// turn. Run with go test -bench Get ./internal/data.
+func BenchmarkGet(b *testing.B) {
+    s, numbers := getNumbers(b)
+    for _, book := range []string{"darimi", "malik"} {
+        ns := numbers[book]
+        b.Run(book, func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                if _, ok := s.Get(book, ns[i%len(ns)]); !ok {
+                    b.Fatalf("%s #%d not found", book, ns[i%len(ns)])
+                }
+            }
+        })
+    }
+}
+
+// BenchmarkGetScan is BenchmarkGet with the linear scan over byBook that
+// Get did before the number index, as a baseline.
+func BenchmarkGetScan(b *testing.B) {
+    s, numbers := getNumbers(b)
+    for _, book := range []string{"darimi", "malik"} {
+        ns := numbers[book]
+        hadiths := s.byBook[book]
+        b.Run(book, func(b *testing.B) {
+            b.ReportAllocs()
+            for i := 0; i < b.N; i++ {
+                n, ok := ns[i%len(ns)], false
+                for _, h := range hadiths {
+                    if h.Number == n {
+                        ok = true
+                        break
+                    }
+                }
+                if !ok {
+                    b.Fatalf("%s #%d not found", book, n)
+                }
+            }
+        })
+    }
+}
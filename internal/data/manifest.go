@@ -0,0 +1,55 @@
+package data
+
+import (
+    "encoding/json"
+    "errors"
+    "fmt"
+    "io/fs"
+)
+
+// ManifestFile is the optional file in the books directory that describes
+// each book. It is not a book itself.
+const ManifestFile = "manifest.json"
+
+// BookInfo describes a book: its display names, provenance and licensing as
+// recorded in the manifest, plus figures computed from the loaded data.
+type BookInfo struct {
+    Name string `json:"name"` // file name without extension, as used in URLs
+    // Names holds display names keyed by language code ("ar", "id", "en").
+    Names     map[string]string `json:"names,omitempty"`
+    Author    string            `json:"author,omitempty"`
+    Compiled  string            `json:"compiled,omitempty"` // compilation date(s), free text
+    SourceURL string            `json:"source_url,omitempty"`
+    License   string            `json:"license,omitempty"`
+    Count     int               `json:"count"`     // hadiths loaded
+    Languages []string          `json:"languages"` // translations present, sorted
+}
+
+// DisplayName returns the book's display name in lang, falling back to
+// Indonesian, English and finally the file name.
+func (b BookInfo) DisplayName(lang string) string {
+    for _, l := range []string{lang, DefaultLang, "en"} {
+        if n := b.Names[l]; n != "" {
+            return n
+        }
+    }
+    return b.Name
+}
+
+// loadManifest reads the manifest, if any, keyed by book name. Entries for
+// books that are not loaded are ignored.
+func loadManifest(src source) (map[string]BookInfo, error) {
+    path := src.path(ManifestFile)
+    b, err := fs.ReadFile(src.fsys, ManifestFile)
+    if errors.Is(err, fs.ErrNotExist) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("read %s: %w", path, err)
+    }
+    var m map[string]BookInfo
+    if err := json.Unmarshal(b, &m); err != nil {
+        return nil, fmt.Errorf("decode %s: %w", path, err)
+    }
+    return m, nil
+}
@@ -0,0 +1,103 @@
+package data
+
+import (
+    "context"
+    "fmt"
+    "io/fs"
+    "sort"
+    "strings"
+    "time"
+)
+
+// Reload reads the books again and swaps the new data in. Readers
+// see either the old or the new data, never a mix. When loading fails the
+// store keeps serving the old data and the error is returned.
+//
+// Slices returned earlier (All, Corpus, Chapter) stay valid; they keep
+// referring to the data that was current when they were obtained.
+func (s *Store) Reload() error {
+    s.mu.RLock()
+    src, opts := s.src, s.opts
+    s.mu.RUnlock()
+    fresh, err := load(src, opts)
+    if err != nil {
+        return fmt.Errorf("reload: %w", err)
+    }
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    s.byBook = fresh.byBook
+    s.byNum = fresh.byNum
+    s.sorted = fresh.sorted
+    s.books = fresh.books
+    s.all = fresh.all
+    s.index = fresh.index
+    s.norm = fresh.norm
+    s.spans = fresh.spans
+    s.langs = fresh.langs
+    s.info = fresh.info
+    if fresh.version != s.version {
+        s.loaded = fresh.loaded
+    }
+    s.version = fresh.version
+    s.chapters = fresh.chapters
+    s.warnings = fresh.warnings
+    return nil
+}
+
+// Watch polls the books directory every interval and calls Reload when a
+// file is added, removed or modified. report, if not nil, receives the
+// result of every such reload (nil on success). Watch blocks until ctx is
+// done.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, report func(error)) {
+    s.mu.RLock()
+    src := s.src
+    s.mu.RUnlock()
+    last, _ := fingerprint(src.fsys)
+    t := time.NewTicker(interval)
+    defer t.Stop()
+    for {
+        select {
+        case <-ctx.Done():
+            return
+        case <-t.C:
+        }
+        fp, err := fingerprint(src.fsys)
+        if err != nil || fp == last {
+            // Unchanged, or unreadable right now: look again next tick.
+            continue
+        }
+        last = fp
+        err = s.Reload()
+        if report != nil {
+            report(err)
+        }
+    }
+}
+
+// fingerprint summarizes the names, sizes and modification times of the
+// files at the root of fsys.
+func fingerprint(fsys fs.FS) (string, error) {
+    entries, err := fs.ReadDir(fsys, ".")
+    if err != nil {
+        return "", err
+    }
+    var b strings.Builder
+    lines := make([]string, 0, len(entries))
+    for _, e := range entries {
+        if e.IsDir() {
+            continue
+        }
+        fi, err := e.Info()
+        if err != nil {
+            // Removed between ReadDir and Info; the next poll sees it gone.
+            continue
+        }
+        lines = append(lines, fmt.Sprintf("%s\x00%d\x00%d", e.Name(), fi.Size(), fi.ModTime().UnixNano()))
+    }
+    sort.Strings(lines)
+    for _, l := range lines {
+        b.WriteString(l)
+        b.WriteByte('\n')
+    }
+    return b.String(), nil
+}
@@ -0,0 +1,95 @@
+package data
+
+import (
+    "context"
+    "errors"
+    "os"
+    "path/filepath"
+    "testing"
+    "testing/fstest"
+    "time"
+)
+
+func TestReload(t *testing.T) {
+    fsys := fstest.MapFS{"malik.json": {Data: []byte(`[{"number": 1, "arab": "الأول", "id": "Pertama"}]`)}}
+    s, err := NewStoreFS(fsys)
+    if err != nil {
+        t.Fatal(err)
+    }
+    version := s.Version()
+    fsys["darimi.json"] = &fstest.MapFile{Data: []byte(`[{"number": 7, "arab": "العلم", "id": "Ilmu"}]`)}
+    if err := s.Reload(); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := s.Get("darimi", 7); !ok || s.Count() != 2 || s.Version() == version {
+        t.Errorf("after reload: count %d, version %s (was %s)", s.Count(), s.Version(), version)
+    }
+    // The search corpus is rebuilt with the data.
+    if c := s.Corpus(); len(c.All) != 2 || len(c.Books) != 2 || c.Norm[0].ID != "ilmu" {
+        t.Errorf("corpus after reload: %d hadiths in %d books", len(c.All), len(c.Books))
+    }
+    // A failed reload keeps the previous data.
+    version = s.Version()
+    fsys["darimi.json"] = &fstest.MapFile{Data: []byte(`[{"number": 7,`)}
+    if err := s.Reload(); err == nil {
+        t.Fatal("reload of a broken book succeeded")
+    }
+    if _, ok := s.Get("darimi", 7); !ok || s.Version() != version {
+        t.Errorf("failed reload changed the data")
+    }
+}
+
+func TestReloadStrict(t *testing.T) {
+    fsys := fstest.MapFS{"malik.json": {Data: []byte(`[{"number": 1, "arab": "الأول", "id": "Pertama"}]`)}}
+    s, err := NewStoreFSOptions(fsys, Options{Strict: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Loadable, but with an empty translation.
+    fsys["malik.json"] = &fstest.MapFile{Data: []byte(`[{"number": 1, "arab": "الأول", "id": ""}]`)}
+    var verr *ValidationError
+    if err := s.Reload(); !errors.As(err, &verr) {
+        t.Fatalf("strict reload: %v, want a ValidationError", err)
+    }
+    if h, _ := s.Get("malik", 1); h.ID != "Pertama" {
+        t.Errorf("failed reload changed the data")
+    }
+}
+
+func TestWatch(t *testing.T) {
+    dir := t.TempDir()
+    path := filepath.Join(dir, "malik.json")
+    if err := os.WriteFile(path, []byte(`[{"number": 1, "arab": "الأول", "id": "Pertama"}]`), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    s, err := NewStore(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    ctx, cancel := context.WithCancel(context.Background())
+    defer cancel()
+    reloads := make(chan error, 1)
+    go s.Watch(ctx, 10*time.Millisecond, func(err error) { reloads <- err })
+    // Give Watch time to take its first fingerprint.
+    time.Sleep(50 * time.Millisecond)
+    // Replace the book in one step, so that Watch never reads it half
+    // written.
+    tmp := filepath.Join(t.TempDir(), "malik.json")
+    if err := os.WriteFile(tmp, []byte(`[{"number": 1, "arab": "الأول", "id": "Pertama"}, {"number": 2, "arab": "الثاني", "id": "Kedua"}]`), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Rename(tmp, path); err != nil {
+        t.Fatal(err)
+    }
+    select {
+    case err := <-reloads:
+        if err != nil {
+            t.Fatal(err)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatal("no reload after the book changed")
+    }
+    if _, ok := s.Get("malik", 2); !ok {
+        t.Error("reloaded store lacks the new hadith")
+    }
+}
@@ -0,0 +1,217 @@
+package data
+
+import (
+    "bytes"
+    "crypto/sha256"
+    "encoding/gob"
+    "errors"
+    "fmt"
+    "io/fs"
+    "os"
+    "path/filepath"
+    "time"
+
+    "github.com/nuzlilatief/hadith-go/internal/search/index"
+)
+
+// SnapshotFile is the precompiled store that BuildSnapshot writes to the
+// books directory. Loading it skips decoding the book files and building
+// the search index. It is not a book itself.
+const SnapshotFile = "index.snapshot"
+
+// A snapshot file is snapshotMagic, the format version byte, the SHA-256
+// of the payload and the payload: a gob-encoded snapshot.
+const (
+    snapshotMagic   = "HADITHSNAP"
+    snapshotVersion = 2
+)
+
+// errStaleSnapshot marks a snapshot that load may skip: out of date, or
+// not usable for a strict load. Any other failure means the file is
+// damaged.
+var errStaleSnapshot = errors.New("snapshot is older than the books")
+
+// snapshot is everything load computes from the book files.
+type snapshot struct {
+    // Sources records the files the snapshot was built from; any change
+    // to the set or to a size makes it stale.
+    Sources []stamp
+    // Clean is set when Validate found no problem in the sources, so a
+    // strict load may use the snapshot.
+    Clean   bool
+    Books   []string
+    ByBook  map[string][]Hadith
+    ByNum   map[string]map[int]int
+    Langs   []string
+    Info    map[string]BookInfo
+    Version string // Store.Version
+    Index   []byte // index.Index.MarshalBinary
+}
+
+type stamp struct {
+    Name string
+    Size int64
+}
+
+// BuildSnapshot loads the books in booksDir, ignoring any snapshot there,
+// and writes SnapshotFile next to them, replacing the old one once the new
+// file is complete. It returns the number of hadiths written.
+func BuildSnapshot(booksDir string) (int, error) {
+    src := source{fsys: os.DirFS(booksDir), dir: booksDir}
+    sources, _, err := sourceStamps(src)
+    if err != nil {
+        return 0, err
+    }
+    st, err := load(src, Options{IgnoreSnapshot: true})
+    if err != nil {
+        return 0, err
+    }
+    problems, err := validate(src)
+    if err != nil {
+        return 0, err
+    }
+    ix, err := st.index.MarshalBinary()
+    if err != nil {
+        return 0, err
+    }
+    snap := snapshot{
+        Sources: sources,
+        Clean:   len(problems) == 0,
+        Books:   st.books,
+        ByBook:  st.byBook,
+        ByNum:   st.byNum,
+        Langs:   st.langs,
+        Info:    st.info,
+        Version: st.version,
+        Index:   ix,
+    }
+    var payload bytes.Buffer
+    if err := gob.NewEncoder(&payload).Encode(&snap); err != nil {
+        return 0, fmt.Errorf("encode snapshot: %w", err)
+    }
+    sum := sha256.Sum256(payload.Bytes())
+    out := make([]byte, 0, len(snapshotMagic)+1+len(sum)+payload.Len())
+    out = append(out, snapshotMagic...)
+    out = append(out, snapshotVersion)
+    out = append(out, sum[:]...)
+    out = append(out, payload.Bytes()...)
+    path := filepath.Join(booksDir, SnapshotFile)
+    tmp := path + ".tmp"
+    if err := os.WriteFile(tmp, out, 0o644); err != nil {
+        os.Remove(tmp)
+        return 0, err
+    }
+    if err := os.Rename(tmp, path); err != nil {
+        os.Remove(tmp)
+        return 0, err
+    }
+    return len(st.all), nil
+}
+
+// loadSnapshot returns the store held by the snapshot in src. It fails
+// with fs.ErrNotExist when there is none and with errStaleSnapshot when it
+// is from another format version or stale: older than a source file, or
+// built from other files; load then reads the books instead. Any other
+// error means the snapshot is corrupt.
+func loadSnapshot(src source, opts Options) (*Store, error) {
+    fi, err := fs.Stat(src.fsys, SnapshotFile)
+    if err != nil {
+        return nil, err
+    }
+    sources, newest, err := sourceStamps(src)
+    if err != nil {
+        // Reading the books reports the problem.
+        return nil, fmt.Errorf("%w: %v", errStaleSnapshot, err)
+    }
+    if newest.After(fi.ModTime()) {
+        return nil, errStaleSnapshot
+    }
+    data, err := fs.ReadFile(src.fsys, SnapshotFile)
+    if err != nil {
+        return nil, err
+    }
+    head := len(snapshotMagic) + 1 + sha256.Size
+    if len(data) < head || string(data[:len(snapshotMagic)]) != snapshotMagic {
+        return nil, errors.New("not a snapshot")
+    }
+    if v := data[len(snapshotMagic)]; v != snapshotVersion {
+        return nil, fmt.Errorf("%w: format %d, want %d", errStaleSnapshot, v, snapshotVersion)
+    }
+    payload := data[head:]
+    if sum := sha256.Sum256(payload); !bytes.Equal(sum[:], data[len(snapshotMagic)+1:head]) {
+        return nil, errors.New("snapshot checksum mismatch")
+    }
+    var snap snapshot
+    if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&snap); err != nil {
+        return nil, fmt.Errorf("decode snapshot: %w", err)
+    }
+    if !sameStamps(snap.Sources, sources) {
+        return nil, errStaleSnapshot
+    }
+    if opts.Strict && !snap.Clean {
+        // Reading the books reports the problems.
+        return nil, fmt.Errorf("%w: built from books with problems", errStaleSnapshot)
+    }
+    st := &Store{
+        byBook:   snap.ByBook,
+        byNum:    snap.ByNum,
+        books:    snap.Books,
+        index:    &index.Index{},
+        langs:    snap.Langs,
+        info:     snap.Info,
+        version:  snap.Version,
+        chapters: map[string][]chapterSpan{},
+        src:      src,
+        opts:     opts,
+    }
+    if err := st.index.UnmarshalBinary(snap.Index); err != nil {
+        return nil, fmt.Errorf("decode snapshot: %w", err)
+    }
+    for _, b := range st.books {
+        st.all = append(st.all, st.byBook[b]...)
+        st.chapters[b] = groupChapters(st.byBook[b])
+    }
+    st.buildSorted()
+    st.buildCorpus()
+    return st, nil
+}
+
+// sourceStamps lists the files load reads from src (books, translation
+// companions and the manifest, as listFiles finds them) with the latest
+// modification time among them. Other files, such as a README or a
+// leftover temporary file, do not make a snapshot stale.
+func sourceStamps(src source) ([]stamp, time.Time, error) {
+    books, companions, err := listFiles(src)
+    if err != nil {
+        return nil, time.Time{}, err
+    }
+    names := append(append([]string(nil), books...), companions...)
+    if _, err := fs.Stat(src.fsys, ManifestFile); err == nil {
+        names = append(names, ManifestFile)
+    }
+    var out []stamp
+    var newest time.Time
+    for _, name := range names {
+        fi, err := fs.Stat(src.fsys, name)
+        if err != nil {
+            return nil, time.Time{}, err
+        }
+        out = append(out, stamp{Name: name, Size: fi.Size()})
+        if fi.ModTime().After(newest) {
+            newest = fi.ModTime()
+        }
+    }
+    return out, newest, nil
+}
+
+func sameStamps(a, b []stamp) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i] != b[i] {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,250 @@
+package data
+
+import (
+    "errors"
+    "os"
+    "path/filepath"
+    "reflect"
+    "strings"
+    "testing"
+    "time"
+)
+
+// snapshotDir writes two books to a temporary directory, snapshots them
+// and backdates the books so that the snapshot is newer.
+func snapshotDir(t *testing.T) string {
+    t.Helper()
+    dir := t.TempDir()
+    files := map[string][]byte{
+        "malik.json":    encodeBook(t, ".json", testRecords),
+        "darimi.jsonl":  encodeBook(t, ".jsonl", testRecords[:2]),
+        "malik.en.json": []byte(`[{"number": 2, "text": "Prayer"}]`),
+    }
+    past := time.Now().Add(-time.Hour)
+    for name, data := range files {
+        path := filepath.Join(dir, name)
+        if err := os.WriteFile(path, data, 0o644); err != nil {
+            t.Fatal(err)
+        }
+        if err := os.Chtimes(path, past, past); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if n, err := BuildSnapshot(dir); err != nil || n != 5 {
+        t.Fatalf("BuildSnapshot = %d, %v, want 5 hadiths", n, err)
+    }
+    return dir
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+    dir := snapshotDir(t)
+    src := source{fsys: os.DirFS(dir), dir: dir}
+    snap, err := loadSnapshot(src, Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    books, err := load(src, Options{IgnoreSnapshot: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(snap.all, books.all) {
+        t.Errorf("snapshot hadiths differ from the books")
+    }
+    if snap.version != books.version || !reflect.DeepEqual(snap.langs, books.langs) || !reflect.DeepEqual(snap.info, books.info) {
+        t.Errorf("snapshot version %q, langs %q, info %+v; books %q, %q, %+v",
+            snap.version, snap.langs, snap.info, books.version, books.langs, books.info)
+    }
+    if !reflect.DeepEqual(snap.Corpus().Norm, books.Corpus().Norm) || !reflect.DeepEqual(snap.spans, books.spans) {
+        t.Errorf("snapshot corpus differs from the books")
+    }
+    a, _ := snap.index.MarshalBinary()
+    b, _ := books.index.MarshalBinary()
+    if string(a) != string(b) {
+        t.Errorf("snapshot index differs from the books")
+    }
+    if h, ok := snap.Get("malik", 2); !ok || h.Text("en") != "Prayer" {
+        t.Errorf("Get(malik, 2) = %+v, %v", h, ok)
+    }
+    if _, err := os.Stat(filepath.Join(dir, SnapshotFile+".tmp")); !errors.Is(err, os.ErrNotExist) {
+        t.Errorf("temporary file left behind: %v", err)
+    }
+}
+
+// TestSnapshotUsed shows that NewStore reads an up-to-date snapshot rather
+// than the books: a same-size edit under an old timestamp goes unseen.
+func TestSnapshotUsed(t *testing.T) {
+    dir := snapshotDir(t)
+    path := filepath.Join(dir, "malik.json")
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    edited := strings.Replace(string(data), "Zakat", "Infaq", 1)
+    past := time.Now().Add(-time.Hour)
+    if err := os.WriteFile(path, []byte(edited), 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if err := os.Chtimes(path, past, past); err != nil {
+        t.Fatal(err)
+    }
+    s, err := NewStore(dir)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if h, _ := s.Get("malik", 10); h.ID != "Zakat" {
+        t.Errorf("malik 10 = %q, want the snapshot's %q", h.ID, "Zakat")
+    }
+    s, err = NewStoreOptions(dir, Options{IgnoreSnapshot: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if h, _ := s.Get("malik", 10); h.ID != "Infaq" {
+        t.Errorf("IgnoreSnapshot: malik 10 = %q, want %q", h.ID, "Infaq")
+    }
+}
+
+func TestSnapshotDamaged(t *testing.T) {
+    tests := []struct {
+        name   string
+        damage func([]byte) []byte
+        err    string
+    }{
+        {"flipped byte", func(b []byte) []byte { b[len(b)-1] ^= 0xff; return b }, "checksum mismatch"},
+        {"truncated payload", func(b []byte) []byte { return b[:len(b)/2] }, "checksum mismatch"},
+        {"truncated header", func(b []byte) []byte { return b[:len(snapshotMagic)+3] }, "not a snapshot"},
+        {"empty", func(b []byte) []byte { return nil }, "not a snapshot"},
+        {"wrong magic", func(b []byte) []byte { copy(b, "NOTSNAPSHO"); return b }, "not a snapshot"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := snapshotDir(t)
+            path := filepath.Join(dir, SnapshotFile)
+            data, err := os.ReadFile(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if err := os.WriteFile(path, tt.damage(data), 0o644); err != nil {
+                t.Fatal(err)
+            }
+            _, err = NewStore(dir)
+            if err == nil || !strings.Contains(err.Error(), tt.err) || !strings.Contains(err.Error(), "rebuild it") {
+                t.Fatalf("NewStore error = %v, want one containing %q", err, tt.err)
+            }
+            // The books can still be read on request.
+            if _, err := NewStoreOptions(dir, Options{IgnoreSnapshot: true}); err != nil {
+                t.Error(err)
+            }
+        })
+    }
+}
+
+func TestSnapshotStale(t *testing.T) {
+    future := time.Now().Add(time.Hour)
+    tests := []struct {
+        name   string
+        change func(t *testing.T, dir string)
+    }{
+        {"book edited", func(t *testing.T, dir string) {
+            write(t, filepath.Join(dir, "darimi.jsonl"), encodeBook(t, ".jsonl", testRecords), time.Time{})
+        }},
+        {"book touched", func(t *testing.T, dir string) {
+            if err := os.Chtimes(filepath.Join(dir, "malik.json"), future, future); err != nil {
+                t.Fatal(err)
+            }
+        }},
+        {"book added", func(t *testing.T, dir string) {
+            write(t, filepath.Join(dir, "bukhari.csv"), encodeBook(t, ".csv", testRecords), time.Now().Add(-2*time.Hour))
+        }},
+        {"book removed", func(t *testing.T, dir string) {
+            if err := os.Remove(filepath.Join(dir, "darimi.jsonl")); err != nil {
+                t.Fatal(err)
+            }
+        }},
+        {"companion removed", func(t *testing.T, dir string) {
+            if err := os.Remove(filepath.Join(dir, "malik.en.json")); err != nil {
+                t.Fatal(err)
+            }
+        }},
+        {"manifest added", func(t *testing.T, dir string) {
+            write(t, filepath.Join(dir, ManifestFile), []byte(`{}`), time.Now().Add(-2*time.Hour))
+        }},
+        {"older format", func(t *testing.T, dir string) {
+            path := filepath.Join(dir, SnapshotFile)
+            data, err := os.ReadFile(path)
+            if err != nil {
+                t.Fatal(err)
+            }
+            data[len(snapshotMagic)] = snapshotVersion - 1
+            write(t, path, data, time.Time{})
+        }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            dir := snapshotDir(t)
+            tt.change(t, dir)
+            src := source{fsys: os.DirFS(dir), dir: dir}
+            if _, err := loadSnapshot(src, Options{}); !errors.Is(err, errStaleSnapshot) {
+                t.Fatalf("loadSnapshot error = %v, want errStaleSnapshot", err)
+            }
+            // load falls back to the books.
+            if _, err := NewStore(dir); err != nil {
+                t.Error(err)
+            }
+        })
+    }
+}
+
+// TestSnapshotIgnoresOtherFiles checks that files load does not read, even
+// newer ones, leave the snapshot current.
+func TestSnapshotIgnoresOtherFiles(t *testing.T) {
+    dir := snapshotDir(t)
+    future := time.Now().Add(time.Hour)
+    write(t, filepath.Join(dir, "README.md"), []byte("# Books"), future)
+    write(t, filepath.Join(dir, SnapshotFile+".tmp"), []byte("partial"), future)
+    write(t, filepath.Join(dir, "notes.txt"), []byte("x"), future)
+    if err := os.Mkdir(filepath.Join(dir, "drafts"), 0o755); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := loadSnapshot(source{fsys: os.DirFS(dir), dir: dir}, Options{}); err != nil {
+        t.Errorf("loadSnapshot = %v, want the snapshot to stay current", err)
+    }
+}
+
+func TestBuildSnapshotFailure(t *testing.T) {
+    dir := snapshotDir(t)
+    // A directory in the way of the temporary file makes the write fail.
+    tmp := filepath.Join(dir, SnapshotFile+".tmp")
+    if err := os.Mkdir(tmp, 0o755); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := BuildSnapshot(dir); err == nil {
+        t.Fatal("BuildSnapshot succeeded with its temporary file blocked")
+    }
+    // The old snapshot is untouched.
+    if _, err := loadSnapshot(source{fsys: os.DirFS(dir), dir: dir}, Options{}); err != nil {
+        t.Errorf("old snapshot no longer loads: %v", err)
+    }
+
+    bad := t.TempDir()
+    write(t, filepath.Join(bad, "malik.json"), []byte(`{"not": "an array"}`), time.Time{})
+    if _, err := BuildSnapshot(bad); err == nil {
+        t.Error("BuildSnapshot of a broken book succeeded")
+    }
+    if _, err := os.Stat(filepath.Join(bad, SnapshotFile)); !errors.Is(err, os.ErrNotExist) {
+        t.Errorf("snapshot written for a broken book: %v", err)
+    }
+}
+
+// write writes data to path and, unless mtime is zero, sets its
+// modification time.
+func write(t *testing.T, path string, data []byte, mtime time.Time) {
+    t.Helper()
+    if err := os.WriteFile(path, data, 0o644); err != nil {
+        t.Fatal(err)
+    }
+    if !mtime.IsZero() {
+        if err := os.Chtimes(path, mtime, mtime); err != nil {
+            t.Fatal(err)
+        }
+    }
+}
@@ -0,0 +1,66 @@
+package data
+
+import (
+    "encoding/json"
+    "fmt"
+    "strings"
+)
+
+// splitLang splits a companion file stem such as "malik.en" into book and
+// language. The language must be a 2 or 3 letter lowercase code.
+func splitLang(stem string) (book, lang string, ok bool) {
+    i := strings.LastIndexByte(stem, '.')
+    if i <= 0 {
+        return "", "", false
+    }
+    book, lang = stem[:i], stem[i+1:]
+    if len(lang) < 2 || len(lang) > 3 {
+        return "", "", false
+    }
+    for _, r := range lang {
+        if r < 'a' || r > 'z' {
+            return "", "", false
+        }
+    }
+    return book, lang, true
+}
+
+// loadTranslations merges a companion file (an array of {number, text}) into
+// the already loaded book. Every number must exist in the book.
+func (s *Store) loadTranslations(src source, name, book, lang string) error {
+    path := src.path(name)
+    f, err := src.fsys.Open(name)
+    if err != nil {
+        return fmt.Errorf("open %s: %w", path, err)
+    }
+    defer f.Close()
+    var rows []struct {
+        Number int    `json:"number"`
+        Text   string `json:"text"`
+    }
+    if err := json.NewDecoder(f).Decode(&rows); err != nil {
+        return fmt.Errorf("decode %s: %w", path, err)
+    }
+    hadiths := s.byBook[book]
+    pos := s.byNum[book]
+    for i, r := range rows {
+        j, ok := pos[r.Number]
+        if !ok {
+            return fmt.Errorf("%s: entry %d: number %d not in book %s", path, i, r.Number, book)
+        }
+        hadiths[j].setText(lang, r.Text)
+    }
+    return nil
+}
+
+// setText stores text as the translation in lang.
+func (h *Hadith) setText(lang, text string) {
+    if lang == DefaultLang {
+        h.ID = text
+        return
+    }
+    if h.Translations == nil {
+        h.Translations = map[string]string{}
+    }
+    h.Translations[lang] = text
+}
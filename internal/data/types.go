@@ -1,11 +1,72 @@
 package data
 
+import "strconv"
+
 // Hadith represents a single hadith entry from a book JSON file.
+// Only Number, Arab and ID are required in the files; the chapter, grading
+// and alternate numbering fields are optional and omitted from JSON output
+// when absent.
 type Hadith struct {
     Book   string `json:"book"`
     Number int    `json:"number"`
     Arab   string `json:"arab"`
-    ID     string `json:"id"`
+    // ID is the Indonesian translation. It keeps its own field, rather than
+    // living in Translations, so the original {number, arab, id} shape is
+    // unchanged for existing clients.
+    ID string `json:"id"`
+    // Translations holds the other translations keyed by language code
+    // ("en", "ms", ...). Use Text to read any language uniformly.
+    Translations map[string]string `json:"translations,omitempty"`
+    // Kitab and Bab name the chapter and sub-chapter the hadith belongs to.
+    Kitab string `json:"kitab,omitempty"`
+    Bab   string `json:"bab,omitempty"`
+    // Grade is the authenticity grading as given by the source, e.g. "sahih", "hasan", "da'if".
+    Grade string `json:"grade,omitempty"`
+    // Numbers holds the hadith's number in other editions, keyed by edition name.
+    Numbers map[string]int `json:"numbers,omitempty"`
+}
+
+// DefaultLang is the language of Hadith.ID.
+const DefaultLang = "id"
+
+// Text returns the translation in lang ("" means DefaultLang), or "" when
+// the hadith has none.
+func (h Hadith) Text(lang string) string {
+    if lang == "" || lang == DefaultLang {
+        return h.ID
+    }
+    return h.Translations[lang]
+}
+
+// In returns a copy of h carrying only the translation in lang: ID is
+// cleared unless lang is DefaultLang and Translations is reduced to lang.
+// An empty lang returns h unchanged.
+func (h Hadith) In(lang string) Hadith {
+    switch lang {
+    case "":
+        return h
+    case DefaultLang:
+        h.Translations = nil
+        return h
+    }
+    text, ok := h.Translations[lang]
+    h.ID = ""
+    h.Translations = nil
+    if ok {
+        h.Translations = map[string]string{lang: text}
+    }
+    return h
+}
+
+// Ref identifies a hadith by book and number.
+type Ref struct {
+    Book   string `json:"book"`
+    Number int    `json:"number"`
+}
+
+// String returns r as "book:number".
+func (r Ref) String() string {
+    return r.Book + ":" + strconv.Itoa(r.Number)
 }
 
 // Book holds all hadiths for a particular collection.
@@ -14,3 +75,13 @@ type Book struct {
     Hadiths []Hadith `json:"hadiths"`
 }
 
+// Chapter is a run of consecutive hadiths in a book sharing the same kitab
+// and bab. Chapters are numbered from 1 in file order.
+type Chapter struct {
+    Number int    `json:"number"`
+    Kitab  string `json:"kitab,omitempty"`
+    Bab    string `json:"bab,omitempty"`
+    First  int    `json:"first"` // number of the first hadith
+    Last   int    `json:"last"`  // number of the last hadith
+    Count  int    `json:"count"`
+}
@@ -0,0 +1,294 @@
+package data
+
+import (
+    "encoding/json"
+    "fmt"
+    "io/fs"
+    "os"
+    "regexp"
+    "sort"
+    "strconv"
+    "strings"
+    "unicode/utf8"
+)
+
+// Problem is a defect Validate found in a books directory.
+type Problem struct {
+    File  string // file name within the books directory
+    Index int    // array index of the entry, or -1 for the whole file
+    Field string // JSON field, e.g. "arab" or "translations.en"; empty for the whole entry
+    Msg   string
+    // Warning marks problems the loader tolerates: numbering gaps, HTML
+    // remnants and stray whitespace. The rest make the data wrong or
+    // unloadable.
+    Warning bool
+}
+
+func (p Problem) String() string {
+    loc := p.File
+    if p.Index >= 0 {
+        loc += "[" + strconv.Itoa(p.Index) + "]"
+    }
+    if p.Field != "" {
+        loc += "." + p.Field
+    }
+    level := "error"
+    if p.Warning {
+        level = "warning"
+    }
+    return loc + ": " + level + ": " + p.Msg
+}
+
+// ValidationError is returned by a strict load when Validate finds problems.
+type ValidationError struct {
+    Problems []Problem
+}
+
+func (e *ValidationError) Error() string {
+    msg := fmt.Sprintf("books failed validation with %d problem(s); first: %s", len(e.Problems), e.Problems[0])
+    if len(e.Problems) > 1 {
+        msg += " (run hadith-cli validate for the full list)"
+    }
+    return msg
+}
+
+var (
+    htmlTag    = regexp.MustCompile(`</?[a-zA-Z][a-zA-Z0-9]*(\s[^<>]*)?/?>`)
+    htmlEntity = regexp.MustCompile(`&(#[0-9]+|#[xX][0-9a-fA-F]+|[a-zA-Z]+);`)
+)
+
+// Validate checks every book and translation companion in booksDir and
+// reports all problems it finds, in file order. Unlike the loader it does
+// not stop at the first one: a file that is not valid JSON is reported and
+// skipped. The error is only for an unreadable directory.
+func Validate(booksDir string) ([]Problem, error) {
+    return validate(source{fsys: os.DirFS(booksDir), dir: booksDir})
+}
+
+// ValidateFS is Validate for the books at the root of fsys.
+func ValidateFS(fsys fs.FS) ([]Problem, error) {
+    return validate(source{fsys: fsys})
+}
+
+func validate(src source) ([]Problem, error) {
+    books, companions, err := listFiles(src)
+    if err != nil {
+        return nil, err
+    }
+    sort.Strings(books)
+    sort.Strings(companions)
+    v := &validator{src: src, numbers: map[string]map[int]bool{}}
+    for _, name := range books {
+        v.book(name)
+    }
+    for _, name := range companions {
+        v.companion(name)
+    }
+    return v.problems, nil
+}
+
+type validator struct {
+    src      source
+    numbers  map[string]map[int]bool // per book: hadith numbers seen
+    problems []Problem
+}
+
+func (v *validator) add(file string, index int, field string, warning bool, format string, args ...any) {
+    v.problems = append(v.problems, Problem{File: file, Index: index, Field: field, Msg: fmt.Sprintf(format, args...), Warning: warning})
+}
+
+// entries decodes file and calls fn with the fields of each entry. JSON
+// formats are checked field by field as written; other formats go through
+// their DecodeFunc first. Decoding problems are recorded.
+func (v *validator) entries(file string, fn func(i int, fields map[string]json.RawMessage)) {
+    r, decode, err := openBook(v.src, file)
+    if err != nil {
+        v.add(file, -1, "", false, "%v", err)
+        return
+    }
+    defer r.Close()
+    _, ext, _, _ := splitFormat(file)
+    if ext != ".json" && ext != ".jsonl" && ext != ".ndjson" {
+        i := 0
+        err := decode(r, func(rec Record) error {
+            fn(i, recordFields(rec))
+            i++
+            return nil
+        })
+        if err != nil {
+            v.add(file, i, "", false, "%v", err)
+        }
+        return
+    }
+    dec := json.NewDecoder(r)
+    if ext == ".json" {
+        tok, err := dec.Token()
+        if err != nil {
+            v.add(file, -1, "", false, "invalid JSON: %v", err)
+            return
+        }
+        if delim, ok := tok.(json.Delim); !ok || delim != '[' {
+            v.add(file, -1, "", false, "expected JSON array")
+            return
+        }
+    }
+    for i := 0; dec.More(); i++ {
+        var raw json.RawMessage
+        if err := dec.Decode(&raw); err != nil {
+            v.add(file, i, "", false, "invalid JSON: %v", err)
+            return
+        }
+        var fields map[string]json.RawMessage
+        if err := json.Unmarshal(raw, &fields); err != nil || fields == nil {
+            v.add(file, i, "", false, "expected JSON object")
+            continue
+        }
+        fn(i, fields)
+    }
+}
+
+// recordFields turns a decoded record into the JSON fields it stands for.
+// Unset optional fields and a zero number are left out.
+func recordFields(rec Record) map[string]json.RawMessage {
+    fields := map[string]json.RawMessage{}
+    set := func(name string, v any) {
+        b, _ := json.Marshal(v)
+        fields[name] = b
+    }
+    if rec.Number != 0 {
+        set("number", rec.Number)
+    }
+    set("arab", rec.Arab)
+    set("id", rec.ID)
+    for name, s := range map[string]string{"kitab": rec.Kitab, "bab": rec.Bab, "grade": rec.Grade} {
+        if s != "" {
+            set(name, s)
+        }
+    }
+    if len(rec.Translations) > 0 {
+        set("translations", rec.Translations)
+    }
+    return fields
+}
+
+func (v *validator) book(file string) {
+    book := bookName(file)
+    seen := map[int]int{} // number -> first index
+    v.entries(file, func(i int, fields map[string]json.RawMessage) {
+        if n, ok := v.number(file, i, fields); ok {
+            if first, dup := seen[n]; dup {
+                v.add(file, i, "number", false, "duplicate number %d (first at index %d)", n, first)
+            } else {
+                seen[n] = i
+            }
+        }
+        v.text(file, i, "arab", fields["arab"], true)
+        v.text(file, i, "id", fields["id"], true)
+        for _, f := range []string{"kitab", "bab", "grade"} {
+            v.text(file, i, f, fields[f], false)
+        }
+        if raw, ok := fields["translations"]; ok {
+            var tr map[string]json.RawMessage
+            if err := json.Unmarshal(raw, &tr); err != nil {
+                v.add(file, i, "translations", false, "expected an object of language code to text")
+                return
+            }
+            langs := make([]string, 0, len(tr))
+            for l := range tr {
+                langs = append(langs, l)
+            }
+            sort.Strings(langs)
+            for _, l := range langs {
+                v.text(file, i, "translations."+l, tr[l], true)
+            }
+        }
+    })
+    nums := make(map[int]bool, len(seen))
+    sorted := make([]int, 0, len(seen))
+    for n := range seen {
+        nums[n] = true
+        sorted = append(sorted, n)
+    }
+    v.numbers[book] = nums
+    sort.Ints(sorted)
+    for k := 1; k < len(sorted); k++ {
+        if a, b := sorted[k-1], sorted[k]; b > a+1 {
+            if b == a+2 {
+                v.add(file, -1, "number", true, "gap in numbering: %d missing", a+1)
+            } else {
+                v.add(file, -1, "number", true, "gap in numbering: %d–%d missing", a+1, b-1)
+            }
+        }
+    }
+}
+
+func (v *validator) companion(file string) {
+    book, _, _ := splitLang(bookName(file))
+    v.entries(file, func(i int, fields map[string]json.RawMessage) {
+        if n, ok := v.number(file, i, fields); ok && !v.numbers[book][n] {
+            v.add(file, i, "number", false, "number %d not in book %s", n, book)
+        }
+        v.text(file, i, "text", fields["text"], true)
+    })
+}
+
+// number checks the "number" field of an entry and returns it when usable.
+func (v *validator) number(file string, i int, fields map[string]json.RawMessage) (int, bool) {
+    raw, ok := fields["number"]
+    if !ok {
+        v.add(file, i, "number", false, "missing")
+        return 0, false
+    }
+    var n int
+    if err := json.Unmarshal(raw, &n); err != nil {
+        v.add(file, i, "number", false, "not an integer: %s", raw)
+        return 0, false
+    }
+    if n < 1 {
+        v.add(file, i, "number", false, "must be positive, got %d", n)
+        return 0, false
+    }
+    return n, true
+}
+
+// text checks a string field. Required fields must be present and not blank.
+func (v *validator) text(file string, i int, field string, raw json.RawMessage, required bool) {
+    if raw == nil {
+        if required {
+            v.add(file, i, field, false, "missing")
+        }
+        return
+    }
+    if !utf8.Valid(raw) {
+        v.add(file, i, field, false, "invalid UTF-8")
+        return
+    }
+    var s string
+    if err := json.Unmarshal(raw, &s); err != nil {
+        v.add(file, i, field, false, "not a string")
+        return
+    }
+    if strings.ContainsRune(s, utf8.RuneError) {
+        // Decoders replace invalid UTF-8 with U+FFFD, and so did whatever
+        // produced text that already contains it.
+        v.add(file, i, field, false, "invalid UTF-8 (U+FFFD replacement character)")
+        return
+    }
+    if strings.TrimSpace(s) == "" {
+        if required {
+            v.add(file, i, field, false, "empty")
+        }
+        return
+    }
+    if m := htmlTag.FindString(s); m != "" {
+        v.add(file, i, field, true, "HTML tag %q", m)
+    } else if m := htmlEntity.FindString(s); m != "" {
+        v.add(file, i, field, true, "HTML entity %q", m)
+    }
+    if s != strings.TrimSpace(s) {
+        v.add(file, i, field, true, "leading or trailing whitespace")
+    }
+    if strings.Contains(s, "  ") || strings.ContainsAny(s, "\t\r\u00a0") {
+        v.add(file, i, field, true, "repeated spaces, tabs, carriage returns or non-breaking spaces")
+    }
+}
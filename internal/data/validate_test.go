@@ -0,0 +1,94 @@
+package data
+
+import (
+    "errors"
+    "reflect"
+    "strings"
+    "testing"
+    "testing/fstest"
+)
+
+func TestValidate(t *testing.T) {
+    fsys := fstest.MapFS{
+        "malik.json": {Data: []byte(`[
+            {"number": 1, "arab": "الأول", "id": "Pertama"},
+            {"number": 1, "arab": "مكرر", "id": "Ulangan"},
+            {"number": 4, "arab": "", "id": " Spasi"},
+            {"number": 0, "arab": "صفر", "id": "Nol", "grade": "<b>Shahih</b>"},
+            {"arab": "بلا رقم", "id": "Tanpa  nomor &amp; tab\t"},
+            {"number": 5, "arab": "` + "\xff" + `", "translations": {"en": ""}},
+            "teks",
+            {"number": 8, "arab": "الثامن", "id": "Delapan"}
+        ]`)},
+        "darimi.jsonl": {Data: []byte("{\"number\": 1, \"arab\": \"العلم\", \"id\": \"Ilmu\"}\n{\"number\": 2,\n")},
+        "malik.en.json": {Data: []byte(`[{"number": 1, "text": "First"}, {"number": 3, "text": ""}]`)},
+        "notes.txt":     {Data: []byte("not a book")},
+    }
+    problems, err := ValidateFS(fsys)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var got []string
+    for _, p := range problems {
+        got = append(got, p.String())
+    }
+    want := []string{
+        "darimi.jsonl[1]: error: invalid JSON: unexpected EOF",
+        "malik.json[1].number: error: duplicate number 1 (first at index 0)",
+        "malik.json[2].arab: error: empty",
+        "malik.json[2].id: warning: leading or trailing whitespace",
+        "malik.json[3].number: error: must be positive, got 0",
+        `malik.json[3].grade: warning: HTML tag "<b>"`,
+        "malik.json[4].number: error: missing",
+        `malik.json[4].id: warning: HTML entity "&amp;"`,
+        "malik.json[4].id: warning: leading or trailing whitespace",
+        "malik.json[4].id: warning: repeated spaces, tabs, carriage returns or non-breaking spaces",
+        "malik.json[5].arab: error: invalid UTF-8",
+        "malik.json[5].id: error: missing",
+        "malik.json[5].translations.en: error: empty",
+        "malik.json[6]: error: expected JSON object",
+        "malik.json.number: warning: gap in numbering: 2–3 missing",
+        "malik.json.number: warning: gap in numbering: 6–7 missing",
+        "malik.en.json[1].number: error: number 3 not in book malik",
+        "malik.en.json[1].text: error: empty",
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("problems:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+    }
+}
+
+func TestValidateBundled(t *testing.T) {
+    problems, err := Validate("../../books")
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, p := range problems {
+        if !p.Warning {
+            t.Errorf("bundled books: %s", p)
+        }
+    }
+    if _, err := Validate("no-such-dir"); err == nil {
+        t.Error("Validate of a missing directory succeeded")
+    }
+}
+
+func TestStrict(t *testing.T) {
+    clean := fstest.MapFS{"malik.json": {Data: []byte(`[{"number": 1, "arab": "الأول", "id": "Pertama"}, {"number": 2, "arab": "الثاني", "id": "Kedua"}]`)}}
+    if _, err := NewStoreFSOptions(clean, Options{Strict: true}); err != nil {
+        t.Fatalf("strict load of clean books: %v", err)
+    }
+    // A numbering gap is only a warning, which the default loader accepts
+    // and strict mode does not.
+    gap := fstest.MapFS{"malik.json": {Data: []byte(`[{"number": 1, "arab": "الأول", "id": "Pertama"}, {"number": 3, "arab": "الثالث", "id": "Ketiga"}]`)}}
+    if _, err := NewStoreFS(gap); err != nil {
+        t.Fatalf("load with a gap: %v", err)
+    }
+    _, err := NewStoreFSOptions(gap, Options{Strict: true})
+    var verr *ValidationError
+    if !errors.As(err, &verr) {
+        t.Fatalf("strict load with a gap: %v, want a ValidationError", err)
+    }
+    if len(verr.Problems) != 1 || !verr.Problems[0].Warning || !strings.Contains(err.Error(), "gap in numbering") {
+        t.Errorf("ValidationError = %v", err)
+    }
+}
@@ -0,0 +1,343 @@
+package search
+
+import (
+    "math/bits"
+    "sort"
+    "strings"
+
+    "github.com/nuzlilatief/hadith-go/internal/data"
+    "github.com/nuzlilatief/hadith-go/internal/search/index"
+)
+
+// Run evaluates q against the store with DefaultRanking and returns up to
+// limit results sorted by score, then by book and number. limit<=0 means no
+// cap. A nil Query has no results.
+func (q *Query) Run(store *data.Store, limit int) []Result {
+    return q.RunRanked(store, limit, DefaultRanking)
+}
+
+// RunRanked is Run with a custom ranking.
+func (q *Query) RunRanked(store *data.Store, limit int, r Ranking) []Result {
+    results, _ := q.RunPage(store, r, 0, limit)
+    return results
+}
+
+// RunPage evaluates q with ranking r and returns one page of its results:
+// [offset, offset+limit) of those that sort after q.After, in result order,
+// with the number of hits before After, offset and limit apply. limit<=0
+// means no cap. Every hit is scored, but only the page is built and
+// sorted (see SelectPage). A nil Query has no results.
+func (q *Query) RunPage(store *data.Store, r Ranking, offset, limit int) ([]Result, int) {
+    if q == nil {
+        return nil, 0
+    }
+    c := store.Corpus()
+    all := c.All
+    e := &evaluator{all: all, idx: c.Index, norm: c.Norm, books: c.Books, lang: q.lang(), expansions: map[string]*expansion{}}
+    set := e.eval(q.root, false)
+    if q.Book != "" {
+        set.and(e.booksWhere(func(b data.BookSpan) bool { return b.Name == q.Book }))
+    }
+    scores := e.score(set, r)
+    var docs []int32
+    var docScores []float64
+    set.each(func(doc int32) {
+        docs = append(docs, doc)
+        docScores = append(docScores, scores[doc])
+    })
+    key := func(i int) Cursor {
+        h := &all[docs[i]]
+        return Cursor{Score: docScores[i], Book: h.Book, Number: h.Number}
+    }
+    page := SelectPage(len(docs), key, q.After, offset, limit)
+    var results []Result
+    for _, i := range page {
+        results = append(results, Result{Hadith: all[docs[i]], Score: docScores[i]})
+    }
+    return results, len(docs)
+}
+
+// evaluator computes document sets for query nodes. Documents are positions
+// in all, as in the index.
+type evaluator struct {
+    all   []data.Hadith
+    idx   *index.Index
+    norm  []data.NormText
+    books []data.BookSpan
+    lang  string // translation searched by unscoped terms
+    // scored holds the per-field matches of every term that is not negated;
+    // they make up the score of a result.
+    scored     []termMatch
+    expansions map[string]*expansion
+}
+
+// termMatch records where a word or phrase matched.
+type termMatch struct {
+    terms  []string          // index terms of the word or phrase
+    fields map[string]bitset // matches per text field ("arab" or a language)
+    book   bitset
+}
+
+// expansion combines the posting lists of every indexed term that contains
+// a query term.
+type expansion struct {
+    docs bitset
+    tf   map[int32]int
+}
+
+// expand returns the (cached) expansion of term in field.
+func (e *evaluator) expand(field, term string) *expansion {
+    key := field + "\x00" + term
+    if x, ok := e.expansions[key]; ok {
+        return x
+    }
+    x := &expansion{docs: newBitset(len(e.all)), tf: map[int32]int{}}
+    for _, t := range e.idx.Containing(field, term) {
+        for _, p := range e.idx.Postings(field, t) {
+            x.docs.add(p.Doc)
+            x.tf[p.Doc] += int(p.Freq)
+        }
+    }
+    e.expansions[key] = x
+    return x
+}
+
+// score computes the BM25 score of every document in set.
+func (e *evaluator) score(set bitset, r Ranking) map[int32]float64 {
+    scores := map[int32]float64{}
+    n := len(e.all)
+    for _, m := range e.scored {
+        // Fields in a fixed order, so that the floating-point sums, and
+        // with them the order of equal-looking hits, are the same on every
+        // run. Page cursors rely on this.
+        fields := make([]string, 0, len(m.fields))
+        for field := range m.fields {
+            fields = append(fields, field)
+        }
+        sort.Strings(fields)
+        for _, field := range fields {
+            matched := m.fields[field]
+            boost := r.boost(field)
+            if boost == 0 {
+                continue
+            }
+            avg := e.idx.AvgLen(field)
+            for _, t := range m.terms {
+                x := e.expand(field, t)
+                w := idf(n, len(x.tf))
+                for doc, tf := range x.tf {
+                    if set.has(doc) && matched.has(doc) {
+                        scores[doc] += boost * r.bm25(w, tf, e.idx.DocLen(field, doc), avg)
+                    }
+                }
+            }
+        }
+        if boost := r.Boosts["book"]; boost != 0 {
+            m.book.each(func(doc int32) {
+                if set.has(doc) {
+                    scores[doc] += boost
+                }
+            })
+        }
+    }
+    return scores
+}
+
+func (e *evaluator) eval(n node, negated bool) bitset {
+    switch n := n.(type) {
+    case andNode:
+        set := e.eval(n[0], negated)
+        for _, c := range n[1:] {
+            set.and(e.eval(c, negated))
+        }
+        return set
+    case orNode:
+        set := e.eval(n[0], negated)
+        for _, c := range n[1:] {
+            set.or(e.eval(c, negated))
+        }
+        return set
+    case notNode:
+        set := e.eval(n.n, !negated)
+        set.not(len(e.all))
+        return set
+    case bookNode:
+        return e.booksWhere(func(b data.BookSpan) bool { return strings.EqualFold(b.Name, n.name) })
+    case numberNode:
+        return e.filter(func(h data.Hadith) bool {
+            return (n.from == 0 || h.Number >= n.from) && (n.to == 0 || h.Number <= n.to)
+        })
+    case termNode:
+        m := e.term(n)
+        if !negated {
+            e.scored = append(e.scored, m)
+        }
+        set := newBitset(len(e.all))
+        for _, f := range m.fields {
+            set.or(f)
+        }
+        set.or(m.book)
+        return set
+    }
+    return newBitset(len(e.all))
+}
+
+func (e *evaluator) term(n termNode) termMatch {
+    m := termMatch{terms: index.Terms(n.text), fields: map[string]bitset{}, book: newBitset(len(e.all))}
+    for _, field := range textFields(n.field, e.lang) {
+        m.fields[field] = e.match(field, n.text)
+    }
+    if n.field == "" {
+        norm := index.Normalize(n.text)
+        if norm != "" {
+            m.book = e.booksWhere(func(b data.BookSpan) bool { return strings.Contains(b.Norm, norm) })
+        }
+    }
+    return m
+}
+
+// match returns the documents whose field contains text. Posting lists give
+// the candidates; a substring check is only needed when text is more than a
+// single indexed term.
+func (e *evaluator) match(field, text string) bitset {
+    norm := index.Normalize(text)
+    if norm == "" {
+        return newBitset(len(e.all))
+    }
+    terms := index.Terms(text)
+    var cand bitset
+    if len(terms) == 0 {
+        // Nothing indexable (punctuation only): check every document.
+        cand = newBitset(len(e.all))
+        cand.not(len(e.all))
+    } else {
+        cand = e.candidates(field, terms)
+        if len(terms) == 1 && terms[0] == norm {
+            return cand
+        }
+    }
+    out := newBitset(len(e.all))
+    cand.each(func(doc int32) {
+        if strings.Contains(e.normText(doc, field), norm) {
+            out.add(doc)
+        }
+    })
+    return out
+}
+
+// booksWhere returns the documents of the books keep accepts.
+func (e *evaluator) booksWhere(keep func(data.BookSpan) bool) bitset {
+    set := newBitset(len(e.all))
+    for _, b := range e.books {
+        if keep(b) {
+            set.addRange(b.Start, b.End)
+        }
+    }
+    return set
+}
+
+// normText returns the normalized text of an index field of doc, computed
+// at load time for the Arabic and Indonesian texts.
+func (e *evaluator) normText(doc int32, field string) string {
+    switch field {
+    case "arab":
+        return e.norm[doc].Arab
+    case data.DefaultLang:
+        return e.norm[doc].ID
+    }
+    return index.Normalize(fieldText(e.all[doc], field))
+}
+
+func (e *evaluator) filter(keep func(data.Hadith) bool) bitset {
+    set := newBitset(len(e.all))
+    for i, h := range e.all {
+        if keep(h) {
+            set.add(int32(i))
+        }
+    }
+    return set
+}
+
+// textFields returns the index fields a term scoped to field searches:
+// the Arabic text and the lang translation when unscoped.
+func textFields(field, lang string) []string {
+    if field == "" {
+        return []string{"arab", lang}
+    }
+    return []string{field}
+}
+
+// fieldText returns the text of an index field: "arab" or a language code.
+func fieldText(h data.Hadith, field string) string {
+    if field == "arab" {
+        return h.Arab
+    }
+    return h.Text(field)
+}
+
+// candidates returns the documents whose field contains, for every query
+// term, some indexed term that has the query term as a substring. This is a
+// superset of the documents whose text contains the full query.
+func (e *evaluator) candidates(field string, terms []string) bitset {
+    set := newBitset(len(e.all))
+    set.or(e.expand(field, terms[0]).docs)
+    for _, t := range terms[1:] {
+        set.and(e.expand(field, t).docs)
+    }
+    return set
+}
+
+// bitset is a fixed-size set of document numbers.
+type bitset []uint64
+
+func newBitset(n int) bitset { return make(bitset, (n+63)/64) }
+
+func (b bitset) add(doc int32) { b[doc/64] |= 1 << (uint(doc) % 64) }
+
+// addRange adds the documents [start, end).
+func (b bitset) addRange(start, end int) {
+    for start < end && start%64 != 0 {
+        b.add(int32(start))
+        start++
+    }
+    for ; start+64 <= end; start += 64 {
+        b[start/64] = ^uint64(0)
+    }
+    for ; start < end; start++ {
+        b.add(int32(start))
+    }
+}
+
+func (b bitset) has(doc int32) bool { return b[doc/64]&(1<<(uint(doc)%64)) != 0 }
+
+func (b bitset) and(o bitset) {
+    for i := range b {
+        b[i] &= o[i]
+    }
+}
+
+func (b bitset) or(o bitset) {
+    for i := range b {
+        b[i] |= o[i]
+    }
+}
+
+// not complements b over the documents [0, n).
+func (b bitset) not(n int) {
+    for i := range b {
+        b[i] = ^b[i]
+    }
+    if r := n % 64; r != 0 {
+        b[len(b)-1] &= 1<<uint(r) - 1
+    }
+}
+
+func (b bitset) each(fn func(doc int32)) {
+    for i, w := range b {
+        for w != 0 {
+            bit := bits.TrailingZeros64(w)
+            fn(int32(i*64 + bit))
+            w &= w - 1
+        }
+    }
+}
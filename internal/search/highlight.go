@@ -0,0 +1,187 @@
+package search
+
+import (
+    "sort"
+    "strings"
+
+    "github.com/nuzlilatief/hadith-go/internal/search/index"
+)
+
+// Span is a matched range [Start, End) of a field's text, in bytes of its
+// UTF-8 encoding.
+type Span struct {
+    Start, End int
+}
+
+// Highlight sets Matches on each result to the words of its Arabic text and
+// translations that match a non-negated word or phrase of q. Matching is per
+// word: a query word that matches inside a longer word highlights that whole
+// word.
+func (q *Query) Highlight(results []Result) {
+    if q == nil {
+        return
+    }
+    terms := map[string][]string{}
+    collectTerms(q.root, false, q.lang(), terms)
+    for i := range results {
+        h := results[i].Hadith
+        var m map[string][]Span
+        for field, ts := range terms {
+            spans := matchSpans(fieldText(h, field), ts)
+            if len(spans) == 0 {
+                continue
+            }
+            if m == nil {
+                m = map[string][]Span{}
+            }
+            m[field] = spans
+        }
+        results[i].Matches = m
+    }
+}
+
+// collectTerms gathers the index terms of every non-negated word or phrase,
+// keyed by the field they apply to.
+func collectTerms(n node, negated bool, lang string, out map[string][]string) {
+    switch n := n.(type) {
+    case andNode:
+        for _, c := range n {
+            collectTerms(c, negated, lang, out)
+        }
+    case orNode:
+        for _, c := range n {
+            collectTerms(c, negated, lang, out)
+        }
+    case notNode:
+        collectTerms(n.n, !negated, lang, out)
+    case termNode:
+        if negated {
+            return
+        }
+        terms := index.Terms(n.text)
+        for _, field := range textFields(n.field, lang) {
+            out[field] = append(out[field], terms...)
+        }
+    }
+}
+
+// matchSpans returns the spans of the words in text containing any of terms.
+func matchSpans(text string, terms []string) []Span {
+    if len(terms) == 0 {
+        return nil
+    }
+    var spans []Span
+    for _, t := range index.Tokens(text) {
+        for _, q := range terms {
+            if strings.Contains(t.Term, q) {
+                spans = append(spans, Span{Start: t.Start, End: t.End})
+                break
+            }
+        }
+    }
+    return spans
+}
+
+// Snippet returns a window of at most width runes of text around the
+// densest cluster of spans, with "…" marking cut ends and newlines flattened
+// to spaces, together with the spans that fall in the window, relative to the
+// snippet. width<=0 keeps the whole text.
+func Snippet(text string, spans []Span, width int) (string, []Span) {
+    text = strings.ReplaceAll(text, "\n", " ")
+    // Byte offset of each rune, plus len(text), so rune i spans offs[i]:offs[i+1].
+    offs := make([]int, 0, len(text)+1)
+    for i := range text {
+        offs = append(offs, i)
+    }
+    offs = append(offs, len(text))
+    runes := len(offs) - 1
+    from, to := 0, runes
+    if width > 0 && runes > width {
+        from = bestWindow(offs, spans, width)
+        to = from + width
+    }
+    // Skip leading/trailing blanks of the window so the ellipsis sits next to text.
+    for from < to && text[offs[from]] == ' ' {
+        from++
+    }
+    for to > from && text[offs[to-1]] == ' ' {
+        to--
+    }
+    start, end := offs[from], offs[to]
+    var b strings.Builder
+    prefix := ""
+    if strings.TrimSpace(text[:start]) != "" {
+        prefix = "…"
+    }
+    b.WriteString(prefix)
+    b.WriteString(text[start:end])
+    if strings.TrimSpace(text[end:]) != "" {
+        b.WriteString("…")
+    }
+    var out []Span
+    shift := len(prefix) - start
+    for _, s := range spans {
+        if s.End <= start || s.Start >= end {
+            continue
+        }
+        if s.Start < start {
+            s.Start = start
+        }
+        if s.End > end {
+            s.End = end
+        }
+        out = append(out, Span{Start: s.Start + shift, End: s.End + shift})
+    }
+    return b.String(), out
+}
+
+// bestWindow returns the first rune of the width-rune window covering the
+// most spans. The window opens a little before its first span for context.
+func bestWindow(offs []int, spans []Span, width int) int {
+    runes := len(offs) - 1
+    runeAt := func(b int) int { return sort.SearchInts(offs, b) }
+    best, bestCount := 0, 0
+    for i, s := range spans {
+        first := runeAt(s.Start)
+        count := 0
+        for _, t := range spans[i:] {
+            if runeAt(t.End) > first+width {
+                break
+            }
+            count++
+        }
+        if count > bestCount {
+            best, bestCount = first, count
+        }
+    }
+    if bestCount == 0 {
+        return 0
+    }
+    from := best - width/5
+    if from < 0 {
+        from = 0
+    }
+    if from+width > runes {
+        from = runes - width
+    }
+    return from
+}
+
+// Mark wraps each span of s in open and close markers, e.g. ANSI escapes or
+// "<mark>" tags. Spans must be sorted and must not overlap.
+func Mark(s string, spans []Span, open, close string) string {
+    var b strings.Builder
+    last := 0
+    for _, sp := range spans {
+        if sp.Start < last || sp.End > len(s) {
+            continue
+        }
+        b.WriteString(s[last:sp.Start])
+        b.WriteString(open)
+        b.WriteString(s[sp.Start:sp.End])
+        b.WriteString(close)
+        last = sp.End
+    }
+    b.WriteString(s[last:])
+    return b.String()
+}
@@ -0,0 +1,136 @@
+package search
+
+import (
+    "reflect"
+    "testing"
+    "unicode/utf8"
+)
+
+func TestMatchSpans(t *testing.T) {
+    tests := []struct {
+        text  string
+        terms []string
+        want  []Span
+    }{
+        {"Amal itu tergantung niat", []string{"niat"}, []Span{{20, 24}}},
+        // A term inside a longer word marks the whole word.
+        {"Berniat baik, niatnya", []string{"niat"}, []Span{{0, 7}, {14, 21}}},
+        {"Shalat lima waktu", []string{"lima", "shalat"}, []Span{{0, 6}, {7, 11}}},
+        {"Shalat lima waktu", []string{"puasa"}, nil},
+        {"Shalat lima waktu", nil, nil},
+    }
+    for _, tt := range tests {
+        if got := matchSpans(tt.text, tt.terms); !reflect.DeepEqual(got, tt.want) {
+            t.Errorf("matchSpans(%q, %q) = %v, want %v", tt.text, tt.terms, got, tt.want)
+        }
+    }
+}
+
+func TestHighlight(t *testing.T) {
+    s := testStore(t)
+    q, err := Parse(`niat NOT "lima waktu" OR arab:الصلاة`)
+    if err != nil {
+        t.Fatal(err)
+    }
+    results := q.Run(s, 0)
+    q.Highlight(results)
+    got := map[string]map[string][]Span{}
+    for _, r := range results {
+        got[refs([]Result{r})[0]] = r.Matches
+    }
+    want := map[string]map[string][]Span{
+        "malik 1":  {"id": {{20, 24}}},
+        "malik 10": {"id": {{17, 21}}},
+        "darimi 1": {"id": {{21, 25}}},
+        // Only arab: applies to the Arabic; the negated phrase marks nothing.
+        "malik 2":  {"arab": {{0, len("الصلاة")}}},
+        "darimi 2": {"arab": {{0, len("الصلاة")}}},
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Errorf("Highlight gave %v, want %v", got, want)
+    }
+
+    var none *Query
+    none.Highlight(results) // no-op
+}
+
+func TestSnippet(t *testing.T) {
+    text := "satu dua tiga empat lima enam tujuh delapan sembilan sepuluh"
+    span := func(word string) Span {
+        for i := 0; i+len(word) <= len(text); i++ {
+            if text[i:i+len(word)] == word {
+                return Span{i, i + len(word)}
+            }
+        }
+        t.Fatalf("%q not in text", word)
+        return Span{}
+    }
+    tests := []struct {
+        name  string
+        text  string
+        spans []Span
+        width int
+        want  string
+    }{
+        {"whole text", text, nil, 0, text},
+        {"fits", text, nil, 100, text},
+        {"no spans keeps the start", text, nil, 12, "satu dua tig…"},
+        // The window opens a fifth of its width before the first match and
+        // may cut a word of context.
+        {"window around the match", text, []Span{span("delapan")}, 20, "…juh delapan sembilan…"},
+        {"densest cluster", text, []Span{span("dua"), span("tujuh"), span("delapan")}, 16, "…am tujuh delapan…"},
+        {"match at the end", text, []Span{span("sepuluh")}, 16, "…sembilan sepuluh"},
+        {"newlines flattened", "satu\ndua\ntiga", nil, 0, "satu dua tiga"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, spans := Snippet(tt.text, tt.spans, tt.width)
+            if got != tt.want {
+                t.Errorf("Snippet = %q, want %q", got, tt.want)
+            }
+            if n := utf8.RuneCountInString(got); tt.width > 0 && n > tt.width+2 {
+                t.Errorf("snippet has %d runes, want at most %d plus ellipses", n, tt.width)
+            }
+            // Spans are moved into the snippet and still cover the same words.
+            for _, sp := range spans {
+                word := got[sp.Start:sp.End]
+                found := false
+                for _, orig := range tt.spans {
+                    if tt.text[orig.Start:orig.End] == word {
+                        found = true
+                    }
+                }
+                if !found {
+                    t.Errorf("span %v covers %q, not a matched word", sp, word)
+                }
+            }
+        })
+    }
+}
+
+func TestSnippetArabic(t *testing.T) {
+    text := "حَدَّثَنَا مُحَمَّدُ بْنُ يُوسُفَ عَنْ سُفْيَانَ عَنْ الْأَعْمَشِ"
+    got, _ := Snippet(text, nil, 10)
+    if !utf8.ValidString(got) {
+        t.Errorf("snippet %q cuts a rune", got)
+    }
+}
+
+func TestMark(t *testing.T) {
+    tests := []struct {
+        s     string
+        spans []Span
+        want  string
+    }{
+        {"Shalat lima waktu", []Span{{0, 6}, {12, 17}}, "[Shalat] lima [waktu]"},
+        {"Shalat lima waktu", nil, "Shalat lima waktu"},
+        // Overlapping and out-of-range spans are skipped.
+        {"Shalat lima waktu", []Span{{0, 6}, {3, 11}, {12, 40}}, "[Shalat] lima waktu"},
+        {"…niat baik", []Span{{len("…"), len("…niat")}}, "…[niat] baik"},
+    }
+    for _, tt := range tests {
+        if got := Mark(tt.s, tt.spans, "[", "]"); got != tt.want {
+            t.Errorf("Mark(%q, %v) = %q, want %q", tt.s, tt.spans, got, tt.want)
+        }
+    }
+}
@@ -0,0 +1,126 @@
+package index
+
+import (
+    "encoding/binary"
+    "errors"
+    "sort"
+)
+
+// MarshalBinary encodes the finished index compactly: per field, in name
+// order, the document lengths and the vocabulary with delta-encoded
+// posting lists, all as varints. It lets a store snapshot keep the index
+// instead of rebuilding it.
+func (ix *Index) MarshalBinary() ([]byte, error) {
+    var b []byte
+    b = binary.AppendUvarint(b, uint64(ix.docs))
+    names := make([]string, 0, len(ix.fields))
+    for name := range ix.fields {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    b = binary.AppendUvarint(b, uint64(len(names)))
+    for _, name := range names {
+        f := ix.fields[name]
+        b = appendString(b, name)
+        b = binary.AppendUvarint(b, uint64(len(f.lengths)))
+        for _, n := range f.lengths {
+            b = binary.AppendUvarint(b, uint64(n))
+        }
+        b = binary.AppendUvarint(b, uint64(len(f.vocab)))
+        for _, t := range f.vocab {
+            b = appendString(b, t)
+            ps := f.postings[t]
+            b = binary.AppendUvarint(b, uint64(len(ps)))
+            prev := int32(0)
+            for _, p := range ps {
+                b = binary.AppendUvarint(b, uint64(p.Doc-prev))
+                b = binary.AppendUvarint(b, uint64(p.Freq))
+                prev = p.Doc
+            }
+        }
+    }
+    return b, nil
+}
+
+// UnmarshalBinary replaces ix with an index encoded by MarshalBinary.
+func (ix *Index) UnmarshalBinary(data []byte) error {
+    d := decoder{b: data}
+    out := Index{fields: map[string]*field{}, docs: d.int()}
+    for n := d.int(); n > 0 && d.err == nil; n-- {
+        name := d.string()
+        f := &field{postings: map[string][]Posting{}}
+        f.lengths = make([]int32, d.int())
+        for i := range f.lengths {
+            f.lengths[i] = int32(d.int())
+            f.total += int64(f.lengths[i])
+        }
+        f.vocab = make([]string, d.int())
+        for i := range f.vocab {
+            t := d.string()
+            ps := make([]Posting, d.int())
+            doc := int32(0)
+            for j := range ps {
+                doc += int32(d.int())
+                ps[j] = Posting{Doc: doc, Freq: int32(d.int())}
+            }
+            f.vocab[i] = t
+            f.postings[t] = ps
+            if d.err != nil {
+                return d.err
+            }
+        }
+        f.indexGrams()
+        out.fields[name] = f
+    }
+    if d.err == nil && len(d.b) > 0 {
+        d.err = errors.New("index: trailing data")
+    }
+    if d.err != nil {
+        return d.err
+    }
+    *ix = out
+    return nil
+}
+
+func appendString(b []byte, s string) []byte {
+    b = binary.AppendUvarint(b, uint64(len(s)))
+    return append(b, s...)
+}
+
+// decoder reads varints and strings, remembering the first error so that
+// callers can check once at the end.
+type decoder struct {
+    b   []byte
+    err error
+}
+
+var errCorrupt = errors.New("index: corrupt encoding")
+
+func (d *decoder) int() int {
+    if d.err != nil {
+        return 0
+    }
+    v, n := binary.Uvarint(d.b)
+    if n <= 0 || v > uint64(len(d.b))*8+1<<20 {
+        // No count in a valid encoding is far beyond its size; this keeps
+        // corrupt input from causing huge allocations.
+        d.err = errCorrupt
+        return 0
+    }
+    d.b = d.b[n:]
+    return int(v)
+}
+
+func (d *decoder) string() string {
+    n := d.int()
+    if d.err != nil {
+        return ""
+    }
+    if n > len(d.b) {
+        d.err = errCorrupt
+        return ""
+    }
+    s := string(d.b[:n])
+    d.b = d.b[n:]
+    return s
+}
@@ -0,0 +1,186 @@
+// Package index implements the inverted index used by internal/search.
+//
+// Documents are identified by their position in the corpus slice they were
+// built from and are made of named text fields ("arab", "id", ...). The
+// package knows nothing about hadith types so that internal/data can build an
+// index at load time without importing internal/search.
+package index
+
+import (
+    "sort"
+    "strings"
+)
+
+// Posting records that a term occurs Freq times in document Doc.
+type Posting struct {
+    Doc  int32
+    Freq int32
+}
+
+// Index maps terms to posting lists, per field. It is built once with Add and
+// Finish and is safe for concurrent reads afterwards.
+type Index struct {
+    fields map[string]*field
+    docs   int
+}
+
+type field struct {
+    postings map[string][]Posting
+    vocab    []string           // sorted terms, used for infix lookups
+    grams    map[string][]int32 // trigram -> positions in vocab of the terms containing it
+    lengths  []int32            // number of terms per document
+    total    int64              // sum of lengths
+}
+
+// New returns an empty index.
+func New() *Index {
+    return &Index{fields: map[string]*field{}}
+}
+
+// Add indexes text as field name of document doc. Documents must be added in
+// increasing order so posting lists stay sorted by document.
+func (ix *Index) Add(doc int, name, text string) {
+    if doc >= ix.docs {
+        ix.docs = doc + 1
+    }
+    f := ix.fields[name]
+    if f == nil {
+        f = &field{postings: map[string][]Posting{}}
+        ix.fields[name] = f
+    }
+    terms := Terms(text)
+    for len(f.lengths) <= doc {
+        f.lengths = append(f.lengths, 0)
+    }
+    f.lengths[doc] = int32(len(terms))
+    f.total += int64(len(terms))
+    freq := map[string]int32{}
+    for _, t := range terms {
+        freq[t]++
+    }
+    for t, n := range freq {
+        f.postings[t] = append(f.postings[t], Posting{Doc: int32(doc), Freq: n})
+    }
+}
+
+// Finish prepares the vocabulary for lookups. It must be called after the last Add.
+func (ix *Index) Finish() {
+    for _, f := range ix.fields {
+        f.vocab = make([]string, 0, len(f.postings))
+        for t := range f.postings {
+            f.vocab = append(f.vocab, t)
+        }
+        sort.Strings(f.vocab)
+        f.indexGrams()
+    }
+}
+
+// gramLen is the length in runes of the vocabulary n-grams.
+const gramLen = 3
+
+// indexGrams builds the trigram lists of the sorted vocabulary.
+func (f *field) indexGrams() {
+    f.grams = map[string][]int32{}
+    for i, t := range f.vocab {
+        for _, g := range grams(t) {
+            // A term repeating a trigram is listed once.
+            if list := f.grams[g]; len(list) == 0 || list[len(list)-1] != int32(i) {
+                f.grams[g] = append(list, int32(i))
+            }
+        }
+    }
+}
+
+// grams returns the trigrams of s, or none when s is shorter.
+func grams(s string) []string {
+    var starts []int
+    for i := range s {
+        starts = append(starts, i)
+    }
+    starts = append(starts, len(s))
+    var out []string
+    for i := 0; i+gramLen < len(starts); i++ {
+        out = append(out, s[starts[i]:starts[i+gramLen]])
+    }
+    return out
+}
+
+// Len returns the number of documents covered by the index.
+func (ix *Index) Len() int {
+    if ix == nil {
+        return 0
+    }
+    return ix.docs
+}
+
+// DocLen returns the number of terms in field name of document doc.
+func (ix *Index) DocLen(name string, doc int32) int {
+    if ix == nil {
+        return 0
+    }
+    f := ix.fields[name]
+    if f == nil || int(doc) >= len(f.lengths) {
+        return 0
+    }
+    return int(f.lengths[doc])
+}
+
+// AvgLen returns the average number of terms in field name per document.
+func (ix *Index) AvgLen(name string) float64 {
+    if ix == nil || ix.docs == 0 {
+        return 0
+    }
+    f := ix.fields[name]
+    if f == nil {
+        return 0
+    }
+    return float64(f.total) / float64(ix.docs)
+}
+
+// Postings returns the posting list of term in field name, or nil.
+func (ix *Index) Postings(name, term string) []Posting {
+    if ix == nil {
+        return nil
+    }
+    f := ix.fields[name]
+    if f == nil {
+        return nil
+    }
+    return f.postings[term]
+}
+
+// Containing returns the terms of field name that contain fragment, in
+// vocabulary order. Only the terms sharing the rarest trigram of fragment
+// are checked; a fragment of one or two runes scans the vocabulary, which
+// is far smaller than the text it was built from.
+func (ix *Index) Containing(name, fragment string) []string {
+    if ix == nil {
+        return nil
+    }
+    f := ix.fields[name]
+    if f == nil {
+        return nil
+    }
+    var out []string
+    gs := grams(fragment)
+    if len(gs) == 0 {
+        for _, t := range f.vocab {
+            if strings.Contains(t, fragment) {
+                out = append(out, t)
+            }
+        }
+        return out
+    }
+    cand := f.grams[gs[0]]
+    for _, g := range gs[1:] {
+        if list := f.grams[g]; len(list) < len(cand) {
+            cand = list
+        }
+    }
+    for _, i := range cand {
+        if t := f.vocab[i]; strings.Contains(t, fragment) {
+            out = append(out, t)
+        }
+    }
+    return out
+}
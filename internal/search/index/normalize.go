@@ -0,0 +1,49 @@
+package index
+
+import (
+    "strings"
+    "unicode"
+)
+
+// Normalize folds s into the form used for indexing and matching: lowercase,
+// with Arabic tashkeel and tatweel removed and common letter variants folded
+// (أ/إ/آ/ٱ→ا, ى→ي, ة→ه). Queries typed without harakat then match fully
+// vowelled text.
+func Normalize(s string) string {
+    return strings.Map(normalizeRune, s)
+}
+
+func normalizeRune(r rune) rune {
+    switch {
+    case r == 'ـ': // tatweel
+        return -1
+    case isTashkeel(r):
+        return -1
+    case r == 'أ' || r == 'إ' || r == 'آ' || r == 'ٱ':
+        return 'ا'
+    case r == 'ى':
+        return 'ي'
+    case r == 'ة':
+        return 'ه'
+    }
+    return unicode.ToLower(r)
+}
+
+// isTashkeel reports whether r is an Arabic diacritic or Quranic annotation mark.
+func isTashkeel(r rune) bool {
+    switch {
+    case r >= 0x0610 && r <= 0x061A:
+        return true
+    case r >= 0x064B && r <= 0x065F:
+        return true
+    case r == 0x0670:
+        return true
+    case r >= 0x06D6 && r <= 0x06DC:
+        return true
+    case r >= 0x06DF && r <= 0x06E8:
+        return true
+    case r >= 0x06EA && r <= 0x06ED:
+        return true
+    }
+    return false
+}
@@ -0,0 +1,57 @@
+package index
+
+import "unicode"
+
+// Token is a normalized term and the byte range [Start, End) of the word it
+// came from in the original text.
+type Token struct {
+    Term       string
+    Start, End int
+}
+
+// Terms splits s into normalized index terms (see Normalize). A term is a
+// maximal run of letters, digits and combining marks, so Arabic harakat stay
+// attached to the word they belong to until normalization strips them.
+func Terms(s string) []string {
+    var out []string
+    scan(s, func(t Token) { out = append(out, t.Term) })
+    return out
+}
+
+// Tokens is like Terms but also reports where each term occurs in s.
+func Tokens(s string) []Token {
+    var out []Token
+    scan(s, func(t Token) { out = append(out, t) })
+    return out
+}
+
+func scan(s string, fn func(Token)) {
+    start := -1
+    for i, r := range s {
+        if isTermRune(r) {
+            if start < 0 {
+                start = i
+            }
+            continue
+        }
+        if start >= 0 {
+            emit(s, start, i, fn)
+            start = -1
+        }
+    }
+    if start >= 0 {
+        emit(s, start, len(s), fn)
+    }
+}
+
+// emit normalizes the word s[start:end] and reports it unless nothing is
+// left, as happens for a stray run of diacritics.
+func emit(s string, start, end int, fn func(Token)) {
+    if t := Normalize(s[start:end]); t != "" {
+        fn(Token{Term: t, Start: start, End: end})
+    }
+}
+
+func isTermRune(r rune) bool {
+    return unicode.IsLetter(r) || unicode.IsNumber(r) || unicode.IsMark(r)
+}
@@ -0,0 +1,95 @@
+package search
+
+import (
+    "container/heap"
+    "sort"
+)
+
+// Cursor marks a result by its sort key: score, then book and number.
+// Query.After and SelectPage continue right after it.
+type Cursor struct {
+    Score  float64
+    Book   string
+    Number int
+}
+
+// CursorOf returns the cursor of r.
+func CursorOf(r Result) Cursor {
+    return Cursor{Score: r.Score, Book: r.Hadith.Book, Number: r.Hadith.Number}
+}
+
+// sortsBefore reports whether a comes before b in result order: higher
+// scores first, then by book and number, as sortResults orders them.
+func sortsBefore(a, b Cursor) bool {
+    if a.Score != b.Score {
+        return a.Score > b.Score
+    }
+    if a.Book != b.Book {
+        return a.Book < b.Book
+    }
+    return a.Number < b.Number
+}
+
+// SelectPage picks one page of n unsorted hits whose sort keys key
+// returns: the hits [offset, offset+limit) in result order among those
+// that sort after after (nil: all). It returns their indexes in result
+// order. limit <= 0 means no cap. With a limit, a bounded heap keeps the
+// best offset+limit hits as they go by, so only those are ever sorted.
+func SelectPage(n int, key func(i int) Cursor, after *Cursor, offset, limit int) []int {
+    if offset < 0 {
+        offset = 0
+    }
+    keep := func(c Cursor) bool { return after == nil || sortsBefore(*after, c) }
+    var page []int
+    if limit <= 0 {
+        for i := 0; i < n; i++ {
+            if keep(key(i)) {
+                page = append(page, i)
+            }
+        }
+    } else {
+        h := &pageHeap{key: key, max: offset + limit}
+        for i := 0; i < n; i++ {
+            if c := key(i); keep(c) {
+                h.offer(i, c)
+            }
+        }
+        page = h.idx
+    }
+    sort.Slice(page, func(i, j int) bool { return sortsBefore(key(page[i]), key(page[j])) })
+    if offset > len(page) {
+        offset = len(page)
+    }
+    return page[offset:]
+}
+
+// pageHeap holds the best max hits seen so far, with the one that sorts
+// last on top.
+type pageHeap struct {
+    idx []int
+    key func(i int) Cursor
+    max int
+}
+
+// offer adds hit i, whose key is c, if it is among the best max so far.
+func (h *pageHeap) offer(i int, c Cursor) {
+    if len(h.idx) < h.max {
+        heap.Push(h, i)
+        return
+    }
+    if sortsBefore(c, h.key(h.idx[0])) {
+        h.idx[0] = i
+        heap.Fix(h, 0)
+    }
+}
+
+func (h *pageHeap) Len() int           { return len(h.idx) }
+func (h *pageHeap) Less(i, j int) bool { return sortsBefore(h.key(h.idx[j]), h.key(h.idx[i])) }
+func (h *pageHeap) Swap(i, j int)      { h.idx[i], h.idx[j] = h.idx[j], h.idx[i] }
+func (h *pageHeap) Push(x any)         { h.idx = append(h.idx, x.(int)) }
+
+func (h *pageHeap) Pop() any {
+    last := h.idx[len(h.idx)-1]
+    h.idx = h.idx[:len(h.idx)-1]
+    return last
+}
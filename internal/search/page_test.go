@@ -0,0 +1,73 @@
+package search
+
+import (
+    "math/rand"
+    "reflect"
+    "sort"
+    "testing"
+)
+
+func TestSelectPage(t *testing.T) {
+    // Few distinct scores, so that ties fall back to book and number.
+    rng := rand.New(rand.NewSource(1))
+    keys := make([]Cursor, 200)
+    for i := range keys {
+        keys[i] = Cursor{Score: float64(rng.Intn(5)), Book: []string{"darimi", "malik"}[rng.Intn(2)], Number: i}
+    }
+    key := func(i int) Cursor { return keys[i] }
+    sorted := make([]int, len(keys))
+    for i := range sorted {
+        sorted[i] = i
+    }
+    sort.Slice(sorted, func(i, j int) bool { return sortsBefore(keys[sorted[i]], keys[sorted[j]]) })
+
+    for _, at := range []int{-1, 0, 57, 198, 199} {
+        var after *Cursor
+        rest := sorted
+        if at >= 0 {
+            after = &keys[sorted[at]]
+            rest = sorted[at+1:]
+        }
+        for _, offset := range []int{-3, 0, 1, 30, len(rest), len(rest) + 5} {
+            for _, limit := range []int{0, 1, 11, len(rest) + 10} {
+                want := rest[min(max(offset, 0), len(rest)):]
+                if limit > 0 && len(want) > limit {
+                    want = want[:limit]
+                }
+                got := SelectPage(len(keys), key, after, offset, limit)
+                if len(got) != len(want) || (len(want) > 0 && !reflect.DeepEqual(got, want)) {
+                    t.Errorf("after #%d, offset %d, limit %d: got %v, want %v", at, offset, limit, got, want)
+                }
+            }
+        }
+    }
+}
+
+func TestRunPage(t *testing.T) {
+    s := testStore(t)
+    q, err := Parse("shalat OR niat")
+    if err != nil {
+        t.Fatal(err)
+    }
+    all := q.Run(s, 0)
+    if len(all) != 6 {
+        t.Fatalf("got %d results, want 6", len(all))
+    }
+    // Page two results at a time, each page continuing after the last.
+    var paged []Result
+    for {
+        results, total := q.RunPage(s, DefaultRanking, 0, 2)
+        if total != len(all) {
+            t.Fatalf("after %d results: total = %d, want %d", len(paged), total, len(all))
+        }
+        if len(results) == 0 {
+            break
+        }
+        paged = append(paged, results...)
+        c := CursorOf(results[len(results)-1])
+        q.After = &c
+    }
+    if !reflect.DeepEqual(paged, all) {
+        t.Errorf("pages = %q, want %q", refs(paged), refs(all))
+    }
+}
@@ -0,0 +1,391 @@
+package search
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+    "unicode"
+    "unicode/utf8"
+
+    "github.com/nuzlilatief/hadith-go/internal/data"
+)
+
+// Query is a parsed search query. The syntax is:
+//
+//    niat                 word in the translation (see Lang), Arabic text or book name
+//    "niat yang baik"     exact phrase
+//    id:niat arab:صلاة    word or phrase scoped to one field
+//    book:malik           hadiths of one book (exact name, case-insensitive)
+//    number:10..20        hadith numbers in a range; also number:7, number:10.., number:..20
+//    a AND b, a OR b      boolean operators (upper case); adjacent terms are ANDed
+//    NOT a                exclusion
+//    (a OR b) c           grouping
+//
+// Words and phrases match as case-insensitive substrings of the normalized
+// text, as SimpleSearch does. Unscoped words search the Arabic text and the
+// translation selected by Lang; id: always means the Indonesian text.
+type Query struct {
+    // Lang is the language code of the translation that unscoped words
+    // search and Highlight marks. Empty means data.DefaultLang.
+    Lang string
+    // Book, when set, restricts the results to the book of that exact
+    // name before they are scored and sorted.
+    Book string
+    // After, when set, drops the results that sort at or before it, so
+    // that RunPage can continue a search from a page token.
+    After *Cursor
+
+    root node
+}
+
+func (q *Query) lang() string {
+    if q.Lang == "" {
+        return data.DefaultLang
+    }
+    return q.Lang
+}
+
+// SyntaxError reports a malformed query.
+type SyntaxError struct {
+    Pos int // byte offset in the query
+    Msg string
+}
+
+func (e *SyntaxError) Error() string {
+    return fmt.Sprintf("query syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+// Fields lists the field names accepted before a colon in a query.
+var Fields = []string{"book", "number", "arab", "id"}
+
+type node interface{}
+
+// termNode matches text in field, or in the Indonesian text, Arabic text and
+// book name when field is empty.
+type termNode struct {
+    field string
+    text  string
+}
+
+type bookNode struct{ name string }
+
+// numberNode matches numbers in [from, to]; zero bounds are open.
+type numberNode struct{ from, to int }
+
+type andNode []node
+type orNode []node
+type notNode struct{ n node }
+
+// Parse parses a query string. An empty or blank query yields a nil Query and no error.
+func Parse(s string) (*Query, error) {
+    toks, err := lex(s)
+    if err != nil {
+        return nil, err
+    }
+    if len(toks) == 0 {
+        return nil, nil
+    }
+    p := &parser{toks: toks, src: s}
+    root, err := p.parseOr()
+    if err != nil {
+        return nil, err
+    }
+    if !p.done() {
+        t := p.peek()
+        if t.kind == tokRParen {
+            return nil, &SyntaxError{Pos: t.pos, Msg: "unbalanced ')'"}
+        }
+        return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+    }
+    return &Query{root: root}, nil
+}
+
+type tokKind int
+
+const (
+    tokWord tokKind = iota
+    tokAnd
+    tokOr
+    tokNot
+    tokLParen
+    tokRParen
+)
+
+type token struct {
+    kind   tokKind
+    pos    int
+    field  string // tokWord: optional field prefix
+    text   string // tokWord: value
+    quoted bool
+}
+
+func (t token) String() string {
+    switch t.kind {
+    case tokAnd:
+        return "AND"
+    case tokOr:
+        return "OR"
+    case tokNot:
+        return "NOT"
+    case tokLParen:
+        return "'('"
+    case tokRParen:
+        return "')'"
+    }
+    if t.quoted {
+        return strconv.Quote(t.text)
+    }
+    return "'" + t.text + "'"
+}
+
+func lex(s string) ([]token, error) {
+    var toks []token
+    i := 0
+    for i < len(s) {
+        r, size := utf8.DecodeRuneInString(s[i:])
+        switch {
+        case unicode.IsSpace(r):
+            i += size
+        case r == '(':
+            toks = append(toks, token{kind: tokLParen, pos: i})
+            i++
+        case r == ')':
+            toks = append(toks, token{kind: tokRParen, pos: i})
+            i++
+        case r == '"':
+            text, n, err := lexQuoted(s, i)
+            if err != nil {
+                return nil, err
+            }
+            toks = append(toks, token{kind: tokWord, pos: i, text: text, quoted: true})
+            i += n
+        default:
+            start := i
+            for i < len(s) {
+                r, size := utf8.DecodeRuneInString(s[i:])
+                if unicode.IsSpace(r) || r == '(' || r == ')' || r == '"' || r == ':' {
+                    break
+                }
+                i += size
+            }
+            word := s[start:i]
+            if i < len(s) && s[i] == ':' {
+                // "word: text" (colon then space) is plain text as pasted
+                // from a translation; "word:value" is a field term.
+                if !isField(strings.ToLower(word)) && (i+1 == len(s) || isSpaceAt(s, i+1)) {
+                    toks = append(toks, token{kind: tokWord, pos: start, text: word})
+                    i++
+                    continue
+                }
+                tok, n, err := lexField(s, start, word, i+1)
+                if err != nil {
+                    return nil, err
+                }
+                toks = append(toks, tok)
+                i = n
+                continue
+            }
+            switch word {
+            case "AND":
+                toks = append(toks, token{kind: tokAnd, pos: start})
+            case "OR":
+                toks = append(toks, token{kind: tokOr, pos: start})
+            case "NOT":
+                toks = append(toks, token{kind: tokNot, pos: start})
+            default:
+                toks = append(toks, token{kind: tokWord, pos: start, text: word})
+            }
+        }
+    }
+    return toks, nil
+}
+
+// lexQuoted reads a double-quoted phrase starting at s[at] and returns its
+// text and the number of bytes consumed.
+func lexQuoted(s string, at int) (string, int, error) {
+    end := strings.IndexByte(s[at+1:], '"')
+    if end < 0 {
+        return "", 0, &SyntaxError{Pos: at, Msg: "unterminated quoted phrase"}
+    }
+    text := strings.TrimSpace(s[at+1 : at+1+end])
+    if text == "" {
+        return "", 0, &SyntaxError{Pos: at, Msg: "empty quoted phrase"}
+    }
+    return text, end + 2, nil
+}
+
+// lexField reads the value of a "field:value" term whose field name is
+// s[start:] up to the colon and whose value starts at s[at]. It returns the
+// token and the offset just past the value.
+func lexField(s string, start int, field string, at int) (token, int, error) {
+    name := strings.ToLower(field)
+    if !isField(name) {
+        return token{}, 0, &SyntaxError{Pos: start, Msg: fmt.Sprintf("unknown field %q (want one of %s)", field, strings.Join(Fields, ", "))}
+    }
+    tok := token{kind: tokWord, pos: start, field: name}
+    if at < len(s) && s[at] == '"' {
+        text, n, err := lexQuoted(s, at)
+        if err != nil {
+            return token{}, 0, err
+        }
+        tok.text, tok.quoted = text, true
+        return tok, at + n, nil
+    }
+    end := at
+    for end < len(s) {
+        r, size := utf8.DecodeRuneInString(s[end:])
+        if unicode.IsSpace(r) || r == '(' || r == ')' {
+            break
+        }
+        end += size
+    }
+    if end == at {
+        return token{}, 0, &SyntaxError{Pos: start, Msg: fmt.Sprintf("missing value after %s:", field)}
+    }
+    tok.text = s[at:end]
+    return tok, end, nil
+}
+
+func isSpaceAt(s string, i int) bool {
+    r, _ := utf8.DecodeRuneInString(s[i:])
+    return unicode.IsSpace(r)
+}
+
+func isField(name string) bool {
+    for _, f := range Fields {
+        if f == name {
+            return true
+        }
+    }
+    return false
+}
+
+type parser struct {
+    toks []token
+    i    int
+    src  string
+}
+
+func (p *parser) done() bool  { return p.i >= len(p.toks) }
+func (p *parser) peek() token { return p.toks[p.i] }
+func (p *parser) next() token { t := p.toks[p.i]; p.i++; return t }
+func (p *parser) endPos() int { return len(p.src) }
+
+func (p *parser) parseOr() (node, error) {
+    left, err := p.parseAnd()
+    if err != nil {
+        return nil, err
+    }
+    or := orNode{left}
+    for !p.done() && p.peek().kind == tokOr {
+        p.next()
+        right, err := p.parseAnd()
+        if err != nil {
+            return nil, err
+        }
+        or = append(or, right)
+    }
+    if len(or) == 1 {
+        return left, nil
+    }
+    return or, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+    left, err := p.parseUnary()
+    if err != nil {
+        return nil, err
+    }
+    and := andNode{left}
+    for !p.done() {
+        t := p.peek()
+        if t.kind == tokAnd {
+            p.next()
+        } else if t.kind == tokOr || t.kind == tokRParen {
+            break
+        }
+        right, err := p.parseUnary()
+        if err != nil {
+            return nil, err
+        }
+        and = append(and, right)
+    }
+    if len(and) == 1 {
+        return left, nil
+    }
+    return and, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+    if p.done() {
+        return nil, &SyntaxError{Pos: p.endPos(), Msg: "unexpected end of query"}
+    }
+    t := p.next()
+    switch t.kind {
+    case tokNot:
+        n, err := p.parseUnary()
+        if err != nil {
+            return nil, err
+        }
+        return notNode{n}, nil
+    case tokLParen:
+        n, err := p.parseOr()
+        if err != nil {
+            return nil, err
+        }
+        if p.done() || p.peek().kind != tokRParen {
+            return nil, &SyntaxError{Pos: t.pos, Msg: "unbalanced '('"}
+        }
+        p.next()
+        return n, nil
+    case tokWord:
+        return leaf(t)
+    }
+    return nil, &SyntaxError{Pos: t.pos, Msg: fmt.Sprintf("unexpected %s", t)}
+}
+
+func leaf(t token) (node, error) {
+    switch t.field {
+    case "book":
+        return bookNode{name: t.text}, nil
+    case "number":
+        n, err := parseRange(t.text)
+        if err != nil {
+            return nil, &SyntaxError{Pos: t.pos, Msg: err.Error()}
+        }
+        return n, nil
+    }
+    return termNode{field: t.field, text: t.text}, nil
+}
+
+// parseRange parses "7", "10..20", "10.." or "..20".
+func parseRange(s string) (numberNode, error) {
+    bad := fmt.Errorf("invalid number range %q (want N, A..B, A.. or ..B)", s)
+    lo, hi, isRange := strings.Cut(s, "..")
+    if !isRange {
+        n, err := strconv.Atoi(s)
+        if err != nil || n < 1 {
+            return numberNode{}, bad
+        }
+        return numberNode{from: n, to: n}, nil
+    }
+    if lo == "" && hi == "" {
+        return numberNode{}, bad
+    }
+    var r numberNode
+    var err error
+    if lo != "" {
+        if r.from, err = strconv.Atoi(lo); err != nil || r.from < 1 {
+            return numberNode{}, bad
+        }
+    }
+    if hi != "" {
+        if r.to, err = strconv.Atoi(hi); err != nil || r.to < 1 {
+            return numberNode{}, bad
+        }
+    }
+    if r.to != 0 && r.from > r.to {
+        return numberNode{}, fmt.Errorf("empty number range %q", s)
+    }
+    return r, nil
+}
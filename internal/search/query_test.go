@@ -0,0 +1,190 @@
+package search
+
+import (
+    "errors"
+    "fmt"
+    "reflect"
+    "sort"
+    "strings"
+    "testing"
+    "testing/fstest"
+
+    "github.com/nuzlilatief/hadith-go/internal/data"
+)
+
+func TestParse(t *testing.T) {
+    w := func(text string) termNode { return termNode{text: text} }
+    tests := []struct {
+        in   string
+        want node
+    }{
+        {"niat", w("niat")},
+        {`"niat yang baik"`, w("niat yang baik")},
+        {`"  padded  "`, w("padded")},
+        {"id:niat arab:صلاة", andNode{termNode{field: "id", text: "niat"}, termNode{field: "arab", text: "صلاة"}}},
+        {`ID:"niat baik"`, termNode{field: "id", text: "niat baik"}},
+        {"book:Malik", bookNode{name: "Malik"}},
+        {"number:7", numberNode{from: 7, to: 7}},
+        {"number:10..20", numberNode{from: 10, to: 20}},
+        {"number:10..", numberNode{from: 10}},
+        {"number:..20", numberNode{to: 20}},
+        {"number:5..5", numberNode{from: 5, to: 5}},
+        // Adjacent terms and AND both bind tighter than OR.
+        {"a b OR c", orNode{andNode{w("a"), w("b")}, w("c")}},
+        {"a OR b AND c", orNode{w("a"), andNode{w("b"), w("c")}}},
+        {"a OR b OR c", orNode{w("a"), w("b"), w("c")}},
+        // NOT binds tighter than AND.
+        {"NOT a b", andNode{notNode{w("a")}, w("b")}},
+        {"a NOT b OR c", orNode{andNode{w("a"), notNode{w("b")}}, w("c")}},
+        {"NOT NOT a", notNode{notNode{w("a")}}},
+        {"(a OR b) c", andNode{orNode{w("a"), w("b")}, w("c")}},
+        {"NOT (a OR b)", notNode{orNode{w("a"), w("b")}}},
+        // Operators are upper case only.
+        {"a or b", andNode{w("a"), w("or"), w("b")}},
+        // "word: text" as pasted from a translation is plain text.
+        {"Rasulullah bersabda: niat", andNode{w("Rasulullah"), w("bersabda"), w("niat")}},
+        {"bersabda:", w("bersabda")},
+    }
+    for _, tt := range tests {
+        t.Run(tt.in, func(t *testing.T) {
+            q, err := Parse(tt.in)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(q.root, tt.want) {
+                t.Errorf("Parse(%q) = %#v, want %#v", tt.in, q.root, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseEmpty(t *testing.T) {
+    for _, in := range []string{"", "   ", "\t\n"} {
+        if q, err := Parse(in); q != nil || err != nil {
+            t.Errorf("Parse(%q) = %v, %v, want nil, nil", in, q, err)
+        }
+    }
+}
+
+func TestParseErrors(t *testing.T) {
+    tests := []struct {
+        in  string
+        pos int
+        msg string
+    }{
+        {`niat "yang baik`, 5, "unterminated quoted phrase"},
+        {`""`, 0, "empty quoted phrase"},
+        {`id:"  "`, 3, "empty quoted phrase"},
+        {"foo:bar", 0, `unknown field "foo"`},
+        {"id: niat", 0, "missing value after id:"},
+        {"book:", 0, "missing value after book:"},
+        {"number:abc", 0, "invalid number range"},
+        {"number:0", 0, "invalid number range"},
+        {"number:..", 0, "invalid number range"},
+        {"number:1..x", 0, "invalid number range"},
+        {"a number:20..10", 2, `empty number range "20..10"`},
+        {"(a OR b", 0, "unbalanced '('"},
+        {"a OR b)", 6, "unbalanced ')'"},
+        {"a AND", 5, "unexpected end of query"},
+        {"NOT", 3, "unexpected end of query"},
+        {"a OR OR b", 5, "unexpected OR"},
+        {"()", 1, "unexpected ')'"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.in, func(t *testing.T) {
+            _, err := Parse(tt.in)
+            var se *SyntaxError
+            if !errors.As(err, &se) {
+                t.Fatalf("Parse(%q) error = %v, want a *SyntaxError", tt.in, err)
+            }
+            if se.Pos != tt.pos || !strings.Contains(se.Msg, tt.msg) {
+                t.Errorf("Parse(%q) = %v, want position %d and %q", tt.in, err, tt.pos, tt.msg)
+            }
+        })
+    }
+}
+
+// testStore loads a few short hadiths from two books.
+func testStore(t testing.TB) *data.Store {
+    t.Helper()
+    s, err := data.NewStoreFS(fstest.MapFS{
+        "malik.json": {Data: []byte(`[
+            {"number": 1, "arab": "إنما الأعمال بالنيات", "id": "Amal itu tergantung niat"},
+            {"number": 2, "arab": "الصلاة", "id": "Shalat lima waktu"},
+            {"number": 3, "arab": "الصيام", "id": "Puasa di bulan Ramadhan dan shalat malam"},
+            {"number": 10, "arab": "الزكاة", "id": "Zakat fitrah dan niat yang ikhlas"}
+        ]`)},
+        "darimi.json": {Data: []byte(`[
+            {"number": 1, "arab": "العلم", "id": "Menuntut ilmu dengan niat baik"},
+            {"number": 2, "arab": "الصلاة", "id": "Shalat berjamaah di masjid"}
+        ]`)},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    return s
+}
+
+func TestRun(t *testing.T) {
+    s := testStore(t)
+    tests := []struct {
+        in   string
+        book string // Query.Book
+        want []string
+    }{
+        {in: "niat", want: []string{"darimi 1", "malik 1", "malik 10"}},
+        {in: "shalat niat", want: nil},
+        {in: "shalat OR niat", want: []string{"darimi 1", "darimi 2", "malik 1", "malik 2", "malik 3", "malik 10"}},
+        {in: "shalat dan OR niat", want: []string{"darimi 1", "malik 1", "malik 3", "malik 10"}},
+        {in: "shalat (dan OR niat)", want: []string{"malik 3"}},
+        {in: "shalat NOT book:malik", want: []string{"darimi 2"}},
+        {in: "NOT (shalat OR niat)", want: nil},
+        {in: `"niat yang"`, want: []string{"malik 10"}},
+        {in: `"yang niat"`, want: nil},
+        {in: "id:niat", want: []string{"darimi 1", "malik 1", "malik 10"}},
+        {in: "arab:الصلاة", want: []string{"darimi 2", "malik 2"}},
+        {in: "book:MALIK number:2..3", want: []string{"malik 2", "malik 3"}},
+        {in: "number:3..", want: []string{"malik 3", "malik 10"}},
+        {in: "number:..1", want: []string{"darimi 1", "malik 1"}},
+        // A book name matches as a word.
+        {in: "darimi", want: []string{"darimi 1", "darimi 2"}},
+        {in: "niat", book: "darimi", want: []string{"darimi 1"}},
+        {in: "niat", book: "Darimi", want: nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.in+"/"+tt.book, func(t *testing.T) {
+            q, err := Parse(tt.in)
+            if err != nil {
+                t.Fatal(err)
+            }
+            q.Book = tt.book
+            got := refs(q.Run(s, 0))
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("Run(%q) = %q, want %q", tt.in, got, tt.want)
+            }
+        })
+    }
+}
+
+// refs names the results as "book number", ordered by book and number.
+func refs(results []Result) []string {
+    sort.Slice(results, func(i, j int) bool {
+        a, b := results[i].Hadith, results[j].Hadith
+        if a.Book != b.Book {
+            return a.Book < b.Book
+        }
+        return a.Number < b.Number
+    })
+    var out []string
+    for _, r := range results {
+        out = append(out, fmt.Sprintf("%s %d", r.Hadith.Book, r.Hadith.Number))
+    }
+    return out
+}
+
+func TestRunNil(t *testing.T) {
+    var q *Query
+    if got := q.Run(testStore(t), 0); got != nil {
+        t.Errorf("nil query gave %d results", len(got))
+    }
+}
@@ -0,0 +1,51 @@
+package search
+
+import "math"
+
+// Ranking configures BM25 relevance scoring. A result's score is the sum,
+// over every non-negated word or phrase of the query and every field it
+// matched, of the field boost times the BM25 weight of its terms in that
+// field. A match on the book name adds the "book" boost as a flat bonus.
+type Ranking struct {
+    K1 float64 // term frequency saturation
+    B  float64 // document length normalization, 0..1
+    // Boosts weights fields by name: "arab", "book", a language code such
+    // as "id" or "en", or "translation" as the fallback for any language
+    // without its own entry. Fields with a zero boost do not contribute to
+    // the score.
+    Boosts map[string]float64
+}
+
+// DefaultRanking favours the translation over the Arabic, mirroring the
+// former fixed 3/2/1 scores.
+var DefaultRanking = Ranking{
+    K1: 1.2,
+    B:  0.75,
+    Boosts: map[string]float64{
+        "translation": 1.5,
+        "arab":        1.0,
+        "book":        0.5,
+    },
+}
+
+func (r Ranking) boost(field string) float64 {
+    if b, ok := r.Boosts[field]; ok || field == "arab" || field == "book" {
+        return b
+    }
+    return r.Boosts["translation"]
+}
+
+// idf is the BM25 inverse document frequency of a term found in df of n documents.
+func idf(n, df int) float64 {
+    return math.Log(1 + (float64(n)-float64(df)+0.5)/(float64(df)+0.5))
+}
+
+// bm25 weighs a term occurring tf times in a field of docLen terms.
+func (r Ranking) bm25(idf float64, tf, docLen int, avgLen float64) float64 {
+    norm := 1.0
+    if avgLen > 0 {
+        norm = 1 - r.B + r.B*float64(docLen)/avgLen
+    }
+    t := float64(tf)
+    return idf * t * (r.K1 + 1) / (t + r.K1*norm)
+}
@@ -0,0 +1,122 @@
+package search
+
+import (
+    "math"
+    "testing"
+)
+
+func TestIDF(t *testing.T) {
+    // Rarer terms weigh more, and even a term in every document keeps a
+    // positive weight.
+    prev := math.Inf(1)
+    for df := 1; df <= 100; df++ {
+        w := idf(100, df)
+        if w <= 0 || w >= prev {
+            t.Fatalf("idf(100, %d) = %v after %v", df, w, prev)
+        }
+        prev = w
+    }
+}
+
+func TestBM25(t *testing.T) {
+    r := DefaultRanking
+    // More occurrences score higher but saturate below idf*(k1+1).
+    prev := 0.0
+    for tf := 1; tf <= 50; tf++ {
+        s := r.bm25(1, tf, 10, 10)
+        if s <= prev || s >= r.K1+1 {
+            t.Fatalf("bm25 at tf=%d = %v after %v", tf, s, prev)
+        }
+        prev = s
+    }
+    // A longer field scores lower for the same count; with B=0 length is ignored.
+    if short, long := r.bm25(1, 2, 5, 10), r.bm25(1, 2, 20, 10); short <= long {
+        t.Errorf("short field %v <= long field %v", short, long)
+    }
+    flat := Ranking{K1: 1.2, B: 0}
+    if short, long := flat.bm25(1, 2, 5, 10), flat.bm25(1, 2, 20, 10); short != long {
+        t.Errorf("B=0: short field %v != long field %v", short, long)
+    }
+    // An empty index (no average length) does not divide by zero.
+    if s := r.bm25(1, 1, 0, 0); math.IsNaN(s) || math.IsInf(s, 0) {
+        t.Errorf("bm25 with avgLen 0 = %v", s)
+    }
+}
+
+func TestBoost(t *testing.T) {
+    r := Ranking{Boosts: map[string]float64{"translation": 2, "en": 3, "arab": 1}}
+    tests := []struct {
+        field string
+        want  float64
+    }{
+        {"en", 3},
+        {"id", 2}, // falls back to "translation"
+        {"ms", 2},
+        {"arab", 1},
+        {"book", 0}, // never falls back
+    }
+    for _, tt := range tests {
+        if got := r.boost(tt.field); got != tt.want {
+            t.Errorf("boost(%q) = %v, want %v", tt.field, got, tt.want)
+        }
+    }
+}
+
+func TestRunRanked(t *testing.T) {
+    s := testStore(t)
+    q, err := Parse("niat")
+    if err != nil {
+        t.Fatal(err)
+    }
+    // Shorter translations containing the word rank first.
+    got := q.Run(s, 0)
+    want := []string{"malik 1", "darimi 1", "malik 10"}
+    if len(got) != len(want) {
+        t.Fatalf("got %d results, want %d", len(got), len(want))
+    }
+    for i, r := range got {
+        if name := refs([]Result{r})[0]; name != want[i] {
+            t.Errorf("result %d = %s, want %s", i, name, want[i])
+        }
+        if r.Score <= 0 {
+            t.Errorf("%s has score %v", want[i], r.Score)
+        }
+        if i > 0 && r.Score > got[i-1].Score {
+            t.Errorf("results not sorted by score: %v after %v", r.Score, got[i-1].Score)
+        }
+    }
+    if got := q.Run(s, 2); len(got) != 2 {
+        t.Errorf("limit 2 gave %d results", len(got))
+    }
+
+    // With every boost at zero the matches stay but all scores tie, so
+    // results fall back to book and number order.
+    zero := Ranking{K1: 1.2, B: 0.75, Boosts: map[string]float64{"translation": 0}}
+    got = q.RunRanked(s, 0, zero)
+    if len(got) != 3 {
+        t.Fatalf("zero boosts: got %d results, want 3", len(got))
+    }
+    for i, r := range got {
+        if r.Score != 0 {
+            t.Errorf("zero boosts: %s has score %v", refs([]Result{r})[0], r.Score)
+        }
+        if name := refs([]Result{r})[0]; name != []string{"darimi 1", "malik 1", "malik 10"}[i] {
+            t.Errorf("zero boosts: result %d = %s", i, name)
+        }
+    }
+
+    // Negated words do not add to the score.
+    neg, err := Parse("niat NOT shalat")
+    if err != nil {
+        t.Fatal(err)
+    }
+    scores := map[string]float64{}
+    for _, r := range q.Run(s, 0) {
+        scores[refs([]Result{r})[0]] = r.Score
+    }
+    for _, r := range neg.Run(s, 0) {
+        if name := refs([]Result{r})[0]; r.Score != scores[name] {
+            t.Errorf("%s: score %v with NOT shalat, %v without", name, r.Score, scores[name])
+        }
+    }
+}
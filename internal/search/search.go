@@ -7,51 +7,35 @@ import (
     "sync"
 
     "github.com/nuzlilatief/hadith-go/internal/data"
+    "github.com/nuzlilatief/hadith-go/internal/search/index"
 )
 
-// Result is a search hit with a simple score heuristic.
+// Result is a search hit. Search scores hits with BM25 (see Ranking);
+// SimpleSearch and ConcurrentSearch keep the fixed 3/2/1 heuristic.
+// Matches holds the matched spans per field ("arab" or a language code such
+// as "id") once Query.Highlight has run.
 type Result struct {
-    Hadith data.Hadith
-    Score  int
+    Hadith  data.Hadith
+    Score   float64
+    Matches map[string][]Span `json:",omitempty"`
 }
 
 // SimpleSearch performs a case-insensitive substring search across arab and id texts and book name.
+// Text and query are compared in normalized form (see index.Normalize), so Arabic diacritics are ignored;
+// the documents are matched against c.Norm, normalized once at load time.
 // It returns up to limit results sorted by score then by book+number.
-func SimpleSearch(all []data.Hadith, query string, limit int) []Result {
+func SimpleSearch(c *data.Corpus, query string, limit int) []Result {
     q := strings.TrimSpace(query)
     if q == "" {
         return nil
     }
-    ql := strings.ToLower(q)
-    results := make([]Result, 0, limit)
-    for _, h := range all {
-        score := 0
-        if strings.Contains(strings.ToLower(h.ID), ql) {
-            score += 3
-        }
-        if strings.Contains(strings.ToLower(h.Arab), ql) {
-            score += 2
-        }
-        if strings.Contains(strings.ToLower(h.Book), ql) {
-            score += 1
-        }
-        if score > 0 {
-            results = append(results, Result{Hadith: h, Score: score})
-            if limit > 0 && len(results) >= limit {
-                // do not break; we want to collect all to sort properly
-            }
-        }
+    ql := index.Normalize(q)
+    if ql == "" {
+        // e.g. a query made only of harakat
+        return nil
     }
-    sort.Slice(results, func(i, j int) bool {
-        if results[i].Score != results[j].Score {
-            return results[i].Score > results[j].Score
-        }
-        // tie-breaker: book then number
-        if results[i].Hadith.Book != results[j].Hadith.Book {
-            return results[i].Hadith.Book < results[j].Hadith.Book
-        }
-        return results[i].Hadith.Number < results[j].Hadith.Number
-    })
+    results := searchChunk(c.All, c.Norm, ql)
+    sortResults(results)
     if limit > 0 && len(results) > limit {
         return results[:limit]
     }
@@ -61,22 +45,25 @@ func SimpleSearch(all []data.Hadith, query string, limit int) []Result {
 // ConcurrentSearch performs the same search as SimpleSearch but uses concurrency
 // to parallelize the search across chunks of hadith data for better performance
 // on large datasets.
-func ConcurrentSearch(all []data.Hadith, query string, limit int) []Result {
+func ConcurrentSearch(c *data.Corpus, query string, limit int) []Result {
     q := strings.TrimSpace(query)
     if q == "" {
         return nil
     }
-    
+    all := c.All
     if len(all) == 0 {
         return nil
     }
     
     // For small datasets, use the simple version to avoid goroutine overhead
     if len(all) < 1000 {
-        return SimpleSearch(all, query, limit)
+        return SimpleSearch(c, query, limit)
     }
     
-    ql := strings.ToLower(q)
+    ql := index.Normalize(q)
+    if ql == "" {
+        return nil
+    }
     numWorkers := runtime.NumCPU()
     if numWorkers > len(all) {
         numWorkers = len(all)
@@ -103,11 +90,11 @@ func ConcurrentSearch(all []data.Hadith, query string, limit int) []Result {
         }
         
         wg.Add(1)
-        go func(chunk []data.Hadith) {
+        go func(chunk []data.Hadith, norm []data.NormText) {
             defer wg.Done()
-            chunkResults := searchChunk(chunk, ql)
+            chunkResults := searchChunk(chunk, norm, ql)
             resultsChan <- chunkResults
-        }(all[start:end])
+        }(all[start:end], c.Norm[start:end])
     }
     
     // Close channel when all workers are done
@@ -123,16 +110,7 @@ func ConcurrentSearch(all []data.Hadith, query string, limit int) []Result {
     }
     
     // Sort all results
-    sort.Slice(allResults, func(i, j int) bool {
-        if allResults[i].Score != allResults[j].Score {
-            return allResults[i].Score > allResults[j].Score
-        }
-        // tie-breaker: book then number
-        if allResults[i].Hadith.Book != allResults[j].Hadith.Book {
-            return allResults[i].Hadith.Book < allResults[j].Hadith.Book
-        }
-        return allResults[i].Hadith.Number < allResults[j].Hadith.Number
-    })
+    sortResults(allResults)
     
     if limit > 0 && len(allResults) > limit {
         return allResults[:limit]
@@ -140,19 +118,19 @@ func ConcurrentSearch(all []data.Hadith, query string, limit int) []Result {
     return allResults
 }
 
-// searchChunk performs search on a chunk of hadith data
+// searchChunk performs search on a chunk of hadith data and its normalized text
 // This is the core search logic extracted for use by workers
-func searchChunk(chunk []data.Hadith, queryLower string) []Result {
+func searchChunk(chunk []data.Hadith, norm []data.NormText, queryNorm string) []Result {
     var results []Result
-    for _, h := range chunk {
-        score := 0
-        if strings.Contains(strings.ToLower(h.ID), queryLower) {
+    for i, h := range chunk {
+        score := 0.0
+        if strings.Contains(norm[i].ID, queryNorm) {
             score += 3
         }
-        if strings.Contains(strings.ToLower(h.Arab), queryLower) {
+        if strings.Contains(norm[i].Arab, queryNorm) {
             score += 2
         }
-        if strings.Contains(strings.ToLower(h.Book), queryLower) {
+        if strings.Contains(norm[i].Book, queryNorm) {
             score += 1
         }
         if score > 0 {
@@ -162,10 +140,37 @@ func searchChunk(chunk []data.Hadith, queryLower string) []Result {
     return results
 }
 
-// Search is the recommended search function that automatically chooses
-// the optimal search method based on dataset size and other factors.
-// It provides the best performance while maintaining the same interface.
-func Search(all []data.Hadith, query string, limit int) []Result {
-    return ConcurrentSearch(all, query, limit)
+// sortResults orders results by score, then by book and number.
+func sortResults(results []Result) {
+    sort.Slice(results, func(i, j int) bool {
+        if results[i].Score != results[j].Score {
+            return results[i].Score > results[j].Score
+        }
+        // tie-breaker: book then number
+        if results[i].Hadith.Book != results[j].Hadith.Book {
+            return results[i].Hadith.Book < results[j].Hadith.Book
+        }
+        return results[i].Hadith.Number < results[j].Hadith.Number
+    })
 }
 
+// Search is the recommended search function. It parses query (see Query for
+// the syntax) and runs it against the store's inverted index. Unlike
+// SimpleSearch, separate words need not be adjacent: "niat baik" finds
+// hadiths containing both words, while the quoted "\"niat baik\"" keeps the
+// substring behaviour. A malformed query returns a *SyntaxError.
+//
+// When limit > 0 the results are also highlighted (see Query.Highlight);
+// callers paging through an uncapped result set should highlight each page
+// themselves.
+func Search(store *data.Store, query string, limit int) ([]Result, error) {
+    q, err := Parse(query)
+    if err != nil {
+        return nil, err
+    }
+    results := q.Run(store, limit)
+    if limit > 0 {
+        q.Highlight(results)
+    }
+    return results, nil
+}
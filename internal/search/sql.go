@@ -0,0 +1,131 @@
+package search
+
+import (
+    "strings"
+    "unicode/utf8"
+
+    "github.com/nuzlilatief/hadith-go/internal/data"
+    "github.com/nuzlilatief/hadith-go/internal/search/index"
+)
+
+// SQL translates q into a boolean SQL expression for the SQLite backend,
+// with ? placeholders for args. The expression refers to the hadiths table
+// as h, with columns id, book, number and nbook (the normalized book name),
+// and to the FTS5 table texts(hid, field, norm) holding the normalized text
+// of each field ("arab" or a language code) and indexed with the trigram
+// tokenizer. Words and phrases match as substrings of the normalized text,
+// as they do in memory. A nil Query yields "0".
+func (q *Query) SQL() (where string, args []any) {
+    if q == nil {
+        return "0", nil
+    }
+    var b strings.Builder
+    q.sql(&b, &args, q.root)
+    return b.String(), args
+}
+
+func (q *Query) sql(b *strings.Builder, args *[]any, n node) {
+    join := func(op string, nodes []node) {
+        b.WriteString("(")
+        for i, c := range nodes {
+            if i > 0 {
+                b.WriteString(op)
+            }
+            q.sql(b, args, c)
+        }
+        b.WriteString(")")
+    }
+    switch n := n.(type) {
+    case andNode:
+        join(" AND ", n)
+    case orNode:
+        join(" OR ", n)
+    case notNode:
+        b.WriteString("NOT ")
+        q.sql(b, args, n.n)
+    case bookNode:
+        b.WriteString("h.book = ? COLLATE NOCASE")
+        *args = append(*args, n.name)
+    case numberNode:
+        b.WriteString("(1")
+        if n.from != 0 {
+            b.WriteString(" AND h.number >= ?")
+            *args = append(*args, n.from)
+        }
+        if n.to != 0 {
+            b.WriteString(" AND h.number <= ?")
+            *args = append(*args, n.to)
+        }
+        b.WriteString(")")
+    case termNode:
+        norm := index.Normalize(n.text)
+        if norm == "" {
+            b.WriteString("0")
+            return
+        }
+        fields := textFields(n.field, q.lang())
+        b.WriteString("(h.id IN (SELECT hid FROM texts WHERE field IN (?" + strings.Repeat(", ?", len(fields)-1) + ") AND ")
+        for _, f := range fields {
+            *args = append(*args, f)
+        }
+        // The trigram index only serves fragments of three or more
+        // characters; shorter ones are checked row by row.
+        if utf8.RuneCountInString(norm) >= 3 {
+            b.WriteString("texts MATCH ?)")
+            *args = append(*args, `norm:"`+strings.ReplaceAll(norm, `"`, `""`)+`"`)
+        } else {
+            b.WriteString("instr(norm, ?) > 0)")
+            *args = append(*args, norm)
+        }
+        if n.field == "" {
+            b.WriteString(" OR instr(h.nbook, ?) > 0")
+            *args = append(*args, norm)
+        }
+        b.WriteString(")")
+    default:
+        b.WriteString("0")
+    }
+}
+
+// Score ranks h against q without corpus statistics, for backends that
+// have no inverted index in memory: every non-negated word or phrase adds,
+// per field it occurs in, the field boost times its saturated occurrence
+// count, and a match on the book name adds the "book" boost. Scores are
+// comparable within one result set only.
+func (q *Query) Score(h data.Hadith, r Ranking) float64 {
+    if q == nil {
+        return 0
+    }
+    score := 0.0
+    var walk func(n node, negated bool)
+    walk = func(n node, negated bool) {
+        switch n := n.(type) {
+        case andNode:
+            for _, c := range n {
+                walk(c, negated)
+            }
+        case orNode:
+            for _, c := range n {
+                walk(c, negated)
+            }
+        case notNode:
+            walk(n.n, !negated)
+        case termNode:
+            norm := index.Normalize(n.text)
+            if negated || norm == "" {
+                return
+            }
+            for _, field := range textFields(n.field, q.lang()) {
+                tf := float64(strings.Count(index.Normalize(fieldText(h, field)), norm))
+                if tf > 0 {
+                    score += r.boost(field) * tf * (r.K1 + 1) / (tf + r.K1)
+                }
+            }
+            if n.field == "" && strings.Contains(index.Normalize(h.Book), norm) {
+                score += r.Boosts["book"]
+            }
+        }
+    }
+    walk(q.root, false)
+    return score
+}
@@ -0,0 +1,130 @@
+package hadith
+
+import (
+    "crypto/hmac"
+    "crypto/rand"
+    "crypto/sha256"
+    "encoding/base64"
+    "encoding/hex"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "strings"
+
+    "github.com/nuzlilatief/hadith-go/internal/search"
+)
+
+// Cursor marks a search result by its sort key: score, then book and
+// number. Passed as SearchOptions.After it continues a search right after
+// that result, so that pages stay put when earlier hits come and go, and
+// no hits before it need to be skipped one by one.
+type Cursor = search.Cursor
+
+// CursorOf returns the cursor of r.
+func CursorOf(r Result) Cursor {
+    return search.CursorOf(r)
+}
+
+// Errors from PageTokens.Decode.
+var (
+    ErrInvalidToken = errors.New("invalid page token")
+    // ErrStaleToken means the token was issued for other data, e.g. before
+    // a reload; the search has to start again from the first page.
+    ErrStaleToken = errors.New("page token is from another version of the data")
+    // ErrTokenScope means the token was issued for another search: a
+    // different query, book or language.
+    ErrTokenScope = errors.New("page token is for another search")
+)
+
+// PageTokens turns cursors into opaque page tokens for clients and back.
+// A token is signed, so clients cannot forge one, and bound to the data
+// version it was issued for (Repository.Version) and to the search it
+// continues (SearchScope).
+type PageTokens struct {
+    key []byte
+}
+
+// NewPageTokens returns PageTokens signing with key. With an empty key it
+// picks a random one, so its tokens are not accepted by other processes or
+// after a restart.
+func NewPageTokens(key []byte) *PageTokens {
+    if len(key) == 0 {
+        key = make([]byte, 32)
+        if _, err := rand.Read(key); err != nil {
+            panic(err) // crypto/rand does not fail on supported platforms
+        }
+    }
+    return &PageTokens{key: key}
+}
+
+// token is the signed content of a page token.
+type token struct {
+    Version string  `json:"v"`
+    Scope   string  `json:"q"` // hash of SearchScope
+    Score   float64 `json:"s"`
+    Book    string  `json:"b"`
+    Number  int     `json:"n"`
+}
+
+// SearchScope returns what a page token of a search is bound to: the
+// query with its whitespace normalized and the options that select and
+// order the hits. Offset, Limit and After are left out, as they move
+// through the same results.
+func SearchScope(query string, opts SearchOptions) string {
+    lang := strings.ToLower(opts.Lang)
+    if lang == "" {
+        lang = DefaultLang
+    }
+    scope := fmt.Sprintf("%q %q %q", strings.Join(strings.Fields(query), " "), opts.Book, lang)
+    if opts.Ranking != nil {
+        scope += fmt.Sprintf(" %v", *opts.Ranking)
+    }
+    return scope
+}
+
+// Encode returns the page token for continuing after c in data of the
+// given version, in the search named by scope (see SearchScope).
+func (p *PageTokens) Encode(c Cursor, version, scope string) string {
+    payload, _ := json.Marshal(token{Version: version, Scope: scopeHash(scope), Score: c.Score, Book: c.Book, Number: c.Number})
+    enc := base64.RawURLEncoding
+    return enc.EncodeToString(payload) + "." + enc.EncodeToString(p.sign(payload))
+}
+
+// Decode verifies a token from Encode and returns its cursor. It fails
+// with ErrInvalidToken for anything Encode did not produce with this key,
+// with ErrTokenScope when the token is for another search than scope, and
+// with ErrStaleToken when it is for a version other than the given one.
+func (p *PageTokens) Decode(s, version, scope string) (Cursor, error) {
+    enc := base64.RawURLEncoding
+    body, sig, ok := strings.Cut(s, ".")
+    if !ok {
+        return Cursor{}, ErrInvalidToken
+    }
+    payload, err1 := enc.DecodeString(body)
+    mac, err2 := enc.DecodeString(sig)
+    if err1 != nil || err2 != nil || !hmac.Equal(mac, p.sign(payload)) {
+        return Cursor{}, ErrInvalidToken
+    }
+    var t token
+    if err := json.Unmarshal(payload, &t); err != nil {
+        return Cursor{}, ErrInvalidToken
+    }
+    if t.Scope != scopeHash(scope) {
+        return Cursor{}, ErrTokenScope
+    }
+    if t.Version != version {
+        return Cursor{}, ErrStaleToken
+    }
+    return Cursor{Score: t.Score, Book: t.Book, Number: t.Number}, nil
+}
+
+func scopeHash(scope string) string {
+    sum := sha256.Sum256([]byte(scope))
+    return hex.EncodeToString(sum[:8])
+}
+
+func (p *PageTokens) sign(payload []byte) []byte {
+    m := hmac.New(sha256.New, p.key)
+    m.Write(payload)
+    return m.Sum(nil)[:16]
+}
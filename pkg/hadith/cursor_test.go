@@ -0,0 +1,137 @@
+package hadith
+
+import (
+    "encoding/base64"
+    "errors"
+    "strings"
+    "testing"
+)
+
+func TestPageTokens(t *testing.T) {
+    p := NewPageTokens([]byte("secret"))
+    c := Cursor{Score: 3.25, Book: "malik", Number: 12}
+    scope := SearchScope("niat", SearchOptions{})
+    tok := p.Encode(c, "v1", scope)
+    enc := base64.RawURLEncoding
+    body, sig, _ := strings.Cut(tok, ".")
+    payload, err := enc.DecodeString(body)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    tests := []struct {
+        name    string
+        p       *PageTokens
+        tok     string
+        version string
+        scope   string
+        err     error
+    }{
+        {"round trip", p, tok, "v1", scope, nil},
+        {"same key, new instance", NewPageTokens([]byte("secret")), tok, "v1", scope, nil},
+        {"other key", NewPageTokens([]byte("other")), tok, "v1", scope, ErrInvalidToken},
+        {"random key", NewPageTokens(nil), tok, "v1", scope, ErrInvalidToken},
+        {"empty", p, "", "v1", scope, ErrInvalidToken},
+        {"no signature", p, body, "v1", scope, ErrInvalidToken},
+        {"bad base64", p, "!!." + sig, "v1", scope, ErrInvalidToken},
+        {"signature cut", p, body + "." + sig[:len(sig)-2], "v1", scope, ErrInvalidToken},
+        {"payload edited", p, enc.EncodeToString([]byte(strings.Replace(string(payload), `"n":12`, `"n":13`, 1))) + "." + sig, "v1", scope, ErrInvalidToken},
+        {"signed non-JSON", p, enc.EncodeToString([]byte("x")) + "." + enc.EncodeToString(p.sign([]byte("x"))), "v1", scope, ErrInvalidToken},
+        {"other version", p, tok, "v2", scope, ErrStaleToken},
+        {"other query", p, tok, "v1", SearchScope("niat baik", SearchOptions{}), ErrTokenScope},
+        {"other book", p, tok, "v1", SearchScope("niat", SearchOptions{Book: "malik"}), ErrTokenScope},
+        {"other language", p, tok, "v1", SearchScope("niat", SearchOptions{Lang: "en"}), ErrTokenScope},
+        // A token for another search fails on scope even after a reload.
+        {"other query and version", p, tok, "v2", SearchScope("shalat", SearchOptions{}), ErrTokenScope},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := tt.p.Decode(tt.tok, tt.version, tt.scope)
+            if !errors.Is(err, tt.err) {
+                t.Fatalf("Decode error = %v, want %v", err, tt.err)
+            }
+            if err == nil && got != c {
+                t.Errorf("Decode = %+v, want %+v", got, c)
+            }
+        })
+    }
+}
+
+func TestSearchScope(t *testing.T) {
+    base := SearchScope("niat baik", SearchOptions{})
+    same := []struct {
+        query string
+        opts  SearchOptions
+    }{
+        {"  niat   baik ", SearchOptions{}},
+        {"niat baik", SearchOptions{Lang: DefaultLang}},
+        {"niat baik", SearchOptions{Lang: strings.ToUpper(DefaultLang)}},
+        // Paging options move through the same results.
+        {"niat baik", SearchOptions{Limit: 10, Offset: 20, After: &Cursor{Score: 1}}},
+    }
+    for _, tt := range same {
+        if got := SearchScope(tt.query, tt.opts); got != base {
+            t.Errorf("SearchScope(%q, %+v) = %q, want %q", tt.query, tt.opts, got, base)
+        }
+    }
+    differ := []struct {
+        query string
+        opts  SearchOptions
+    }{
+        {"niat", SearchOptions{}},
+        {"baik niat", SearchOptions{}},
+        {`"niat baik"`, SearchOptions{}},
+        {"niat baik", SearchOptions{Book: "malik"}},
+        {"niat baik", SearchOptions{Lang: "en"}},
+        {"niat baik", SearchOptions{Ranking: &DefaultRanking}},
+    }
+    for _, tt := range differ {
+        if got := SearchScope(tt.query, tt.opts); got == base {
+            t.Errorf("SearchScope(%q, %+v) = %q, the same as the base search", tt.query, tt.opts, got)
+        }
+    }
+}
+
+// TestSearchAfter pages through a search with cursors and compares the
+// pages with the full result list.
+func TestSearchAfter(t *testing.T) {
+    store, err := Open("../../books", Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    const query = "shalat"
+    all, err := store.Search(query, SearchOptions{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(all) < 25 {
+        t.Fatalf("only %d hits for %q", len(all), query)
+    }
+    p := NewPageTokens(nil)
+    scope := SearchScope(query, SearchOptions{})
+    var after *Cursor
+    var paged []Result
+    for {
+        page, err := store.Search(query, SearchOptions{Limit: 10, After: after})
+        if err != nil {
+            t.Fatal(err)
+        }
+        paged = append(paged, page...)
+        if len(page) < 10 {
+            break
+        }
+        c, err := p.Decode(p.Encode(CursorOf(page[len(page)-1]), "v", scope), "v", scope)
+        if err != nil {
+            t.Fatal(err)
+        }
+        after = &c
+    }
+    if len(paged) != len(all) {
+        t.Fatalf("paged through %d hits, want %d", len(paged), len(all))
+    }
+    for i := range all {
+        if CursorOf(paged[i]) != CursorOf(all[i]) {
+            t.Fatalf("hit %d = %+v, want %+v", i, CursorOf(paged[i]), CursorOf(all[i]))
+        }
+    }
+}
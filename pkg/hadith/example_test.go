@@ -0,0 +1,71 @@
+package hadith_test
+
+import (
+    "fmt"
+    "log"
+
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+)
+
+func ExampleOpen() {
+    store, err := hadith.Open("../../books", hadith.Options{})
+    if err != nil {
+        log.Fatal(err)
+    }
+    fmt.Println(store.Books(), store.Count())
+    // Output:
+    // [darimi malik] 4536
+}
+
+func ExampleStore_Get() {
+    store, err := hadith.Open("../../books", hadith.Options{})
+    if err != nil {
+        log.Fatal(err)
+    }
+    h, ok := store.Get("malik", 1)
+    if !ok {
+        log.Fatal("not found")
+    }
+    fmt.Println(h.Book, h.Number)
+    text, _ := hadith.Snippet(h.ID, nil, 60)
+    fmt.Println(text)
+    // Output:
+    // malik 1
+    // Perawi berkata; Telah menceritakan kepadaku Al Laitsi dari M…
+}
+
+func ExampleStore_Search() {
+    store, err := hadith.Open("../../books", hadith.Options{})
+    if err != nil {
+        log.Fatal(err)
+    }
+    results, err := store.Search(`niat book:malik`, hadith.SearchOptions{Limit: 3})
+    if err != nil {
+        log.Fatal(err)
+    }
+    for _, r := range results {
+        text, spans := hadith.Snippet(r.Hadith.ID, r.Matches["id"], 60)
+        fmt.Printf("%s #%d: %s\n", r.Hadith.Book, r.Hadith.Number, hadith.Mark(text, spans, "[", "]"))
+    }
+    // Output:
+    // malik #761: …ihan, serta [berniat] sebagaimana [niat] haji mereka sebelumnya…
+    // malik #312: …elama tidak [berniat] menetap, meskipun tertahan selama dua be…
+    // malik #1190: …idak dengan [niat] untuk membelinya; hingga orang-orang mengik…
+}
+
+func ExampleStore_Page() {
+    store, err := hadith.Open("../../books", hadith.Options{})
+    if err != nil {
+        log.Fatal(err)
+    }
+    hadiths, total := store.Page("malik", 10, 3)
+    for _, h := range hadiths {
+        fmt.Println(h.Book, h.Number)
+    }
+    fmt.Println("total:", total)
+    // Output:
+    // malik 12
+    // malik 13
+    // malik 14
+    // total: 1587
+}
@@ -0,0 +1,447 @@
+package hadith
+
+import (
+    "bufio"
+    "context"
+    "encoding/csv"
+    "encoding/json"
+    "encoding/xml"
+    "errors"
+    "fmt"
+    "html"
+    "io"
+    "sort"
+    "strconv"
+    "strings"
+)
+
+// ExportFormat is a file format Export.Encode writes.
+type ExportFormat string
+
+// Export formats.
+const (
+    // NDJSON writes a JSON object per line: the hadith as the API returns
+    // it plus "version", the dataset version.
+    NDJSON ExportFormat = "ndjson"
+    // CSV writes a header row and a row per hadith, with a text_<lang>
+    // column per language, for spreadsheets.
+    CSV ExportFormat = "csv"
+    // Markdown writes a document with YAML front matter holding the
+    // provenance, for static site generators.
+    Markdown ExportFormat = "md"
+    // TEI writes a TEI P5 XML document, with the sources in its header,
+    // for digital humanities tools.
+    TEI ExportFormat = "xml"
+)
+
+// ExportFormats lists the formats in the order the commands show them.
+var ExportFormats = []ExportFormat{NDJSON, CSV, Markdown, TEI}
+
+// ParseExportFormat returns the format named s, one of ExportFormats.
+func ParseExportFormat(s string) (ExportFormat, error) {
+    for _, f := range ExportFormats {
+        if string(f) == strings.ToLower(s) {
+            return f, nil
+        }
+    }
+    return "", fmt.Errorf("unknown export format %q; want ndjson, csv, md or xml", s)
+}
+
+// Ext returns the file name extension of f, with the dot.
+func (f ExportFormat) Ext() string {
+    return "." + string(f)
+}
+
+// ContentType returns the media type of f.
+func (f ExportFormat) ContentType() string {
+    switch f {
+    case NDJSON:
+        return "application/x-ndjson"
+    case CSV:
+        return "text/csv; charset=utf-8"
+    case Markdown:
+        return "text/markdown; charset=utf-8"
+    case TEI:
+        return "application/tei+xml"
+    }
+    return "application/octet-stream"
+}
+
+// ExportOptions selects the hadiths of an export.
+type ExportOptions struct {
+    // Query selects hadiths by search, best first. When it is empty the
+    // export holds every hadith of Book, or of all books, by book and
+    // number.
+    Query string
+    Book  string // only hadiths from this book; "" means all
+    Lang  string // the translation to include; "" means all of them
+}
+
+// Export is a selection of hadiths together with their provenance, ready
+// to be written with Encode.
+type Export struct {
+    ExportOptions
+    // Count is the number of hadiths the export holds.
+    Count int
+    // Version is the dataset version the hadiths are read from (see
+    // Repository.Version).
+    Version string
+    // Books describes the books the hadiths come from: names, author,
+    // source and license.
+    Books []BookInfo
+    // Langs are the translations the export holds.
+    Langs []string
+
+    repo  Repository
+    hits  []Hadith // the results of a query, best first
+    books []string // the books of an export without a query, by name
+}
+
+// exportPageSize is how many hadiths of a book Encode reads at a time.
+const exportPageSize = 500
+
+// errExportChanged reports a reload during an export.
+var errExportChanged = errors.New("export: the data changed during the export (reload); try again")
+
+// NewExport runs the selection of opts against repo. It fails with a
+// *SyntaxError for a malformed query. Search results are held in memory,
+// as ranking needs them all; whole books are only read by Encode.
+func NewExport(ctx context.Context, repo Repository, opts ExportOptions) (*Export, error) {
+    e := &Export{ExportOptions: opts, repo: repo}
+    // The version is read on both sides of the selection, so that a reload
+    // in between cannot mislabel the hadiths.
+    for attempt := 0; ; attempt++ {
+        before, err := repo.Version(ctx)
+        if err != nil {
+            return nil, err
+        }
+        if err := e.selectHadiths(ctx); err != nil {
+            return nil, err
+        }
+        after, err := repo.Version(ctx)
+        if err != nil {
+            return nil, err
+        }
+        if before == after {
+            e.Version = after
+            break
+        }
+        if attempt == 2 {
+            return nil, fmt.Errorf("export: the data keeps changing (reloads during the export)")
+        }
+    }
+    var err error
+    if opts.Lang != "" {
+        e.Langs = []string{opts.Lang}
+    } else if e.Langs, err = repo.Languages(ctx); err != nil {
+        return nil, err
+    }
+    return e, nil
+}
+
+// selectHadiths sets the hits or books of the export, its Count and Books.
+func (e *Export) selectHadiths(ctx context.Context) error {
+    infos, err := e.repo.Books(ctx)
+    if err != nil {
+        return err
+    }
+    e.hits, e.books, e.Books, e.Count = nil, nil, nil, 0
+    used := map[string]bool{}
+    if strings.TrimSpace(e.Query) != "" {
+        results, _, err := e.repo.Search(ctx, e.Query, SearchOptions{Lang: e.Lang, Book: e.Book})
+        if err != nil {
+            return err
+        }
+        e.hits = make([]Hadith, len(results))
+        for i, r := range results {
+            e.hits[i] = r.Hadith
+            used[r.Hadith.Book] = true
+        }
+        e.Count = len(e.hits)
+    } else {
+        for _, b := range infos {
+            if e.Book == "" || b.Name == e.Book {
+                e.books = append(e.books, b.Name)
+                e.Count += b.Count
+                used[b.Name] = true
+            }
+        }
+        sort.Strings(e.books)
+    }
+    for _, b := range infos {
+        if used[b.Name] {
+            e.Books = append(e.Books, b)
+        }
+    }
+    return nil
+}
+
+// exportWriter is where Encode writes: a buffer over the destination.
+type exportWriter struct {
+    *bufio.Writer
+    dst io.Writer
+}
+
+// flush passes the buffered output on, and flushes the destination too
+// when it can be, such as an HTTP response.
+func (w exportWriter) flush() error {
+    if err := w.Flush(); err != nil {
+        return err
+    }
+    if f, ok := w.dst.(interface{ Flush() }); ok {
+        f.Flush()
+    }
+    return nil
+}
+
+// each calls fn with every hadith of the export, in order. Books are read
+// a page at a time and each page is written out before the next is read;
+// the data version is checked after each, so that a reload cannot mix two
+// datasets in one file.
+func (e *Export) each(ctx context.Context, w exportWriter, fn func(Hadith) error) error {
+    for _, h := range e.hits {
+        if err := fn(h); err != nil {
+            return err
+        }
+    }
+    for _, b := range e.books {
+        for offset := 0; ; offset += exportPageSize {
+            page, total, err := e.repo.Page(ctx, b, offset, exportPageSize)
+            if err != nil {
+                return err
+            }
+            for _, h := range page {
+                if err := fn(h); err != nil {
+                    return err
+                }
+            }
+            if err := w.flush(); err != nil {
+                return err
+            }
+            if v, err := e.repo.Version(ctx); err != nil {
+                return err
+            } else if v != e.Version {
+                return errExportChanged
+            }
+            if offset+exportPageSize >= total {
+                break
+            }
+        }
+    }
+    return nil
+}
+
+// Encode writes the export to w in format f, reading whole books from the
+// repository as it goes. It fails if the data is reloaded meanwhile.
+func (e *Export) Encode(ctx context.Context, w io.Writer, f ExportFormat) error {
+    var encode func(context.Context, exportWriter) error
+    switch f {
+    case NDJSON:
+        encode = e.encodeNDJSON
+    case CSV:
+        encode = e.encodeCSV
+    case Markdown:
+        encode = e.encodeMarkdown
+    case TEI:
+        encode = e.encodeTEI
+    default:
+        _, err := ParseExportFormat(string(f))
+        return err
+    }
+    // A bufio.Writer keeps the first write error, which Flush returns, so
+    // the encoders need not check every write.
+    ew := exportWriter{Writer: bufio.NewWriter(w), dst: w}
+    if err := encode(ctx, ew); err != nil {
+        return err
+    }
+    return ew.Flush()
+}
+
+func (e *Export) encodeNDJSON(ctx context.Context, w exportWriter) error {
+    enc := json.NewEncoder(w)
+    return e.each(ctx, w, func(h Hadith) error {
+        line := struct {
+            Hadith
+            Version string `json:"version"`
+        }{h.In(e.Lang), e.Version}
+        return enc.Encode(line)
+    })
+}
+
+func (e *Export) encodeCSV(ctx context.Context, w exportWriter) error {
+    // The csv.Writer shares the buffer of w, so flushing w flushes it.
+    cw := csv.NewWriter(w.Writer)
+    header := []string{"book", "number", "kitab", "bab", "grade", "arab"}
+    for _, l := range e.Langs {
+        header = append(header, "text_"+l)
+    }
+    if err := cw.Write(append(header, "version")); err != nil {
+        return err
+    }
+    err := e.each(ctx, w, func(h Hadith) error {
+        row := []string{h.Book, strconv.Itoa(h.Number), h.Kitab, h.Bab, h.Grade, h.Arab}
+        for _, l := range e.Langs {
+            row = append(row, h.Text(l))
+        }
+        return cw.Write(append(row, e.Version))
+    })
+    if err != nil {
+        return err
+    }
+    cw.Flush()
+    return cw.Error()
+}
+
+func (e *Export) encodeMarkdown(ctx context.Context, w exportWriter) error {
+    q := strconv.Quote // Go string literals are valid YAML double-quoted scalars
+    fmt.Fprintf(w, "---\ntitle: %s\n", q(e.title()))
+    if e.Query != "" {
+        fmt.Fprintf(w, "query: %s\n", q(e.Query))
+    }
+    if e.Book != "" {
+        fmt.Fprintf(w, "book: %s\n", q(e.Book))
+    }
+    fmt.Fprintf(w, "dataset_version: %s\ncount: %d\n", q(e.Version), e.Count)
+    if len(e.Books) > 0 {
+        fmt.Fprintf(w, "sources:\n")
+        for _, b := range e.Books {
+            fmt.Fprintf(w, "  - book: %s\n    name: %s\n", q(b.Name), q(b.DisplayName(e.Lang)))
+            for _, kv := range [][2]string{{"author", b.Author}, {"compiled", b.Compiled}, {"source_url", b.SourceURL}, {"license", b.License}} {
+                if kv[1] != "" {
+                    fmt.Fprintf(w, "    %s: %s\n", kv[0], q(kv[1]))
+                }
+            }
+        }
+    }
+    fmt.Fprintf(w, "---\n")
+    names := e.displayNames()
+    return e.each(ctx, w, func(h Hadith) error {
+        name := names[h.Book]
+        if name == "" {
+            name = h.Book
+        }
+        fmt.Fprintf(w, "\n## %s %d\n\n", markdownEscape(name), h.Number)
+        var about []string
+        if title := strings.Join(nonEmpty(h.Kitab, h.Bab), " — "); title != "" {
+            about = append(about, "*"+markdownEscape(title)+"*")
+        }
+        if h.Grade != "" {
+            about = append(about, "Grade: "+markdownEscape(h.Grade))
+        }
+        if len(about) > 0 {
+            fmt.Fprintf(w, "%s\n\n", strings.Join(about, " · "))
+        }
+        fmt.Fprintf(w, "<p dir=\"rtl\" lang=\"ar\">%s</p>\n", html.EscapeString(h.Arab))
+        for _, l := range e.Langs {
+            if text := h.Text(l); text != "" {
+                fmt.Fprintf(w, "\n**%s:** %s\n", strings.ToUpper(l), markdownEscape(text))
+            }
+        }
+        return nil
+    })
+}
+
+func (e *Export) encodeTEI(ctx context.Context, w exportWriter) error {
+    esc := func(s string) string {
+        var b strings.Builder
+        _ = xml.EscapeText(&b, []byte(s))
+        return b.String()
+    }
+    fmt.Fprintf(w, "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<TEI xmlns=\"http://www.tei-c.org/ns/1.0\">\n")
+    fmt.Fprintf(w, "  <teiHeader>\n    <fileDesc>\n      <titleStmt>\n        <title>%s</title>\n      </titleStmt>\n", esc(e.title()))
+    fmt.Fprintf(w, "      <publicationStmt>\n        <p>Exported by hadith-go from dataset version %s.</p>\n", esc(e.Version))
+    if e.Query != "" {
+        fmt.Fprintf(w, "        <p>Query: <q>%s</q></p>\n", esc(e.Query))
+    }
+    fmt.Fprintf(w, "      </publicationStmt>\n      <sourceDesc>\n        <listBibl>\n")
+    for _, b := range e.Books {
+        fmt.Fprintf(w, "          <bibl n=\"%s\">\n            <title>%s</title>\n", esc(b.Name), esc(b.DisplayName(e.Lang)))
+        if b.Author != "" {
+            fmt.Fprintf(w, "            <author>%s</author>\n", esc(b.Author))
+        }
+        if b.Compiled != "" {
+            fmt.Fprintf(w, "            <date>%s</date>\n", esc(b.Compiled))
+        }
+        if b.SourceURL != "" {
+            fmt.Fprintf(w, "            <ref target=\"%s\">%s</ref>\n", esc(b.SourceURL), esc(b.SourceURL))
+        }
+        if b.License != "" {
+            fmt.Fprintf(w, "            <availability>\n              <licence>%s</licence>\n            </availability>\n", esc(b.License))
+        }
+        fmt.Fprintf(w, "          </bibl>\n")
+    }
+    fmt.Fprintf(w, "        </listBibl>\n      </sourceDesc>\n    </fileDesc>\n  </teiHeader>\n  <text>\n    <body>\n")
+    err := e.each(ctx, w, func(h Hadith) error {
+        fmt.Fprintf(w, "      <div type=\"hadith\" n=\"%s %d\">\n", esc(h.Book), h.Number)
+        if title := strings.Join(nonEmpty(h.Kitab, h.Bab), " — "); title != "" {
+            fmt.Fprintf(w, "        <head>%s</head>\n", esc(title))
+        }
+        fmt.Fprintf(w, "        <ab xml:lang=\"ar\">%s</ab>\n", esc(h.Arab))
+        for _, l := range e.Langs {
+            if text := h.Text(l); text != "" {
+                fmt.Fprintf(w, "        <ab type=\"translation\" xml:lang=\"%s\">%s</ab>\n", esc(l), esc(text))
+            }
+        }
+        if h.Grade != "" {
+            fmt.Fprintf(w, "        <note type=\"grade\">%s</note>\n", esc(h.Grade))
+        }
+        for _, ed := range sortedKeys(h.Numbers) {
+            fmt.Fprintf(w, "        <idno type=\"%s\">%d</idno>\n", esc(ed), h.Numbers[ed])
+        }
+        fmt.Fprintf(w, "      </div>\n")
+        return nil
+    })
+    if err != nil {
+        return err
+    }
+    fmt.Fprintf(w, "    </body>\n  </text>\n</TEI>\n")
+    return nil
+}
+
+// title names the export in document formats.
+func (e *Export) title() string {
+    switch {
+    case e.Query != "":
+        return "Hadiths matching " + e.Query
+    case e.Book != "":
+        return "Hadiths of " + e.Book
+    }
+    return "Hadiths"
+}
+
+// displayNames maps the books of the export to their display names.
+func (e *Export) displayNames() map[string]string {
+    names := map[string]string{}
+    for _, b := range e.Books {
+        names[b.Name] = b.DisplayName(e.Lang)
+    }
+    return names
+}
+
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "<", "&lt;", ">", "&gt;")
+
+// markdownEscape keeps text from being read as emphasis, code or HTML. It
+// is only used after the start of a line, and the brackets around
+// narrators' names do not form links without a URL after them.
+func markdownEscape(s string) string {
+    return markdownEscaper.Replace(s)
+}
+
+func nonEmpty(parts ...string) []string {
+    var out []string
+    for _, p := range parts {
+        if p != "" {
+            out = append(out, p)
+        }
+    }
+    return out
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+    keys := make([]string, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Strings(keys)
+    return keys
+}
@@ -0,0 +1,147 @@
+// Package hadith is the public Go API of hadith-go: it loads a books
+// directory, looks hadiths up by book and number, walks books by chapter
+// and searches them with the query language the commands use.
+//
+//    store, err := hadith.Open("books", hadith.Options{})
+//    if err != nil { ... }
+//    h, ok := store.Get("bukhari", 1)
+//    results, err := store.Search(`niat book:bukhari`, hadith.SearchOptions{Limit: 10})
+//
+// # Compatibility
+//
+// The package follows semantic versioning. Within a major version exported
+// identifiers are not removed or renamed, function and method signatures do
+// not change, and struct types only gain fields, so code that uses keyed
+// struct literals keeps compiling. Result order, ranking scores and
+// highlighted spans may improve between minor versions. The commands in
+// cmd/ are built on this package only.
+package hadith
+
+import (
+    "context"
+    "io/fs"
+    "time"
+
+    "github.com/nuzlilatief/hadith-go/internal/data"
+)
+
+// Hadith is a single hadith. Use Text or In to read a translation.
+type Hadith = data.Hadith
+
+// Chapter is a run of consecutive hadiths of a book sharing the same kitab
+// and bab, numbered from 1 in file order.
+type Chapter = data.Chapter
+
+// BookInfo describes a book: display names and provenance from the
+// manifest, plus the number of hadiths and the languages loaded.
+type BookInfo = data.BookInfo
+
+// Options controls loading. The zero value loads anything that decodes.
+type Options = data.Options
+
+// DefaultLang is the language of Hadith.ID, the Indonesian translation.
+const DefaultLang = data.DefaultLang
+
+// Store holds the hadiths of a books directory in memory. It is safe for
+// concurrent use, including while Reload or Watch swap in new data.
+type Store struct {
+    s *data.Store
+}
+
+// Open loads every book, translation companion and the manifest in dir,
+// or the up-to-date snapshot of them written by BuildSnapshot.
+func Open(dir string, opts Options) (*Store, error) {
+    s, err := data.NewStoreOptions(dir, opts)
+    if err != nil {
+        return nil, err
+    }
+    return &Store{s: s}, nil
+}
+
+// OpenFS is Open for the books at the root of fsys, e.g. an embed.FS.
+func OpenFS(fsys fs.FS, opts Options) (*Store, error) {
+    s, err := data.NewStoreFSOptions(fsys, opts)
+    if err != nil {
+        return nil, err
+    }
+    return &Store{s: s}, nil
+}
+
+// Books returns the book names in stable order.
+func (s *Store) Books() []string { return s.s.Books() }
+
+// BookInfo returns the description of a book.
+func (s *Store) BookInfo(name string) (BookInfo, bool) { return s.s.BookInfo(name) }
+
+// BookInfos returns the description of every book, in Books order.
+func (s *Store) BookInfos() []BookInfo { return s.s.BookInfos() }
+
+// Count returns the number of hadiths across all books.
+func (s *Store) Count() int { return s.s.Count() }
+
+// Get returns the hadith with the given number in book.
+func (s *Store) Get(book string, number int) (Hadith, bool) { return s.s.Get(book, number) }
+
+// GetMany looks up every ref at once, consistently even during a reload.
+// The results are in the order of refs; found[i] reports whether refs[i]
+// exists.
+func (s *Store) GetMany(refs []Ref) (hadiths []Hadith, found []bool) { return s.s.GetMany(refs) }
+
+// Languages returns the translation languages present, sorted. DefaultLang
+// is always included.
+func (s *Store) Languages() []string { return s.s.Languages() }
+
+// HasLanguage reports whether any hadith has a translation in lang.
+func (s *Store) HasLanguage(lang string) bool { return s.s.HasLanguage(lang) }
+
+// Chapters returns the chapters of book in file order, or nil when the book
+// has no chapter metadata.
+func (s *Store) Chapters(book string) []Chapter { return s.s.Chapters(book) }
+
+// Chapter returns chapter n (1-based) of book and its hadiths.
+func (s *Store) Chapter(book string, n int) (Chapter, []Hadith, bool) { return s.s.Chapter(book, n) }
+
+// Version identifies the loaded data: a short hash that is equal for equal
+// books and changes when a reload brings different data.
+func (s *Store) Version() string { return s.s.Version() }
+
+// Loaded returns when the data was loaded: when the store was opened, or
+// by the last reload that changed Version.
+func (s *Store) Loaded() time.Time { return s.s.Loaded() }
+
+// Warnings returns the problems tolerated while loading, such as duplicate
+// numbers of which only the first entry was kept.
+func (s *Store) Warnings() []Problem { return s.s.Warnings() }
+
+// Browse returns the hadiths of book numbered from through to, sorted by
+// number; a zero bound is open. Only the range is copied.
+func (s *Store) Browse(book string, from, to int) []Hadith { return s.s.Browse(book, from, to) }
+
+// Page returns up to limit hadiths of book in number order, starting at
+// offset, and the number of hadiths in the book. A limit of zero or less
+// means no limit.
+func (s *Store) Page(book string, offset, limit int) ([]Hadith, int) {
+    return s.s.Page(book, offset, limit)
+}
+
+// BrowsePage returns up to limit of the hadiths Browse(book, from, to)
+// would, starting at offset, and how many Browse would return. Only the
+// page is copied.
+func (s *Store) BrowsePage(book string, from, to, offset, limit int) ([]Hadith, int) {
+    return s.s.BrowsePage(book, from, to, offset, limit)
+}
+
+// All returns every hadith, by book and then in file order. The slice is a
+// copy the caller may modify.
+func (s *Store) All() []Hadith { return s.s.All() }
+
+// Reload reads the books again and swaps the new data in. On error the
+// store keeps the data it had.
+func (s *Store) Reload() error { return s.s.Reload() }
+
+// Watch polls the books every interval and reloads when a file is added,
+// removed or modified, passing the result of each reload to report (which
+// may be nil). It blocks until ctx is done.
+func (s *Store) Watch(ctx context.Context, interval time.Duration, report func(error)) {
+    s.s.Watch(ctx, interval, report)
+}
@@ -0,0 +1,24 @@
+package hadith
+
+import (
+    "fmt"
+    "strconv"
+    "strings"
+
+    "github.com/nuzlilatief/hadith-go/internal/data"
+)
+
+// Ref identifies a hadith by book and number. Its String form is
+// "book:number", which ParseRef reads.
+type Ref = data.Ref
+
+// ParseRef parses a reference of the form "book:number", such as
+// "malik:12".
+func ParseRef(s string) (Ref, error) {
+    book, num, ok := strings.Cut(strings.TrimSpace(s), ":")
+    n, err := strconv.Atoi(strings.TrimSpace(num))
+    if !ok || strings.TrimSpace(book) == "" || err != nil || n < 1 {
+        return Ref{}, fmt.Errorf("invalid reference %q, want book:number", s)
+    }
+    return Ref{Book: strings.TrimSpace(book), Number: n}, nil
+}
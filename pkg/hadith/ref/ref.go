@@ -0,0 +1,428 @@
+// Package ref reads hadith citations as people write them and resolves
+// them to hadiths:
+//
+//	Muwatta Malik 12
+//	HR. Ad-Darimi no. 1234
+//	darimi:1234
+//	موطأ مالك ١٢
+//	Malik 10-15, 20; Darimi 3 dan 5
+//
+// A citation names a book, by its file name or any of its display names
+// (see hadith.BookInfo.Names) in Arabic, Indonesian or Latin spelling, and
+// one or more numbers or ranges. Words such as "HR.", "no." or "رقم" and
+// collection titles such as "Sunan" or "Sahih" are ignored, and well-known
+// collections are also recognised by their usual transliterations
+// ("Tirmidzi", "Tirmidhi", ...).
+package ref
+
+import (
+    "context"
+    "fmt"
+    "sort"
+    "strings"
+    "unicode"
+
+    "github.com/nuzlilatief/hadith-go/internal/search/index"
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+)
+
+// A Citation is one hadith or one range of hadiths of a book.
+type Citation struct {
+    Book     string // file name of the book, as in hadith.Hadith.Book
+    From, To int    // numbers, inclusive; equal for a single hadith
+}
+
+// String returns c as "book:number" or "book:from-to".
+func (c Citation) String() string {
+    if c.From == c.To {
+        return hadith.Ref{Book: c.Book, Number: c.From}.String()
+    }
+    return fmt.Sprintf("%s:%d-%d", c.Book, c.From, c.To)
+}
+
+// SyntaxError reports a citation that cannot be read.
+type SyntaxError struct {
+    Msg string
+}
+
+func (e *SyntaxError) Error() string {
+    return e.Msg
+}
+
+func syntaxErrorf(format string, args ...any) error {
+    return &SyntaxError{Msg: fmt.Sprintf(format, args...)}
+}
+
+// UnknownBookError is returned for a book name that matches no book.
+type UnknownBookError struct {
+    Name string // as written
+}
+
+func (e *UnknownBookError) Error() string {
+    return fmt.Sprintf("unknown book %q", e.Name)
+}
+
+// Resolver reads citations of the books it was made for.
+type Resolver struct {
+    books map[string]string // alias key -> book
+}
+
+// NewResolver returns a Resolver for books. Exact file names take
+// precedence over display names, and both over the built-in spellings of
+// well-known collections.
+func NewResolver(books []hadith.BookInfo) *Resolver {
+    r := &Resolver{books: map[string]string{}}
+    add := func(phrase, book string) {
+        for _, k := range keys(phrase) {
+            if _, ok := r.books[k]; !ok {
+                r.books[k] = book
+            }
+        }
+    }
+    for _, b := range books {
+        add(b.Name, b.Name)
+    }
+    for _, b := range books {
+        for _, lang := range sortedKeys(b.Names) {
+            add(b.Names[lang], b.Name)
+        }
+    }
+    for _, group := range spellings {
+        book := ""
+        for _, s := range group {
+            if book = r.books[s]; book != "" {
+                break
+            }
+        }
+        if book != "" {
+            for _, s := range group {
+                if _, ok := r.books[s]; !ok {
+                    r.books[s] = book
+                }
+            }
+        }
+    }
+    return r
+}
+
+// Book returns the file name of the book called name, if any.
+func (r *Resolver) Book(name string) (string, bool) {
+    for _, k := range keys(name) {
+        if b, ok := r.books[k]; ok {
+            return b, true
+        }
+    }
+    return "", false
+}
+
+// Parse reads the citations in s, in order. A citation lists numbers and
+// ranges (10-15, 10–15, 10 sampai 15) after its book, separated by
+// commas, "dan" or "and"; another book name starts the next citation.
+func (r *Resolver) Parse(s string) ([]Citation, error) {
+    toks, err := lex(s)
+    if err != nil {
+        return nil, err
+    }
+    var out []Citation
+    var words []token // the book name being read
+    book := ""
+    for i := 0; i < len(toks); i++ {
+        t := toks[i]
+        switch t.kind {
+        case tokWord:
+            if book != "" && len(words) == 0 && len(out) > 0 {
+                book = "" // a new citation
+            }
+            words = append(words, t)
+        case tokNumber:
+            if len(words) > 0 {
+                name := joinWords(words)
+                b, ok := r.Book(name)
+                if !ok {
+                    return nil, &UnknownBookError{Name: name}
+                }
+                book, words = b, nil
+            }
+            if book == "" {
+                return nil, syntaxErrorf("number %d has no book before it", t.n)
+            }
+            c := Citation{Book: book, From: t.n, To: t.n}
+            if i+2 < len(toks) && toks[i+1].kind == tokDash && toks[i+2].kind == tokNumber {
+                c.To = toks[i+2].n
+                i += 2
+            }
+            if c.From < 1 || c.To < c.From {
+                return nil, syntaxErrorf("invalid range %d-%d", c.From, c.To)
+            }
+            out = append(out, c)
+        }
+    }
+    if len(words) > 0 {
+        return nil, syntaxErrorf("no number after %q", joinWords(words))
+    }
+    if len(out) == 0 {
+        return nil, &SyntaxError{Msg: "no citation found; write a book and a number, e.g. malik 12"}
+    }
+    return out, nil
+}
+
+// A Match is a citation with the hadiths it names, in number order. The
+// hadiths are empty when there are none.
+type Match struct {
+    Citation
+    Hadiths []hadith.Hadith
+}
+
+// TooManyError is returned by Resolve for citations that name more
+// hadiths than it may look up.
+type TooManyError struct {
+    Count, Max int
+}
+
+func (e *TooManyError) Error() string {
+    return fmt.Sprintf("the citation names %d hadiths, at most %d are allowed", e.Count, e.Max)
+}
+
+// Resolve parses s against the books of repo and looks the citations up
+// (see Lookup). When max is positive, citations that name more than max
+// numbers in all fail with a *TooManyError; use Clamp to cut them instead.
+// It returns a *SyntaxError, *UnknownBookError or *TooManyError before
+// looking anything up.
+func Resolve(ctx context.Context, repo hadith.Repository, s string, max int) ([]Match, error) {
+    books, err := repo.Books(ctx)
+    if err != nil {
+        return nil, err
+    }
+    citations, err := NewResolver(books).Parse(s)
+    if err != nil {
+        return nil, err
+    }
+    if n := Count(citations); max > 0 && n > max {
+        return nil, &TooManyError{Count: n, Max: max}
+    }
+    return Lookup(ctx, repo, citations)
+}
+
+// Count returns the number of hadith numbers citations name.
+func Count(citations []Citation) int {
+    n := 0
+    for _, c := range citations {
+        n += c.To - c.From + 1
+    }
+    return n
+}
+
+// Clamp cuts citations to the first max numbers they name, shortening or
+// dropping ranges at the end, and reports whether it cut anything.
+func Clamp(citations []Citation, max int) ([]Citation, bool) {
+    out := make([]Citation, 0, len(citations))
+    left := max
+    for _, c := range citations {
+        if left == 0 {
+            return out, true
+        }
+        if c.To-c.From+1 > left {
+            c.To = c.From + left - 1
+            return append(out, c), true
+        }
+        left -= c.To - c.From + 1
+        out = append(out, c)
+    }
+    return out, false
+}
+
+// Lookup returns the hadiths citations name: single hadiths with one
+// GetMany call, ranges with Browse.
+func Lookup(ctx context.Context, repo hadith.Repository, citations []Citation) ([]Match, error) {
+    matches := make([]Match, len(citations))
+    var refs []hadith.Ref
+    var single []int // indexes of matches for refs
+    for i, c := range citations {
+        matches[i].Citation = c
+        if c.From == c.To {
+            refs = append(refs, hadith.Ref{Book: c.Book, Number: c.From})
+            single = append(single, i)
+            continue
+        }
+        var err error
+        if matches[i].Hadiths, err = repo.Browse(ctx, c.Book, c.From, c.To); err != nil {
+            return nil, err
+        }
+    }
+    hadiths, found, err := repo.GetMany(ctx, refs)
+    if err != nil {
+        return nil, err
+    }
+    for j, i := range single {
+        if found[j] {
+            matches[i].Hadiths = []hadith.Hadith{hadiths[j]}
+        }
+    }
+    return matches, nil
+}
+
+const (
+    tokWord = iota
+    tokNumber
+    tokDash // a range between two numbers
+)
+
+type token struct {
+    kind int
+    text string // as written
+    norm string // tokWord: normalized
+    n    int    // tokNumber
+}
+
+// lex splits s into words, numbers and dashes, dropping other punctuation
+// and the words in ignored.
+func lex(s string) ([]token, error) {
+    var toks []token
+    rs := []rune(s)
+    for i := 0; i < len(rs); {
+        c := rs[i]
+        switch {
+        case digit(c) >= 0:
+            j, n := i, 0
+            for ; j < len(rs) && digit(rs[j]) >= 0; j++ {
+                n = n*10 + digit(rs[j])
+                if n > 1e9 {
+                    return nil, syntaxErrorf("number %q is too large", string(rs[i:j+1]))
+                }
+            }
+            toks = append(toks, token{kind: tokNumber, text: string(rs[i:j]), n: n})
+            i = j
+        case unicode.IsLetter(c):
+            j := i
+            for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsMark(rs[j]) || strings.ContainsRune(wordPunct, rs[j])) {
+                j++
+            }
+            text := string(rs[i:j])
+            norm := normalize(text)
+            switch {
+            case rangeWords[norm]:
+                toks = append(toks, token{kind: tokDash, text: text})
+            case norm != "" && !ignored[norm]:
+                toks = append(toks, token{kind: tokWord, text: strings.TrimRight(text, wordPunct), norm: norm})
+            }
+            i = j
+        case strings.ContainsRune("-‐‑‒–—―−", c):
+            toks = append(toks, token{kind: tokDash, text: string(c)})
+            i++
+        default:
+            i++
+        }
+    }
+    return toks, nil
+}
+
+// wordPunct is punctuation that belongs to a word: "H.R.", "Nasa'i".
+const wordPunct = ".'’‘`"
+
+// digit returns the value of an ASCII, Arabic-Indic or Persian digit, or -1.
+func digit(c rune) int {
+    switch {
+    case c >= '0' && c <= '9':
+        return int(c - '0')
+    case c >= '٠' && c <= '٩':
+        return int(c - '٠')
+    case c >= '۰' && c <= '۹':
+        return int(c - '۰')
+    }
+    return -1
+}
+
+// normalize folds a word for comparison as the search index does (see
+// index.Normalize), and also drops punctuation and the Arabic article.
+func normalize(word string) string {
+    s := index.Normalize(strings.Map(func(c rune) rune {
+        if strings.ContainsRune(wordPunct, c) {
+            return -1
+        }
+        return c
+    }, word))
+    if strings.HasPrefix(s, "ال") && len([]rune(s)) > 3 {
+        s = strings.TrimPrefix(s, "ال")
+    }
+    return s
+}
+
+// keys returns the lookup keys of a book name: its words without articles
+// and collection titles, run together, and as a fallback with the titles.
+func keys(name string) []string {
+    toks, _ := lex(name)
+    var all, core []string
+    for _, t := range toks {
+        if t.kind != tokWord || articles[t.norm] {
+            continue
+        }
+        all = append(all, t.norm)
+        if !titles[t.norm] {
+            core = append(core, t.norm)
+        }
+    }
+    var out []string
+    for _, words := range [][]string{core, all} {
+        if k := strings.Join(words, ""); k != "" {
+            out = append(out, k)
+        }
+    }
+    return out
+}
+
+func joinWords(words []token) string {
+    parts := make([]string, len(words))
+    for i, w := range words {
+        parts[i] = w.text
+    }
+    return strings.Join(parts, " ")
+}
+
+func sortedKeys(m map[string]string) []string {
+    out := make([]string, 0, len(m))
+    for k := range m {
+        out = append(out, k)
+    }
+    sort.Strings(out)
+    return out
+}
+
+func set(words ...string) map[string]bool {
+    m := make(map[string]bool, len(words))
+    for _, w := range words {
+        m[normalize(w)] = true
+    }
+    return m
+}
+
+var (
+    // ignored words never belong to a book name: attributions ("HR." is
+    // "hadits riwayat"), number markers and conjunctions.
+    ignored = set("hr", "riwayat", "diriwayatkan", "oleh", "narrated", "reported", "by", "rawahu", "رواه", "أخرجه",
+        "hadis", "hadits", "hadith", "حديث", "no", "nomor", "nombor", "number", "num", "nr", "رقم",
+        "dan", "and", "و")
+    // rangeWords join the two numbers of a range, like a dash.
+    rangeWords = set("sampai", "hingga", "sd", "to", "until", "إلى")
+    // articles are dropped from book names: Ad-Darimi, al-Bukhari.
+    articles = set("al", "ad", "an", "as", "at", "ar", "az", "ash", "adh", "el")
+    // titles name a kind of collection; "Sunan Ad-Darimi" is found as
+    // "darimi". Names made only of titles still match in full.
+    titles = set("sunan", "sahih", "shahih", "shohih", "saheeh", "jami", "jamik", "musnad",
+        "muwatta", "muwatha", "muwaththa", "muwaththo", "kitab", "imam",
+        "سنن", "صحيح", "جامع", "مسند", "موطأ", "كتاب", "الإمام")
+)
+
+// spellings groups the usual spellings of well-known collections; each
+// entry is a lookup key (see keys). A group applies to the book any of
+// its spellings already names.
+var spellings = [][]string{
+    {"bukhari", "bukhori", "bokhari", "بخاري"},
+    {"muslim", "مسلم"},
+    {"abudawud", "abudaud", "abudawood", "abidawud", "abidaud", "ابوداود", "ابيداود"},
+    {"tirmidhi", "tirmidzi", "tirmizi", "turmudzi", "tirmithi", "ترمذي"},
+    {"nasai", "nasaai", "nasaa", "نسائي", "نساي"},
+    {"ibnmajah", "ibnumajah", "ibnimajah", "ibnemajah", "ابنماجه"},
+    {"ahmad", "ahmed", "احمد"},
+    {"malik", "maalik", "مالك"},
+    {"darimi", "daarimi", "دارمي"},
+}
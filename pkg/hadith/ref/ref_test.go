@@ -0,0 +1,183 @@
+package ref
+
+import (
+    "context"
+    "errors"
+    "reflect"
+    "testing"
+
+    "github.com/nuzlilatief/hadith-go/pkg/hadith"
+)
+
+// testBooks are the bundled books, as in books/manifest.json, and a book
+// with a multi-word name.
+var testBooks = []hadith.BookInfo{
+    {Name: "darimi", Names: map[string]string{"ar": "سنن الدارمي", "id": "Sunan Ad-Darimi", "en": "Sunan al-Darimi"}},
+    {Name: "malik", Names: map[string]string{"ar": "موطأ مالك", "id": "Muwatha' Malik", "en": "Muwatta Malik"}},
+    {Name: "ibnu-majah", Names: map[string]string{"id": "Sunan Ibnu Majah", "en": "Sunan Ibn Majah"}},
+}
+
+func TestParse(t *testing.T) {
+    r := NewResolver(testBooks)
+    c := func(book string, from, to int) Citation { return Citation{Book: book, From: from, To: to} }
+    tests := []struct {
+        in   string
+        want []Citation
+    }{
+        {"malik 12", []Citation{c("malik", 12, 12)}},
+        {"darimi:1234", []Citation{c("darimi", 1234, 1234)}},
+        {"Malik #7", []Citation{c("malik", 7, 7)}},
+        // Display names and attributions.
+        {"Muwatta Malik 12", []Citation{c("malik", 12, 12)}},
+        {"Muwatha' Malik no. 12", []Citation{c("malik", 12, 12)}},
+        {"HR. Ad-Darimi no. 1234", []Citation{c("darimi", 1234, 1234)}},
+        {"H.R. al-Darimi nomor 5", []Citation{c("darimi", 5, 5)}},
+        {"Diriwayatkan oleh Imam Malik, hadits nomor 3", []Citation{c("malik", 3, 3)}},
+        {"Sunan Ibnu Majah 4", []Citation{c("ibnu-majah", 4, 4)}},
+        {"Ibn Majah 4", []Citation{c("ibnu-majah", 4, 4)}},
+        {"ibnu-majah 4", []Citation{c("ibnu-majah", 4, 4)}},
+        // Well-known spellings.
+        {"Maalik 2", []Citation{c("malik", 2, 2)}},
+        {"daarimi 2", []Citation{c("darimi", 2, 2)}},
+        // Arabic names and digits.
+        {"موطأ مالك ١٢", []Citation{c("malik", 12, 12)}},
+        {"رواه الدارمي رقم ٣٤٥", []Citation{c("darimi", 345, 345)}},
+        {"مالك ۱۲", []Citation{c("malik", 12, 12)}}, // Persian digits
+        {"مالك ١٠ إلى ١٥", []Citation{c("malik", 10, 15)}},
+        // Ranges.
+        {"Malik 10-15", []Citation{c("malik", 10, 15)}},
+        {"Malik 10–15", []Citation{c("malik", 10, 15)}},
+        {"Malik 10 sampai 15", []Citation{c("malik", 10, 15)}},
+        {"Malik 10 s.d. 15", []Citation{c("malik", 10, 15)}},
+        {"Malik 10 to 10", []Citation{c("malik", 10, 10)}},
+        // Lists.
+        {"Malik 10-15, 20; Darimi 3 dan 5", []Citation{c("malik", 10, 15), c("malik", 20, 20), c("darimi", 3, 3), c("darimi", 5, 5)}},
+        {"Malik 1 and 2, Muwatta Malik 3", []Citation{c("malik", 1, 1), c("malik", 2, 2), c("malik", 3, 3)}},
+        {"HR. Malik 1 dan HR. Darimi 2", []Citation{c("malik", 1, 1), c("darimi", 2, 2)}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.in, func(t *testing.T) {
+            got, err := r.Parse(tt.in)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("Parse(%q) = %v, want %v", tt.in, got, tt.want)
+            }
+        })
+    }
+}
+
+func TestParseErrors(t *testing.T) {
+    r := NewResolver(testBooks)
+    tests := []struct {
+        in      string
+        unknown string // UnknownBookError.Name; "" means a SyntaxError
+    }{
+        {"", ""},
+        {"HR. no.", ""},
+        {"12", ""},
+        {"Malik", ""},
+        {"Malik 12, Darimi", ""},
+        {"Malik 0", ""},
+        {"Malik 15-10", ""},
+        {"Malik 99999999999", ""},
+        {"Bukhari 1", "Bukhari"}, // a known spelling, but not a loaded book
+        {"Sahih Muslim 8", "Sahih Muslim"},
+        {"Malik 1; Abu Dawud 2", "Abu Dawud"},
+    }
+    for _, tt := range tests {
+        t.Run(tt.in, func(t *testing.T) {
+            _, err := r.Parse(tt.in)
+            var se *SyntaxError
+            var ue *UnknownBookError
+            switch {
+            case tt.unknown == "" && !errors.As(err, &se):
+                t.Errorf("Parse(%q) error = %v, want a *SyntaxError", tt.in, err)
+            case tt.unknown != "" && (!errors.As(err, &ue) || ue.Name != tt.unknown):
+                t.Errorf("Parse(%q) error = %v, want unknown book %q", tt.in, err, tt.unknown)
+            }
+        })
+    }
+}
+
+func TestBook(t *testing.T) {
+    r := NewResolver(append(testBooks, hadith.BookInfo{Name: "muwatta"}))
+    // An exact file name wins over another book's display name.
+    if b, ok := r.Book("Muwatta"); !ok || b != "muwatta" {
+        t.Errorf("Book(Muwatta) = %q, %v, want muwatta", b, ok)
+    }
+    if b, ok := r.Book("Muwatta Malik"); !ok || b != "malik" {
+        t.Errorf("Book(Muwatta Malik) = %q, %v, want malik", b, ok)
+    }
+    // Arabic is folded as the search index folds it, Quranic marks included.
+    if b, ok := r.Book("مَالِكۖ"); !ok || b != "malik" {
+        t.Errorf("Book(مَالِكۖ) = %q, %v, want malik", b, ok)
+    }
+}
+
+func TestClamp(t *testing.T) {
+    cs := []Citation{{"malik", 1, 10}, {"malik", 20, 20}, {"darimi", 5, 9}}
+    if n := Count(cs); n != 16 {
+        t.Fatalf("Count = %d, want 16", n)
+    }
+    tests := []struct {
+        max  int
+        want []Citation
+        cut  bool
+    }{
+        {16, cs, false},
+        {100, cs, false},
+        {13, []Citation{{"malik", 1, 10}, {"malik", 20, 20}, {"darimi", 5, 6}}, true},
+        {11, []Citation{{"malik", 1, 10}, {"malik", 20, 20}}, true},
+        {3, []Citation{{"malik", 1, 3}}, true},
+        {0, []Citation{}, true},
+    }
+    for _, tt := range tests {
+        got, cut := Clamp(cs, tt.max)
+        if !reflect.DeepEqual(got, tt.want) || cut != tt.cut {
+            t.Errorf("Clamp(%d) = %v, %v, want %v, %v", tt.max, got, cut, tt.want, tt.cut)
+        }
+        if !tt.cut && Count(got) != Count(cs) || tt.cut && Count(got) != tt.max {
+            t.Errorf("Clamp(%d) kept %d numbers", tt.max, Count(got))
+        }
+    }
+}
+
+func TestResolve(t *testing.T) {
+    store, err := hadith.Open("../../../books", hadith.Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    repo := hadith.Memory(store)
+    ctx := context.Background()
+
+    matches, err := Resolve(ctx, repo, "Muwatta Malik 3-5, 7; HR. Ad-Darimi no. ٢", 0)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var got []string
+    for _, m := range matches {
+        for _, h := range m.Hadiths {
+            got = append(got, hadith.Ref{Book: h.Book, Number: h.Number}.String())
+        }
+    }
+    if want := []string{"malik:3", "malik:4", "malik:5", "malik:7", "darimi:2"}; !reflect.DeepEqual(got, want) {
+        t.Errorf("Resolve = %q, want %q", got, want)
+    }
+
+    // Numbers past the end of a book resolve to no hadiths, not an error.
+    matches, err = Resolve(ctx, repo, "malik 999999", 0)
+    if err != nil || len(matches) != 1 || len(matches[0].Hadiths) != 0 {
+        t.Errorf("Resolve(malik 999999) = %+v, %v", matches, err)
+    }
+
+    _, err = Resolve(ctx, repo, "malik 1-1000", 200)
+    var tm *TooManyError
+    if !errors.As(err, &tm) || tm.Count != 1000 || tm.Max != 200 {
+        t.Errorf("Resolve over the cap: error = %v, want a TooManyError for 1000 of 200", err)
+    }
+    if _, err := Resolve(ctx, repo, "malik 1-200", 200); err != nil {
+        t.Errorf("Resolve at the cap: %v", err)
+    }
+}
@@ -0,0 +1,163 @@
+package hadith
+
+import (
+    "context"
+    "sort"
+    "time"
+)
+
+// Repository is a read-only source of hadiths. The commands use it so that
+// they can run on either backend: the in-memory Store (Memory), which
+// loads the book files, or an SQLite database (OpenSQLite), which opens
+// quickly and keeps the corpus on disk.
+//
+// Methods return an error only when the backend fails; a missing book or
+// number is not an error. Results are equivalent across backends except
+// for search scores, which each backend computes its own way.
+type Repository interface {
+    // Books describes every book, in stable order.
+    Books(ctx context.Context) ([]BookInfo, error)
+    // Languages returns the translation languages present, sorted.
+    Languages(ctx context.Context) ([]string, error)
+    // Count returns the number of hadiths across all books.
+    Count(ctx context.Context) (int, error)
+    // Version identifies the data served (see Store.Version); a database
+    // has the version of the books it was built from.
+    Version(ctx context.Context) (string, error)
+    // Loaded returns when the data served was loaded (see Store.Loaded); a
+    // database reports when it was opened.
+    Loaded(ctx context.Context) (time.Time, error)
+    // Get returns the hadith with the given number in book.
+    Get(ctx context.Context, book string, number int) (Hadith, bool, error)
+    // GetMany looks up every ref from the same data, in the order of refs;
+    // found[i] reports whether refs[i] exists.
+    GetMany(ctx context.Context, refs []Ref) (hadiths []Hadith, found []bool, err error)
+    // Browse returns the hadiths of book numbered from to to, sorted by
+    // number. A zero bound is open.
+    Browse(ctx context.Context, book string, from, to int) ([]Hadith, error)
+    // Page returns up to limit hadiths of book in number order, starting
+    // at offset, and the number of hadiths in the book. A limit of zero or
+    // less means no limit.
+    Page(ctx context.Context, book string, offset, limit int) ([]Hadith, int, error)
+    // BrowsePage returns up to limit of the hadiths Browse(book, from, to)
+    // returns, starting at offset, and how many Browse returns. A limit of
+    // zero or less means no limit.
+    BrowsePage(ctx context.Context, book string, from, to, offset, limit int) ([]Hadith, int, error)
+    // Chapters returns the chapters of book in file order.
+    Chapters(ctx context.Context, book string) ([]Chapter, error)
+    // Chapter returns chapter n (1-based) of book and its hadiths.
+    Chapter(ctx context.Context, book string, n int) (Chapter, []Hadith, bool, error)
+    // Search runs query (see Store.Search) and returns the highlighted
+    // results selected by opts.Offset and opts.Limit, together with the
+    // total number of hits. A malformed query returns a *SyntaxError.
+    Search(ctx context.Context, query string, opts SearchOptions) ([]Result, int, error)
+    // Close releases the backend's resources.
+    Close() error
+}
+
+// Reloader is implemented by repositories that can pick up changed book
+// files while running, as the in-memory one does.
+type Reloader interface {
+    Reload() error
+    Watch(ctx context.Context, interval time.Duration, report func(error))
+}
+
+// PageAll returns up to limit hadiths of book, starting at offset, and
+// the number of hadiths in the book, as Page does; with an empty book it
+// pages through every book, by name and then by number. Only the page is
+// fetched. A limit of zero or less means no limit.
+func PageAll(ctx context.Context, repo Repository, book string, offset, limit int) ([]Hadith, int, error) {
+    if book != "" {
+        return repo.Page(ctx, book, offset, limit)
+    }
+    infos, err := repo.Books(ctx)
+    if err != nil {
+        return nil, 0, err
+    }
+    books := make([]string, len(infos))
+    counts := map[string]int{}
+    for i, b := range infos {
+        books[i] = b.Name
+        counts[b.Name] = b.Count
+    }
+    sort.Strings(books)
+    var out []Hadith
+    total := 0
+    for _, b := range books {
+        if limit > 0 && len(out) == limit {
+            // Page full: only the count is needed.
+            total += counts[b]
+            continue
+        }
+        n := 0
+        if limit > 0 {
+            n = limit - len(out)
+        }
+        hadiths, count, err := repo.Page(ctx, b, offset, n)
+        if err != nil {
+            return nil, 0, err
+        }
+        total += count
+        offset = max(offset-count, 0)
+        out = append(out, hadiths...)
+    }
+    return out, total, nil
+}
+
+// Memory returns s as a Repository. It also implements Reloader.
+func Memory(s *Store) Repository {
+    return memory{s}
+}
+
+type memory struct {
+    *Store
+}
+
+func (m memory) Books(context.Context) ([]BookInfo, error) { return m.Store.BookInfos(), nil }
+
+func (m memory) Languages(context.Context) ([]string, error) { return m.Store.Languages(), nil }
+
+func (m memory) Count(context.Context) (int, error) { return m.Store.Count(), nil }
+
+func (m memory) Version(context.Context) (string, error) { return m.Store.Version(), nil }
+
+func (m memory) Loaded(context.Context) (time.Time, error) { return m.Store.Loaded(), nil }
+
+func (m memory) Get(_ context.Context, book string, number int) (Hadith, bool, error) {
+    h, ok := m.Store.Get(book, number)
+    return h, ok, nil
+}
+
+func (m memory) GetMany(_ context.Context, refs []Ref) ([]Hadith, []bool, error) {
+    hadiths, found := m.Store.GetMany(refs)
+    return hadiths, found, nil
+}
+
+func (m memory) Browse(_ context.Context, book string, from, to int) ([]Hadith, error) {
+    return m.Store.Browse(book, from, to), nil
+}
+
+func (m memory) Page(_ context.Context, book string, offset, limit int) ([]Hadith, int, error) {
+    hadiths, total := m.Store.Page(book, offset, limit)
+    return hadiths, total, nil
+}
+
+func (m memory) BrowsePage(_ context.Context, book string, from, to, offset, limit int) ([]Hadith, int, error) {
+    hadiths, total := m.Store.BrowsePage(book, from, to, offset, limit)
+    return hadiths, total, nil
+}
+
+func (m memory) Chapters(_ context.Context, book string) ([]Chapter, error) {
+    return m.Store.Chapters(book), nil
+}
+
+func (m memory) Chapter(_ context.Context, book string, n int) (Chapter, []Hadith, bool, error) {
+    c, hadiths, ok := m.Store.Chapter(book, n)
+    return c, hadiths, ok, nil
+}
+
+func (m memory) Search(_ context.Context, query string, opts SearchOptions) ([]Result, int, error) {
+    return m.Store.search(query, opts)
+}
+
+func (m memory) Close() error { return nil }
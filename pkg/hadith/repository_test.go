@@ -0,0 +1,225 @@
+package hadith
+
+import (
+    "context"
+    "errors"
+    "reflect"
+    "testing"
+)
+
+// backends opens a Repository serving the hadiths of a Store, one per
+// backend built in. sqlite_test.go adds the SQLite backend.
+var backends = map[string]func(t *testing.T, s *Store) Repository{
+    "memory": func(t *testing.T, s *Store) Repository { return Memory(s) },
+}
+
+// openBooks loads the bundled books.
+func openBooks(t *testing.T) *Store {
+    t.Helper()
+    store, err := Open("../../books", Options{})
+    if err != nil {
+        t.Fatal(err)
+    }
+    return store
+}
+
+// eachBackend runs fn against every backend serving the bundled books.
+func eachBackend(t *testing.T, fn func(t *testing.T, repo Repository)) {
+    store := openBooks(t)
+    for name, open := range backends {
+        t.Run(name, func(t *testing.T) {
+            fn(t, open(t, store))
+        })
+    }
+}
+
+// TestRepository checks that every backend serves what the Store it was
+// built from holds.
+func TestRepository(t *testing.T) {
+    store := openBooks(t)
+    eachBackend(t, func(t *testing.T, repo Repository) {
+        ctx := context.Background()
+        books, err := repo.Books(ctx)
+        if err != nil || !reflect.DeepEqual(books, store.BookInfos()) {
+            t.Errorf("Books = %v, %v", books, err)
+        }
+        langs, err := repo.Languages(ctx)
+        if err != nil || !reflect.DeepEqual(langs, store.Languages()) {
+            t.Errorf("Languages = %v, %v; want %v", langs, err, store.Languages())
+        }
+        if n, err := repo.Count(ctx); err != nil || n != store.Count() {
+            t.Errorf("Count = %d, %v; want %d", n, err, store.Count())
+        }
+        if v, err := repo.Version(ctx); err != nil || v != store.Version() {
+            t.Errorf("Version = %q, %v; want %q", v, err, store.Version())
+        }
+        if l, err := repo.Loaded(ctx); err != nil || l.IsZero() {
+            t.Errorf("Loaded = %v, %v", l, err)
+        }
+
+        want, _ := store.Get("malik", 12)
+        if h, ok, err := repo.Get(ctx, "malik", 12); err != nil || !ok || !reflect.DeepEqual(h, want) {
+            t.Errorf("Get(malik, 12) = %v, %v, %v", h, ok, err)
+        }
+        for _, ref := range []Ref{{Book: "malik", Number: 99999}, {Book: "bukhari", Number: 1}, {Book: "malik"}} {
+            if _, ok, err := repo.Get(ctx, ref.Book, ref.Number); ok || err != nil {
+                t.Errorf("Get(%s) = %v, %v; want not found", ref, ok, err)
+            }
+        }
+        refs := []Ref{{Book: "darimi", Number: 3}, {Book: "bukhari", Number: 1}, {Book: "malik", Number: 12}, {Book: "darimi", Number: 3}}
+        hadiths, found, err := repo.GetMany(ctx, refs)
+        if err != nil || len(hadiths) != len(refs) || !reflect.DeepEqual(found, []bool{true, false, true, true}) {
+            t.Fatalf("GetMany = %d hadiths, %v, %v", len(hadiths), found, err)
+        }
+        for i, ref := range refs {
+            if found[i] && (hadiths[i].Book != ref.Book || hadiths[i].Number != ref.Number) {
+                t.Errorf("GetMany[%d] = %s #%d, want %s", i, hadiths[i].Book, hadiths[i].Number, ref)
+            }
+        }
+
+        for _, book := range []string{"malik", "bukhari"} {
+            chapters, err := repo.Chapters(ctx, book)
+            if err != nil || len(chapters) != len(store.Chapters(book)) || (len(chapters) > 0 && !reflect.DeepEqual(chapters, store.Chapters(book))) {
+                t.Errorf("Chapters(%s) = %d chapters, %v; want %d", book, len(chapters), err, len(store.Chapters(book)))
+            }
+        }
+        if cs := store.Chapters("malik"); len(cs) > 0 {
+            c, hs, ok, err := repo.Chapter(ctx, "malik", 1)
+            wantC, wantHs, _ := store.Chapter("malik", 1)
+            if err != nil || !ok || c != wantC || !reflect.DeepEqual(hs, wantHs) {
+                t.Errorf("Chapter(malik, 1) = %v with %d hadiths, %v, %v", c, len(hs), ok, err)
+            }
+        }
+        if _, _, ok, err := repo.Chapter(ctx, "malik", 0); ok || err != nil {
+            t.Errorf("Chapter(malik, 0) = %v, %v; want not found", ok, err)
+        }
+
+        // Scores differ between backends, the hits do not.
+        all, _ := store.Search("shalat", SearchOptions{})
+        results, total, err := repo.Search(ctx, "shalat", SearchOptions{Limit: 5})
+        if err != nil || len(results) != 5 || total != len(all) {
+            t.Errorf("Search(shalat) = %d results of %d, %v; want 5 of %d", len(results), total, err, len(all))
+        }
+        var syntaxErr *SyntaxError
+        if _, _, err := repo.Search(ctx, "(shalat", SearchOptions{}); !errors.As(err, &syntaxErr) {
+            t.Errorf("Search of a malformed query: %v, want a *SyntaxError", err)
+        }
+    })
+}
+
+func TestBrowsePage(t *testing.T) {
+    eachBackend(t, func(t *testing.T, repo Repository) {
+        ctx := context.Background()
+        // malik runs from 1 to 1594 with gaps.
+        malik, total, err := repo.Page(ctx, "malik", 0, 0)
+        if err != nil || len(malik) != total || total != 1587 {
+            t.Fatalf("Page(malik) = %d of %d, %v", len(malik), total, err)
+        }
+        first, last := malik[0].Number, malik[len(malik)-1].Number
+        // index returns the position of the first hadith numbered n or more.
+        index := func(n int) int {
+            for i, h := range malik {
+                if h.Number >= n {
+                    return i
+                }
+            }
+            return len(malik)
+        }
+        tests := []struct {
+            name                    string
+            book                    string
+            from, to, offset, limit int
+            start, end              int // expected slice of malik
+            total                   int
+        }{
+            {"whole book", "malik", 0, 0, 0, 0, 0, len(malik), len(malik)},
+            {"range", "malik", 10, 25, 0, 0, index(10), index(26), index(26) - index(10)},
+            {"open start", "malik", 0, 5, 0, 0, 0, index(6), index(6)},
+            {"open end", "malik", last - 3, 0, 0, 0, index(last - 3), len(malik), len(malik) - index(last-3)},
+            {"single", "malik", first, first, 0, 0, 0, 1, 1},
+            {"reversed", "malik", 25, 10, 0, 0, 0, 0, 0},
+            {"past the last number", "malik", last + 1, last + 100, 0, 0, 0, 0, 0},
+            {"beyond both ends", "malik", 0, last + 100, 0, 0, 0, len(malik), len(malik)},
+            {"page of a range", "malik", 10, 25, 3, 4, index(10) + 3, index(10) + 7, index(26) - index(10)},
+            {"offset past the end", "malik", 10, 25, 100, 5, 0, 0, index(26) - index(10)},
+            {"offset past the book", "malik", 0, 0, len(malik), 5, 0, 0, len(malik)},
+            {"negative offset", "malik", 0, 0, -5, 2, 0, 2, len(malik)},
+            {"limit past the end", "malik", 0, 0, len(malik) - 2, 10, len(malik) - 2, len(malik), len(malik)},
+            {"unknown book", "bukhari", 0, 0, 0, 10, 0, 0, 0},
+            {"empty book name", "", 0, 0, 0, 10, 0, 0, 0},
+        }
+        for _, tt := range tests {
+            got, total, err := repo.BrowsePage(ctx, tt.book, tt.from, tt.to, tt.offset, tt.limit)
+            if err != nil {
+                t.Fatal(err)
+            }
+            want := malik[tt.start:tt.end]
+            if total != tt.total || len(got) != len(want) {
+                t.Errorf("%s: %d hadiths of %d, want %d of %d", tt.name, len(got), total, len(want), tt.total)
+                continue
+            }
+            for i := range want {
+                if got[i].Book != want[i].Book || got[i].Number != want[i].Number {
+                    t.Errorf("%s: hadith %d = %s #%d, want #%d", tt.name, i, got[i].Book, got[i].Number, want[i].Number)
+                    break
+                }
+            }
+            // Browse and Page are BrowsePage without a page or a range.
+            if tt.offset == 0 && tt.limit == 0 {
+                if b, err := repo.Browse(ctx, tt.book, tt.from, tt.to); err != nil || len(b) != len(want) {
+                    t.Errorf("%s: Browse gave %d hadiths, %v", tt.name, len(b), err)
+                }
+            }
+            if tt.from == 0 && tt.to == 0 {
+                if p, n, err := repo.Page(ctx, tt.book, tt.offset, tt.limit); err != nil || len(p) != len(want) || n != tt.total {
+                    t.Errorf("%s: Page gave %d of %d, %v", tt.name, len(p), n, err)
+                }
+            }
+        }
+    })
+}
+
+func TestPageAll(t *testing.T) {
+    eachBackend(t, func(t *testing.T, repo Repository) {
+        ctx := context.Background()
+        darimi, _, _ := repo.Page(ctx, "darimi", 0, 0)
+        malik, _, _ := repo.Page(ctx, "malik", 0, 0)
+        all := append(append([]Hadith(nil), darimi...), malik...)
+        tests := []struct {
+            name          string
+            book          string
+            offset, limit int
+            from, to      int // expected slice of all
+            total         int
+        }{
+            {"first page", "", 0, 10, 0, 10, len(all)},
+            {"across books", "", len(darimi) - 3, 5, len(darimi) - 3, len(darimi) + 2, len(all)},
+            {"second book only", "", len(darimi), 2, len(darimi), len(darimi) + 2, len(all)},
+            {"last page short", "", len(all) - 2, 10, len(all) - 2, len(all), len(all)},
+            {"past the end", "", len(all) + 5, 10, len(all), len(all), len(all)},
+            {"no limit", "", len(all) - 4, 0, len(all) - 4, len(all), len(all)},
+            {"one book", "malik", 3, 4, len(darimi) + 3, len(darimi) + 7, len(malik)},
+            {"unknown book", "bukhari", 0, 10, 0, 0, 0},
+        }
+        for _, tt := range tests {
+            got, total, err := PageAll(ctx, repo, tt.book, tt.offset, tt.limit)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if total != tt.total {
+                t.Errorf("%s: total = %d, want %d", tt.name, total, tt.total)
+            }
+            want := all[tt.from:tt.to]
+            if len(got) != len(want) {
+                t.Errorf("%s: got %d hadiths, want %d", tt.name, len(got), len(want))
+                continue
+            }
+            for i := range want {
+                if got[i].Book != want[i].Book || got[i].Number != want[i].Number {
+                    t.Errorf("%s: hadith %d = %s:%d, want %s:%d", tt.name, i, got[i].Book, got[i].Number, want[i].Book, want[i].Number)
+                    break
+                }
+            }
+        }
+    })
+}
@@ -0,0 +1,143 @@
+package hadith
+
+import (
+    "github.com/nuzlilatief/hadith-go/internal/search"
+)
+
+// Result is a search hit: the hadith, its relevance score and, once
+// highlighted, the matched spans per field ("arab" or a language code).
+type Result = search.Result
+
+// Span is a matched byte range [Start, End) of a field's text.
+type Span = search.Span
+
+// Ranking configures BM25 relevance scoring; see DefaultRanking.
+type Ranking = search.Ranking
+
+// SyntaxError reports a malformed query and where it went wrong.
+type SyntaxError = search.SyntaxError
+
+// DefaultRanking is the ranking used when none is given.
+var DefaultRanking = search.DefaultRanking
+
+// SearchOptions controls Store.Search and Repository.Search. The zero value
+// searches the Indonesian translation and returns every hit.
+type SearchOptions struct {
+    Lang    string   // translation searched by unscoped words and highlighted; "" means DefaultLang
+    Limit   int      // maximum number of results; 0 means no cap
+    Ranking *Ranking // nil means DefaultRanking
+    Book    string   // only hits from this book; "" means all
+    Offset  int      // hits to skip before the first result
+    // After, when set, drops every hit up to and including the one it
+    // marks before Offset applies; see Cursor.
+    After *Cursor
+}
+
+// Search parses query and returns the matching hadiths, highlighted, best
+// first. A malformed query returns a *SyntaxError; a blank one returns no
+// results.
+//
+// The query language: plain words (all must match), "quoted phrases",
+// fields book:, number: (a number or a range such as 10..20, 10.. or
+// ..20), arab: and id:, AND, OR, NOT and parentheses. Unscoped words
+// search the Arabic text and the opts.Lang translation.
+func (s *Store) Search(query string, opts SearchOptions) ([]Result, error) {
+    results, _, err := s.search(query, opts)
+    return results, err
+}
+
+// search is Search that also returns the number of hits before Offset and
+// Limit were applied.
+func (s *Store) search(query string, opts SearchOptions) ([]Result, int, error) {
+    q, err := ParseQuery(query)
+    if err != nil || q == nil {
+        return nil, 0, err
+    }
+    q.Lang = opts.Lang
+    q.Ranking = opts.Ranking
+    q.Book = opts.Book
+    inner := q.inner()
+    inner.After = opts.After
+    results, total := inner.RunPage(s.s, q.ranking(), opts.Offset, opts.Limit)
+    q.Highlight(results)
+    return results, total, nil
+}
+
+// window returns the results selected by opts.After, opts.Offset and
+// opts.Limit (<= 0: all) from unsorted results, in result order, and the
+// number of results before cutting.
+func window(results []Result, opts SearchOptions) ([]Result, int) {
+    key := func(i int) Cursor { return CursorOf(results[i]) }
+    page := search.SelectPage(len(results), key, opts.After, opts.Offset, opts.Limit)
+    out := make([]Result, len(page))
+    for i, j := range page {
+        out[i] = results[j]
+    }
+    return out, len(results)
+}
+
+// Query is a parsed query that can be run more than once, e.g. to page
+// through its results and highlight only the page shown. A nil *Query, as
+// returned for a blank query, has no results.
+type Query struct {
+    Lang    string   // as in SearchOptions
+    Ranking *Ranking // as in SearchOptions
+    Book    string   // as in SearchOptions
+
+    q *search.Query
+}
+
+// ParseQuery parses a query (see Store.Search for the syntax). A blank
+// query yields a nil Query and no error.
+func ParseQuery(s string) (*Query, error) {
+    q, err := search.Parse(s)
+    if err != nil || q == nil {
+        return nil, err
+    }
+    return &Query{q: q}, nil
+}
+
+// Run returns up to limit results (limit <= 0: all) sorted by score, then by
+// book and number. Results are not highlighted.
+func (q *Query) Run(s *Store, limit int) []Result {
+    if q == nil {
+        return nil
+    }
+    return q.inner().RunRanked(s.s, limit, q.ranking())
+}
+
+func (q *Query) ranking() Ranking {
+    if q.Ranking != nil {
+        return *q.Ranking
+    }
+    return DefaultRanking
+}
+
+// Highlight sets Matches on each result to the words that match the query.
+func (q *Query) Highlight(results []Result) {
+    if q == nil {
+        return
+    }
+    q.inner().Highlight(results)
+}
+
+// inner returns the parsed query with Lang and Book applied. It works on a copy so
+// that one Query may be run from several goroutines.
+func (q *Query) inner() *search.Query {
+    c := *q.q
+    c.Lang = q.Lang
+    c.Book = q.Book
+    return &c
+}
+
+// Snippet returns a window of at most width runes of text around the
+// densest cluster of spans, with the spans that fall in it relative to the
+// snippet. width <= 0 keeps the whole text.
+func Snippet(text string, spans []Span, width int) (string, []Span) {
+    return search.Snippet(text, spans, width)
+}
+
+// Mark wraps each span of s in open and close, e.g. "<mark>" and "</mark>".
+func Mark(s string, spans []Span, open, close string) string {
+    return search.Mark(s, spans, open, close)
+}
@@ -0,0 +1,14 @@
+package hadith
+
+import "github.com/nuzlilatief/hadith-go/internal/data"
+
+// SnapshotFile is the name of the precompiled store in a books directory.
+const SnapshotFile = data.SnapshotFile
+
+// BuildSnapshot writes SnapshotFile to dir: the loaded hadiths, number
+// index and search index in a checksummed binary file. Open and OpenFS load
+// it instead of decoding the books while it is newer than every file in
+// the directory and the set of files and their sizes is unchanged; set
+// Options.IgnoreSnapshot to bypass it. It returns the number of hadiths
+// written.
+func BuildSnapshot(dir string) (int, error) { return data.BuildSnapshot(dir) }
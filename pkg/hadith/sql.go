@@ -0,0 +1,33 @@
+package hadith
+
+import "errors"
+
+// ErrNoSQLite is returned by OpenSQLite and WriteSQLite in binaries built
+// without the sqlite build tag.
+var ErrNoSQLite = errors.New("SQLite support is not compiled in (build with -tags sqlite)")
+
+// Set by sqlite.go when built with -tags sqlite, which pulls in the pure-Go
+// driver modernc.org/sqlite.
+var (
+    openSQLite  func(path string) (Repository, error)
+    writeSQLite func(s *Store, path string) error
+)
+
+// OpenSQLite opens, read-only, a database written by WriteSQLite. Opening
+// does not read the corpus, so it is fast however many books there are,
+// and searches run on the database's full-text index.
+func OpenSQLite(path string) (Repository, error) {
+    if openSQLite == nil {
+        return nil, ErrNoSQLite
+    }
+    return openSQLite(path)
+}
+
+// WriteSQLite writes everything in s to a new SQLite database at path,
+// replacing any file there once the database is complete.
+func WriteSQLite(s *Store, path string) error {
+    if writeSQLite == nil {
+        return ErrNoSQLite
+    }
+    return writeSQLite(s, path)
+}
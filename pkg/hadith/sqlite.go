@@ -0,0 +1,385 @@
+//go:build sqlite
+
+package hadith
+
+import (
+    "context"
+    "database/sql"
+    "encoding/json"
+    "errors"
+    "fmt"
+    "os"
+    "strings"
+    "time"
+
+    _ "modernc.org/sqlite"
+
+    "github.com/nuzlilatief/hadith-go/internal/search/index"
+)
+
+// sqliteSchema is bumped whenever the tables below change; OpenSQLite
+// refuses other versions.
+const sqliteSchema = "2"
+
+// Hadiths are stored whole as JSON in doc; the other columns are what the
+// queries select on. texts holds one row per hadith and text field with the
+// normalized text, indexed by trigrams so that substring matches are
+// indexed lookups.
+var sqliteTables = []string{
+    `CREATE TABLE meta (key TEXT PRIMARY KEY, value TEXT NOT NULL)`,
+    `CREATE TABLE books (pos INTEGER PRIMARY KEY, name TEXT NOT NULL UNIQUE, info TEXT NOT NULL)`,
+    `CREATE TABLE hadiths (
+        id INTEGER PRIMARY KEY,
+        book TEXT NOT NULL,
+        number INTEGER NOT NULL,
+        pos INTEGER NOT NULL,
+        chapter INTEGER NOT NULL,
+        nbook TEXT NOT NULL,
+        doc TEXT NOT NULL,
+        UNIQUE (book, number)
+    )`,
+    `CREATE INDEX hadiths_chapter ON hadiths (book, chapter, pos)`,
+    `CREATE TABLE chapters (book TEXT NOT NULL, n INTEGER NOT NULL, doc TEXT NOT NULL, PRIMARY KEY (book, n))`,
+    `CREATE VIRTUAL TABLE texts USING fts5(hid UNINDEXED, field UNINDEXED, norm, tokenize = 'trigram')`,
+}
+
+func init() {
+    openSQLite = openSQLiteDB
+    writeSQLite = writeSQLiteDB
+}
+
+type sqliteRepo struct {
+    db     *sql.DB
+    opened time.Time
+}
+
+func openSQLiteDB(path string) (Repository, error) {
+    if _, err := os.Stat(path); err != nil {
+        return nil, err
+    }
+    dsn := "file:" + strings.NewReplacer("?", "%3f", "#", "%23").Replace(path) + "?mode=ro"
+    db, err := sql.Open("sqlite", dsn)
+    if err != nil {
+        return nil, err
+    }
+    var version string
+    if err := db.QueryRow(`SELECT value FROM meta WHERE key = 'schema'`).Scan(&version); err != nil {
+        db.Close()
+        return nil, fmt.Errorf("%s: not a hadith database (run hadith-cli db build): %w", path, err)
+    }
+    if version != sqliteSchema {
+        db.Close()
+        return nil, fmt.Errorf("%s: database schema %s, want %s (rebuild with hadith-cli db build)", path, version, sqliteSchema)
+    }
+    return &sqliteRepo{db: db, opened: time.Now()}, nil
+}
+
+func writeSQLiteDB(s *Store, path string) (err error) {
+    tmp := path + ".tmp"
+    os.Remove(tmp)
+    db, err := sql.Open("sqlite", tmp)
+    if err != nil {
+        return err
+    }
+    defer func() {
+        if cerr := db.Close(); err == nil {
+            err = cerr
+        }
+        if err != nil {
+            os.Remove(tmp)
+            return
+        }
+        err = os.Rename(tmp, path)
+    }()
+    tx, err := db.Begin()
+    if err != nil {
+        return err
+    }
+    defer tx.Rollback()
+    for _, stmt := range sqliteTables {
+        if _, err := tx.Exec(stmt); err != nil {
+            return err
+        }
+    }
+    langs, _ := json.Marshal(s.Languages())
+    for key, value := range map[string]string{"schema": sqliteSchema, "languages": string(langs), "version": s.Version()} {
+        if _, err := tx.Exec(`INSERT INTO meta VALUES (?, ?)`, key, value); err != nil {
+            return err
+        }
+    }
+    for i, info := range s.BookInfos() {
+        doc, _ := json.Marshal(info)
+        if _, err := tx.Exec(`INSERT INTO books VALUES (?, ?, ?)`, i, info.Name, string(doc)); err != nil {
+            return err
+        }
+    }
+    // chapter of each hadith by book and number
+    chapterOf := map[string]map[int]int{}
+    for _, book := range s.Books() {
+        chapterOf[book] = map[int]int{}
+        for _, c := range s.Chapters(book) {
+            _, hadiths, _ := s.Chapter(book, c.Number)
+            for _, h := range hadiths {
+                chapterOf[book][h.Number] = c.Number
+            }
+            doc, _ := json.Marshal(c)
+            if _, err := tx.Exec(`INSERT INTO chapters VALUES (?, ?, ?)`, book, c.Number, string(doc)); err != nil {
+                return err
+            }
+        }
+    }
+    insHadith, err := tx.Prepare(`INSERT INTO hadiths VALUES (?, ?, ?, ?, ?, ?, ?)`)
+    if err != nil {
+        return err
+    }
+    insText, err := tx.Prepare(`INSERT INTO texts VALUES (?, ?, ?)`)
+    if err != nil {
+        return err
+    }
+    pos := map[string]int{}
+    for id, h := range s.All() {
+        p := pos[h.Book]
+        pos[h.Book]++
+        doc, err := json.Marshal(h)
+        if err != nil {
+            return err
+        }
+        // Unchaptered hadiths get 0; chapters are numbered from 1.
+        if _, err := insHadith.Exec(id, h.Book, h.Number, p, chapterOf[h.Book][h.Number], index.Normalize(h.Book), string(doc)); err != nil {
+            return fmt.Errorf("%s #%d: %w", h.Book, h.Number, err)
+        }
+        fields := map[string]string{"arab": h.Arab, DefaultLang: h.ID}
+        for lang, text := range h.Translations {
+            fields[lang] = text
+        }
+        for field, text := range fields {
+            if text == "" {
+                continue
+            }
+            if _, err := insText.Exec(id, field, index.Normalize(text)); err != nil {
+                return fmt.Errorf("%s #%d: %w", h.Book, h.Number, err)
+            }
+        }
+    }
+    return tx.Commit()
+}
+
+func (r *sqliteRepo) Books(ctx context.Context) ([]BookInfo, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT info FROM books ORDER BY pos`)
+    if err != nil {
+        return nil, err
+    }
+    var out []BookInfo
+    err = scanJSON(rows, func(doc []byte) error {
+        var b BookInfo
+        if err := json.Unmarshal(doc, &b); err != nil {
+            return err
+        }
+        out = append(out, b)
+        return nil
+    })
+    return out, err
+}
+
+func (r *sqliteRepo) Languages(ctx context.Context) ([]string, error) {
+    var doc string
+    if err := r.db.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = 'languages'`).Scan(&doc); err != nil {
+        return nil, err
+    }
+    var langs []string
+    err := json.Unmarshal([]byte(doc), &langs)
+    return langs, err
+}
+
+func (r *sqliteRepo) Count(ctx context.Context) (int, error) {
+    var n int
+    err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM hadiths`).Scan(&n)
+    return n, err
+}
+
+func (r *sqliteRepo) Version(ctx context.Context) (string, error) {
+    var v string
+    err := r.db.QueryRowContext(ctx, `SELECT value FROM meta WHERE key = 'version'`).Scan(&v)
+    return v, err
+}
+
+func (r *sqliteRepo) Loaded(context.Context) (time.Time, error) { return r.opened, nil }
+
+func (r *sqliteRepo) Get(ctx context.Context, book string, number int) (Hadith, bool, error) {
+    hadiths, err := r.hadiths(ctx, `book = ? AND number = ?`, book, number)
+    if err != nil || len(hadiths) == 0 {
+        return Hadith{}, false, err
+    }
+    return hadiths[0], true, nil
+}
+
+// GetMany looks the refs up in batches of getManyBatch, each one query.
+func (r *sqliteRepo) GetMany(ctx context.Context, refs []Ref) ([]Hadith, []bool, error) {
+    hadiths, found := make([]Hadith, len(refs)), make([]bool, len(refs))
+    for start := 0; start < len(refs); start += getManyBatch {
+        batch := refs[start:min(start+getManyBatch, len(refs))]
+        where := make([]string, len(batch))
+        args := make([]any, 0, 2*len(batch))
+        for i, ref := range batch {
+            where[i] = `(book = ? AND number = ?)`
+            args = append(args, ref.Book, ref.Number)
+        }
+        rows, err := r.hadiths(ctx, strings.Join(where, ` OR `), args...)
+        if err != nil {
+            return nil, nil, err
+        }
+        byRef := make(map[Ref]Hadith, len(rows))
+        for _, h := range rows {
+            byRef[Ref{Book: h.Book, Number: h.Number}] = h
+        }
+        for i, ref := range batch {
+            hadiths[start+i], found[start+i] = byRef[ref]
+        }
+    }
+    return hadiths, found, nil
+}
+
+// getManyBatch keeps GetMany queries well below SQLite's limit on
+// parameters.
+const getManyBatch = 500
+
+func (r *sqliteRepo) Browse(ctx context.Context, book string, from, to int) ([]Hadith, error) {
+    where, args := rangeWhere(book, from, to)
+    return r.hadiths(ctx, where+` ORDER BY number`, args...)
+}
+
+func (r *sqliteRepo) Page(ctx context.Context, book string, offset, limit int) ([]Hadith, int, error) {
+    return r.BrowsePage(ctx, book, 0, 0, offset, limit)
+}
+
+func (r *sqliteRepo) BrowsePage(ctx context.Context, book string, from, to, offset, limit int) ([]Hadith, int, error) {
+    where, args := rangeWhere(book, from, to)
+    var total int
+    if err := r.db.QueryRowContext(ctx, `SELECT count(*) FROM hadiths WHERE `+where, args...).Scan(&total); err != nil {
+        return nil, 0, err
+    }
+    if offset < 0 {
+        offset = 0
+    }
+    if limit <= 0 {
+        limit = -1 // no limit in SQLite
+    }
+    hadiths, err := r.hadiths(ctx, where+` ORDER BY number LIMIT ? OFFSET ?`, append(args, limit, offset)...)
+    return hadiths, total, err
+}
+
+// rangeWhere selects the hadiths of book numbered from through to; a zero
+// bound is open.
+func rangeWhere(book string, from, to int) (string, []any) {
+    where, args := `book = ?`, []any{book}
+    if from != 0 {
+        where, args = where+` AND number >= ?`, append(args, from)
+    }
+    if to != 0 {
+        where, args = where+` AND number <= ?`, append(args, to)
+    }
+    return where, args
+}
+
+func (r *sqliteRepo) Chapters(ctx context.Context, book string) ([]Chapter, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT doc FROM chapters WHERE book = ? ORDER BY n`, book)
+    if err != nil {
+        return nil, err
+    }
+    var out []Chapter
+    err = scanJSON(rows, func(doc []byte) error {
+        var c Chapter
+        if err := json.Unmarshal(doc, &c); err != nil {
+            return err
+        }
+        out = append(out, c)
+        return nil
+    })
+    return out, err
+}
+
+func (r *sqliteRepo) Chapter(ctx context.Context, book string, n int) (Chapter, []Hadith, bool, error) {
+    var doc string
+    err := r.db.QueryRowContext(ctx, `SELECT doc FROM chapters WHERE book = ? AND n = ?`, book, n).Scan(&doc)
+    if errors.Is(err, sql.ErrNoRows) {
+        return Chapter{}, nil, false, nil
+    }
+    if err != nil {
+        return Chapter{}, nil, false, err
+    }
+    var c Chapter
+    if err := json.Unmarshal([]byte(doc), &c); err != nil {
+        return Chapter{}, nil, false, err
+    }
+    hadiths, err := r.hadiths(ctx, `book = ? AND chapter = ? ORDER BY pos`, book, n)
+    if err != nil {
+        return Chapter{}, nil, false, err
+    }
+    return c, hadiths, true, nil
+}
+
+// Search selects the matching hadiths with the SQL form of the query, then
+// scores them with Query.Score, as there are no BM25 statistics on disk.
+func (r *sqliteRepo) Search(ctx context.Context, query string, opts SearchOptions) ([]Result, int, error) {
+    q, err := ParseQuery(query)
+    if err != nil || q == nil {
+        return nil, 0, err
+    }
+    q.Lang = opts.Lang
+    inner := q.inner()
+    where, args := inner.SQL()
+    if opts.Book != "" {
+        where, args = "("+where+") AND h.book = ?", append(args, opts.Book)
+    }
+    hadiths, err := r.hadiths(ctx, where, args...)
+    if err != nil {
+        return nil, 0, err
+    }
+    ranking := DefaultRanking
+    if opts.Ranking != nil {
+        ranking = *opts.Ranking
+    }
+    results := make([]Result, len(hadiths))
+    for i, h := range hadiths {
+        results[i] = Result{Hadith: h, Score: inner.Score(h, ranking)}
+    }
+    results, total := window(results, opts)
+    q.Highlight(results)
+    return results, total, nil
+}
+
+func (r *sqliteRepo) Close() error { return r.db.Close() }
+
+// hadiths returns the hadiths selected by where, a condition on the
+// hadiths table aliased h, optionally followed by ORDER BY.
+func (r *sqliteRepo) hadiths(ctx context.Context, where string, args ...any) ([]Hadith, error) {
+    rows, err := r.db.QueryContext(ctx, `SELECT h.doc FROM hadiths h WHERE `+where, args...)
+    if err != nil {
+        return nil, err
+    }
+    var out []Hadith
+    err = scanJSON(rows, func(doc []byte) error {
+        var h Hadith
+        if err := json.Unmarshal(doc, &h); err != nil {
+            return err
+        }
+        out = append(out, h)
+        return nil
+    })
+    return out, err
+}
+
+// scanJSON calls fn with the single text column of each row and closes rows.
+func scanJSON(rows *sql.Rows, fn func(doc []byte) error) error {
+    defer rows.Close()
+    for rows.Next() {
+        var doc []byte
+        if err := rows.Scan(&doc); err != nil {
+            return err
+        }
+        if err := fn(doc); err != nil {
+            return fmt.Errorf("corrupt row: %w", err)
+        }
+    }
+    return rows.Err()
+}
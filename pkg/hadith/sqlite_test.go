@@ -0,0 +1,23 @@
+//go:build sqlite
+
+package hadith
+
+import (
+    "path/filepath"
+    "testing"
+)
+
+func init() {
+    backends["sqlite"] = func(t *testing.T, s *Store) Repository {
+        path := filepath.Join(t.TempDir(), "hadith.db")
+        if err := WriteSQLite(s, path); err != nil {
+            t.Fatal(err)
+        }
+        repo, err := OpenSQLite(path)
+        if err != nil {
+            t.Fatal(err)
+        }
+        t.Cleanup(func() { repo.Close() })
+        return repo
+    }
+}
@@ -0,0 +1,36 @@
+package hadith
+
+import (
+    "io/fs"
+
+    "github.com/nuzlilatief/hadith-go/internal/data"
+)
+
+// Problem is a defect found by Validate. Problems with Warning set are
+// tolerated by the loader; the others make Open fail in strict mode.
+type Problem = data.Problem
+
+// ValidationError is returned by Open and Reload in strict mode when the
+// books have problems.
+type ValidationError = data.ValidationError
+
+// Validate checks every book and translation companion in dir and reports
+// all problems found, in file order. The error is only for an unreadable
+// directory.
+func Validate(dir string) ([]Problem, error) { return data.Validate(dir) }
+
+// ValidateFS is Validate for the books at the root of fsys.
+func ValidateFS(fsys fs.FS) ([]Problem, error) { return data.ValidateFS(fsys) }
+
+// Record is one hadith as stored in a book file, the unit a DecodeFunc
+// produces.
+type Record = data.Record
+
+// DecodeFunc reads the records of a book file in file order and calls fn for
+// each, stopping at the first error.
+type DecodeFunc = data.DecodeFunc
+
+// RegisterFormat makes book files with the extension ext (such as ".xml")
+// loadable with dec, alongside the built-in .json, .jsonl, .ndjson and .csv.
+// A ".gz" suffix is always accepted. Call it from an init function.
+func RegisterFormat(ext string, dec DecodeFunc) { data.RegisterFormat(ext, dec) }
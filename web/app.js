@@ -34,6 +34,27 @@
     return el;
   };
 
+  // Split text into strings and <mark> elements. Match ranges from the API
+  // are byte offsets into the UTF-8 encoding of the text.
+  const enc = new TextEncoder();
+  const dec = new TextDecoder();
+  const marked = (text, spans) => {
+    if (!Array.isArray(spans) || spans.length === 0) return [text];
+    const bytes = enc.encode(text);
+    const out = [];
+    let last = 0;
+    for (const s of spans) {
+      const start = s.Start ?? s.start;
+      const end = s.End ?? s.end;
+      if (!(start >= last && end <= bytes.length)) continue;
+      out.push(dec.decode(bytes.subarray(last, start)));
+      out.push(h('mark', {}, [dec.decode(bytes.subarray(start, end))]));
+      last = end;
+    }
+    out.push(dec.decode(bytes.subarray(last)));
+    return out;
+  };
+
   const debounce = (fn, ms) => {
     let t; return (...args) => { clearTimeout(t); t = setTimeout(() => fn(...args), ms); };
   };
@@ -72,14 +93,15 @@
       const number = hadith.number ?? hadith.Number ?? '';
       const id = hadith.id || hadith.Id || '';
       const arab = hadith.arab || hadith.Arab || '';
+      const matches = item.Matches || item.matches || {};
 
       const head = h('div', { class: 'head' }, [
         h('div', { class: 'book', text: book }),
         h('div', { class: 'no', text: `#${number}` }),
-        h('div', { class: 'score', text: score ? `score: ${score}` : '' }),
+        h('div', { class: 'score', text: score ? `score: ${Number(score).toFixed(2)}` : '' }),
       ]);
-      const idLine = h('div', { class: 'id' }, [id]);
-      const arLine = h('div', { class: 'ar arabic', lang: 'ar' }, [arab]);
+      const idLine = h('div', { class: 'id' }, marked(id, matches.id));
+      const arLine = h('div', { class: 'ar arabic', lang: 'ar' }, marked(arab, matches.arab));
       const li = h('li', { class: 'item' }, [head, idLine, arLine]);
       els.list.appendChild(li);
     }
@@ -116,19 +138,21 @@
   const initCounts = async () => {
     try {
       const [booksRes, countRes] = await Promise.all([
-        fetch('/books'),
+        fetch('/books?detail=true'),
         fetch('/count')
       ]);
       const books = booksRes.ok ? await booksRes.json() : [];
       const count = countRes.ok ? await countRes.json() : { count: 0 };
       els.booksCount.textContent = Array.isArray(books) ? books.length : '0';
       els.hadithCount.textContent = typeof count.count === 'number' ? count.count : '0';
-      // Populate select
+      // Populate select; detail entries carry display names
       if (Array.isArray(books)) {
         for (const b of books) {
+          const name = typeof b === 'string' ? b : b.name;
+          const names = (b && b.names) || {};
           const opt = document.createElement('option');
-          opt.value = String(b);
-          opt.textContent = String(b);
+          opt.value = String(name);
+          opt.textContent = String(names.id || names.en || name);
           els.book.appendChild(opt);
         }
       }